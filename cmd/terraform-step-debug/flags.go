@@ -0,0 +1,17 @@
+package main
+
+import "strings"
+
+// stringSliceFlag is a command line flag that can be given multiple times
+type stringSliceFlag []string
+
+// String returns the flag values as a comma separated list
+func (s *stringSliceFlag) String() string {
+	return strings.Join(*s, ",")
+}
+
+// Set appends a value to the flag
+func (s *stringSliceFlag) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
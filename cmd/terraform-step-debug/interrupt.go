@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+
+	"github.com/marc-poljak/terraform-step-debug/internal/ui"
+)
+
+// stepInterrupter turns interrupt signals into cancellation of the running step.
+// When no step is running, an interrupt exits the program as usual.
+type stepInterrupter struct {
+	mu        sync.Mutex
+	cancel    context.CancelFunc
+	stopping  bool
+	presenter ui.Presenter
+}
+
+// newStepInterrupter creates a stepInterrupter and starts listening for signals
+func newStepInterrupter() *stepInterrupter {
+	s := &stepInterrupter{}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		for range signals {
+			if !s.interrupt() {
+				s.mu.Lock()
+				presenter := s.presenter
+				s.mu.Unlock()
+				if presenter != nil {
+					presenter.Close()
+				}
+				fmt.Fprintln(os.Stderr, "\nInterrupted.")
+				os.Exit(130)
+			}
+		}
+	}()
+
+	return s
+}
+
+// attach reports interrupts through the frontend and closes it before an
+// interrupt exits the program
+func (s *stepInterrupter) attach(presenter ui.Presenter) {
+	s.mu.Lock()
+	s.presenter = presenter
+	s.mu.Unlock()
+}
+
+// messages returns where interrupt messages are written. The caller must hold s.mu.
+func (s *stepInterrupter) messages() io.Writer {
+	if s.presenter != nil {
+		return ui.Writer(s.presenter, ui.StreamError)
+	}
+	return os.Stderr
+}
+
+// stepContext returns a context that is cancelled when an interrupt arrives
+// while the step is running. The returned cancel function ends the step.
+func (s *stepInterrupter) stepContext() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	s.mu.Lock()
+	s.cancel = cancel
+	s.stopping = false
+	s.mu.Unlock()
+
+	return ctx, func() {
+		s.mu.Lock()
+		s.cancel = nil
+		s.stopping = false
+		s.mu.Unlock()
+		cancel()
+	}
+}
+
+// interrupt cancels the running step and reports whether there was one
+func (s *stepInterrupter) interrupt() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.cancel == nil {
+		return false
+	}
+
+	if s.stopping {
+		fmt.Fprintln(s.messages(), "\nStill waiting for Terraform to stop...")
+		return true
+	}
+
+	fmt.Fprintln(s.messages(), "\nInterrupt received, stopping Terraform gracefully...")
+	s.stopping = true
+	s.cancel()
+	return true
+}
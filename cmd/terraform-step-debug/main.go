@@ -1,14 +1,23 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"os"
+	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/marc-poljak/terraform-step-debug/internal/executor"
+	"github.com/marc-poljak/terraform-step-debug/internal/hooks"
 	"github.com/marc-poljak/terraform-step-debug/internal/model"
 	"github.com/marc-poljak/terraform-step-debug/internal/parser"
+	"github.com/marc-poljak/terraform-step-debug/internal/protection"
+	"github.com/marc-poljak/terraform-step-debug/internal/risk"
+	"github.com/marc-poljak/terraform-step-debug/internal/session"
+	"github.com/marc-poljak/terraform-step-debug/internal/snapshot"
 	"github.com/marc-poljak/terraform-step-debug/internal/ui"
 	"github.com/marc-poljak/terraform-step-debug/internal/util"
 )
@@ -19,11 +28,57 @@ var (
 	planFile      = flag.String("plan", "", "Path to the Terraform plan file (default: generate new plan)")
 	terraformPath = flag.String("terraform", "", "Path to the Terraform binary (default: use from PATH)")
 	dryRun        = flag.Bool("dry-run", false, "Perform a dry run without actually applying changes")
+	destroy       = flag.Bool("destroy", false, "Step through a destroy plan, tearing resources down from the leaves of the dependency graph to its roots")
+	refreshOnly   = flag.Bool("refresh-only", false, "Step through a refresh-only plan, accepting changes made outside Terraform one resource at a time")
 	targetAddr    = flag.String("target", "", "Target a specific resource (default: all resources)")
 	version       = flag.Bool("version", false, "Print version information and exit")
-	varFile       = flag.String("var-file", "", "Path to the Terraform variable file (e.g., prod.tfvars)")
+	workspace     = flag.String("workspace", "", "Terraform workspace to select and verify before every step (default: current workspace)")
+	runInit       = flag.Bool("init", false, "Run 'terraform init' before planning")
+	uiMode        = flag.String("ui", "auto", "User interface: tui (full-screen), line, json (event stream), script, or auto to use the TUI on interactive terminals")
+	noColor       = flag.Bool("no-color", false, "Disable colored output, also for Terraform (NO_COLOR is honored as well)")
+	colorTheme    = flag.String("color-theme", "", "Comma separated element=color overrides, e.g. create=cyan,failed=bold+magenta")
+	scriptFile    = flag.String("script", "", "File with one action per line to answer decisions with --ui=script")
+	hooksFile     = flag.String("hooks", "", "JSON file with commands or Go plugins to run before and after apply steps")
+	protectFile   = flag.String("protection", "", "JSON file with protected resources, whose deletion needs the address typed, and blocked resources")
+	snapshots     = flag.Bool("snapshots", true, "Save the state before every apply step, to compare and restore it later")
+	snapshotDir   = flag.String("snapshot-dir", "", "Directory for the state snapshots of each session (default: .terraform-step-debug/snapshots in the Terraform directory)")
+	recheck       = flag.Bool("recheck", true, "Re-evaluate check blocks and conditions with a refresh-only plan after every applied step")
+	driftSteps    = flag.Bool("drift-steps", false, "Add a step to refresh the state of each resource changed outside Terraform without a planned change")
+	riskOrder     = flag.String("risk-order", "plan", "Order of the resources within a layer: plan, first (riskiest first) or last (riskiest last)")
+	staleCheck    = flag.String("stale-check", "warn", "What to do when state or configuration changed since the plan: off, warn or block")
+	stepTimeout   = flag.Duration("step-timeout", 0, "Maximum duration of a single apply step, e.g. 10m (default: no timeout)")
+	maxAttempts   = flag.Int("max-attempts", 1, "Maximum number of apply attempts per resource (1 disables retries)")
+	retryBackoff  = flag.Duration("retry-backoff", 5*time.Second, "Wait before the first retry, doubled for each further retry")
+	retryMaxWait  = flag.Duration("retry-max-backoff", 2*time.Minute, "Upper bound for the wait between retries")
+	retryRules    = flag.String("retry-rules", strings.Join(executor.DefaultRetryRuleNames(), ","),
+		"Comma separated built-in rules of errors to retry: "+strings.Join(executor.BuiltinRetryRuleNames(), ", ")+" (empty for none)")
+	retryOn        stringSliceFlag
+	varFiles       stringSliceFlag
+	vars           stringSliceFlag
+	tfArgs         stringSliceFlag
+	planArgs       stringSliceFlag
+	applyArgs      stringSliceFlag
+	backendConfigs stringSliceFlag
+	watches        stringSliceFlag
+	statefulTypes  stringSliceFlag
 )
 
+func init() {
+	flag.Var(&retryOn, "retry-on", "Regular expression of Terraform errors to retry, in addition to --retry-rules (repeatable)")
+	flag.Var(&varFiles, "var-file", "Path to a Terraform variable file, e.g. prod.tfvars (repeatable)")
+	flag.Var(&vars, "var", "Terraform variable as name=value (repeatable)")
+	flag.Var(&tfArgs, "tf-arg", "Extra argument for every plan and apply, e.g. -lock-timeout=5m (repeatable)")
+	flag.Var(&planArgs, "plan-arg", "Extra argument for plan commands only, e.g. -refresh=false (repeatable)")
+	flag.Var(&applyArgs, "apply-arg", "Extra argument for apply commands only, e.g. -parallelism=2 (repeatable)")
+	flag.Var(&backendConfigs, "backend-config", "Backend configuration file or key=value passed to 'terraform init' (repeatable)")
+	flag.Var(&watches, "watch", "Terraform expression to evaluate after every applied step, e.g. aws_vpc.main.id (repeatable)")
+	flag.Var(&statefulTypes, "stateful-type", "Resource type pattern treated as stateful when scoring risk, e.g. aws_memorydb_* (repeatable)")
+}
+
+// status is where messages before and after the session go. It is standard
+// error for the JSON event stream, so that standard output only carries events.
+var status io.Writer = os.Stdout
+
 // Version information, to be set during build
 var (
 	Version   = "dev"
@@ -45,12 +100,74 @@ func main() {
 		exitWithError(err)
 	}
 
-	// Setup UI and parser
-	ui := ui.NewUI()
+	// Validate the retry and stale check settings before doing any work
+	retryPolicy, err := buildRetryPolicy()
+	if err != nil {
+		exitWithError(err)
+	}
+	staleMode, err := executor.ParseStaleCheckMode(*staleCheck)
+	if err != nil {
+		exitWithError(err)
+	}
+	var stepHooks []*hooks.Hook
+	if *hooksFile != "" {
+		if stepHooks, err = hooks.Load(*hooksFile); err != nil {
+			exitWithError(err)
+		}
+	}
+	riskModel, err := risk.NewModel(statefulTypes)
+	if err != nil {
+		exitWithError(err)
+	}
+	order, err := risk.ParseOrder(*riskOrder)
+	if err != nil {
+		exitWithError(err)
+	}
+	var policy *protection.Policy
+	if *protectFile != "" {
+		if policy, err = protection.Load(*protectFile); err != nil {
+			exitWithError(err)
+		}
+	}
+	colors := ui.ColorEnabled(*noColor)
+	theme, err := buildTheme(colors)
+	if err != nil {
+		exitWithError(err)
+	}
+
+	// Setup parser and signal handling
 	planParser := parser.NewTerraformPlanParser(*terraformPath)
+	planParser.SetDriftSteps(*driftSteps)
+	switch {
+	case *destroy && *refreshOnly:
+		exitWithError(fmt.Errorf("--destroy and --refresh-only cannot be combined"))
+	case *destroy:
+		planParser.SetMode(model.ModeDestroy)
+	case *refreshOnly:
+		planParser.SetMode(model.ModeRefreshOnly)
+	}
+	interrupter := newStepInterrupter()
+	if *uiMode == "json" {
+		status = os.Stderr
+		planParser.SetOutput(os.Stderr, os.Stderr)
+	}
+
+	inputs := buildInputs(colors)
+
+	// Initialize and select the workspace before planning
+	currentWorkspace, err := prepareWorkspace(interrupter, inputs)
+	if err != nil {
+		exitWithError(err)
+	}
+
+	// Record the configuration the plan is made from
+	configHashes, err := util.HashConfigFiles(*terraformDir, inputs.VarFiles)
+	if err != nil {
+		exitWithError(err)
+	}
 
 	// Handle plan file
-	cleanup, err := handlePlanFile(planParser)
+	cleanup, err := handlePlanFile(interrupter, planParser, inputs)
 	if err != nil {
 		exitWithError(err)
 	}
@@ -64,6 +181,20 @@ func main() {
 		exitWithError(fmt.Errorf("error parsing plan: %w", err))
 	}
 
+	// A saved plan must have been created with the same inputs used for the apply steps
+	if !cleanup {
+		if err := parser.VerifyPlanInputs(plan, *terraformDir, inputs); err != nil {
+			exitWithError(err)
+		}
+		// The plan file records the state it was made against, but not the configuration
+		if staleMode != executor.StaleCheckOff {
+			fmt.Fprintln(status, "Configuration changes are checked from now on, changes made since the plan was saved are not detected.")
+		}
+	}
+
+	plan.Workspace = currentWorkspace
+	plan.Backend = util.BackendType(*terraformDir)
+
 	// Check if there are changes and handle target resource
 	if !handlePlanChanges(plan) {
 		return
@@ -71,17 +202,83 @@ func main() {
 
 	// Build execution graph and run the executor
 	executionGraph := planParser.BuildExecutionGraph(plan)
-	executer := executor.NewTerraformExecutor(*terraformPath, *terraformDir, *planFile, *varFile, *dryRun)
+	executer := executor.NewTerraformExecutor(*terraformPath, *terraformDir, *planFile, inputs, *dryRun, *stepTimeout)
+	executer.SetRetryPolicy(retryPolicy)
+	executer.SetWorkspace(currentWorkspace)
+	if *destroy {
+		executer = executer.ForDestroy()
+	}
+
+	// Record the state the plan was made against
+	var baseline *executor.Baseline
+	if staleMode != executor.StaleCheckOff {
+		ctx, cancel := interrupter.stepContext()
+		baseline, err = executer.CaptureBaseline(ctx, plan, configHashes)
+		cancel()
+		if err != nil {
+			exitWithError(fmt.Errorf("error recording the state for stale plan checks: %w", err))
+		}
+	}
 
-	// Display the plan summary
-	ui.DisplayPlanSummary(plan)
+	// Keep a copy of the state before every apply step
+	var store *snapshot.Store
+	if *snapshots && !*dryRun {
+		dir := *snapshotDir
+		if dir == "" {
+			dir = filepath.Join(*terraformDir, ".terraform-step-debug", "snapshots")
+		}
+		if store, err = snapshot.NewStore(dir); err != nil {
+			exitWithError(err)
+		}
+		fmt.Fprintf(status, "State snapshots are saved to %s\n", store.Dir())
+	}
+
+	// Start the user interface
+	presenter, err := newPresenter(interrupter, theme)
+	if err != nil {
+		exitWithError(err)
+	}
+	interrupter.attach(presenter)
+	executer.SetOutput(ui.Writer(presenter, ui.StreamOutput), ui.Writer(presenter, ui.StreamError))
+	planParser.SetOutput(ui.Writer(presenter, ui.StreamOutput), ui.Writer(presenter, ui.StreamError))
 
 	// Execute the plan
-	executedResources := executeResources(ui, executer, executionGraph, plan, *targetAddr)
+	s := session.New(session.Config{
+		Presenter:        presenter,
+		Executor:         executer,
+		Planner:          planParser,
+		Inputs:           inputs,
+		TargetAddr:       *targetAddr,
+		Watches:          watches,
+		Hooks:            stepHooks,
+		Protection:       policy,
+		Risk:             riskModel,
+		RiskOrder:        order,
+		Snapshots:        store,
+		SkipChecks:       !*recheck,
+		RollbackExecutor: executer.ForDestroy(),
+		StaleMode:        staleMode,
+		Baseline:         baseline,
+		StepContext:      interrupter.stepContext,
+	}, plan, executionGraph)
+	err = s.Run()
+	s.Cleanup()
 
 	// Display summary and exit
-	ui.DisplaySummary(executedResources)
-	fmt.Println("Execution complete.")
+	presenter.Summary(s.Executed())
+	presenter.Close()
+	switch {
+	case errors.Is(err, session.ErrAborted):
+		fmt.Fprintln(status, "Execution aborted.")
+		return
+	case err != nil:
+		if cleanup {
+			util.CleanupFiles(*planFile)
+		}
+		exitWithError(err)
+	}
+	fmt.Fprintln(status, "Execution complete.")
+	printDeferred(plan)
 }
 
 // handleVersionFlag handles the version flag and returns true if the program should exit
@@ -124,8 +321,151 @@ func setupEnvironment() error {
 	return nil
 }
 
+// prepareWorkspace runs init and selects the workspace if requested,
+// and returns the workspace the plan and all steps must use
+func prepareWorkspace(interrupter *stepInterrupter, inputs model.Inputs) (string, error) {
+	ctx, cancel := interrupter.stepContext()
+	defer cancel()
+
+	if *runInit {
+		fmt.Fprintln(status, "Initializing Terraform...")
+		if err := util.InitTerraform(ctx, *terraformPath, *terraformDir, backendConfigs, inputs.NoColor); err != nil {
+			return "", err
+		}
+	} else if len(backendConfigs) > 0 {
+		return "", fmt.Errorf("--backend-config requires --init")
+	}
+
+	if *workspace != "" {
+		if err := util.SelectWorkspace(ctx, *terraformPath, *terraformDir, *workspace); err != nil {
+			return "", err
+		}
+	}
+
+	current, err := util.CurrentWorkspace(ctx, *terraformPath, *terraformDir)
+	if err != nil {
+		return "", err
+	}
+	if *workspace != "" && current != *workspace {
+		return "", fmt.Errorf("workspace %q is selected instead of %q", current, *workspace)
+	}
+
+	return current, nil
+}
+
+// newPresenter creates the user interface selected with the --ui flag
+func newPresenter(interrupter *stepInterrupter, theme ui.Theme) (ui.Presenter, error) {
+	if *scriptFile != "" && *uiMode != "script" {
+		return nil, fmt.Errorf("--script requires --ui=script")
+	}
+
+	switch *uiMode {
+	case "line":
+		return newLineUI(theme), nil
+	case "tui":
+		return newTUI(interrupter, theme)
+	case "json":
+		return ui.NewJSONPresenter(os.Stdin, os.Stdout), nil
+	case "script":
+		if *scriptFile == "" {
+			return nil, fmt.Errorf("--ui=script requires --script")
+		}
+		actions, err := ui.LoadScript(*scriptFile)
+		if err != nil {
+			return nil, err
+		}
+		return ui.NewScriptedPresenter(actions, os.Stdout), nil
+	case "auto":
+		if !ui.IsInteractiveTerminal() {
+			return newLineUI(theme), nil
+		}
+		tui, err := newTUI(interrupter, theme)
+		if err != nil {
+			return newLineUI(theme), nil
+		}
+		return tui, nil
+	default:
+		return nil, fmt.Errorf("invalid UI %q (use auto, tui, line, json or script)", *uiMode)
+	}
+}
+
+// newLineUI creates the line-based user interface with the given colors
+func newLineUI(theme ui.Theme) *ui.UI {
+	lineUI := ui.NewUI()
+	lineUI.SetTheme(theme)
+	return lineUI
+}
+
+// newTUI creates the full-screen user interface with the given colors
+func newTUI(interrupter *stepInterrupter, theme ui.Theme) (*ui.TUI, error) {
+	tui, err := ui.NewTUI(interrupter.interrupt)
+	if err != nil {
+		return nil, err
+	}
+	tui.SetTheme(theme)
+	return tui, nil
+}
+
+// buildTheme returns the color theme from the --color-theme flag, or no
+// colors at all when they are disabled
+func buildTheme(colors bool) (ui.Theme, error) {
+	theme, err := ui.ParseTheme(*colorTheme)
+	if err != nil {
+		return theme, err
+	}
+	if !colors {
+		return ui.NoColorTheme(), nil
+	}
+	return theme, nil
+}
+
+// buildInputs collects the variables and extra arguments passed to Terraform.
+// Terraform prints without colors when they are disabled, or when its output
+// ends up in the JSON event stream.
+func buildInputs(colors bool) model.Inputs {
+	return model.Inputs{
+		VarFiles:  varFiles,
+		Vars:      vars,
+		TFArgs:    tfArgs,
+		PlanArgs:  append(append([]string{}, tfArgs...), planArgs...),
+		ApplyArgs: append(append([]string{}, tfArgs...), applyArgs...),
+		NoColor:   !colors || *uiMode == "json",
+	}
+}
+
+// buildRetryPolicy builds the retry policy from the command line flags
+func buildRetryPolicy() (*executor.RetryPolicy, error) {
+	policy := &executor.RetryPolicy{
+		MaxAttempts:    *maxAttempts,
+		InitialBackoff: *retryBackoff,
+		MaxBackoff:     *retryMaxWait,
+	}
+
+	for _, name := range strings.Split(*retryRules, ",") {
+		if strings.TrimSpace(name) == "" {
+			continue
+		}
+		rule, err := executor.BuiltinRetryRule(name)
+		if err != nil {
+			return nil, err
+		}
+		policy.Rules = append(policy.Rules, rule)
+	}
+
+	for i, pattern := range retryOn {
+		rule, err := executor.NewRetryRule(fmt.Sprintf("custom-%d", i+1), pattern)
+		if err != nil {
+			return nil, err
+		}
+		policy.Rules = append(policy.Rules, rule)
+	}
+
+	return policy, nil
+}
+
 // handlePlanFile generates a plan file if needed and returns whether cleanup is needed
-func handlePlanFile(planParser *parser.TerraformPlanParser) (bool, error) {
+func handlePlanFile(interrupter *stepInterrupter, planParser *parser.TerraformPlanParser,
+	inputs model.Inputs) (bool, error) {
 	cleanup := false
 
 	// If no plan file is specified, generate one
@@ -137,8 +477,10 @@ func handlePlanFile(planParser *parser.TerraformPlanParser) (bool, error) {
 		}
 		cleanup = true
 
-		fmt.Printf("Generating Terraform plan to %s...\n", *planFile)
-		if err := planParser.GeneratePlan(*terraformDir, *planFile, *varFile); err != nil {
+		fmt.Fprintf(status, "Generating Terraform plan to %s...\n", *planFile)
+		ctx, cancel := interrupter.stepContext()
+		defer cancel()
+		if err := planParser.GeneratePlan(ctx, *terraformDir, *planFile, inputs); err != nil {
 			return cleanup, fmt.Errorf("error generating plan: %w", err)
 		}
 	}
@@ -151,7 +493,16 @@ func handlePlanFile(planParser *parser.TerraformPlanParser) (bool, error) {
 func handlePlanChanges(plan *model.Plan) bool {
 	// Check if there are any changes
 	if !plan.HasChanges {
-		fmt.Println("No changes to apply.")
+		switch plan.Mode {
+		case model.ModeRefreshOnly:
+			fmt.Fprintln(status, "No changes outside Terraform to refresh.")
+			return false
+		case model.ModeDestroy:
+			fmt.Fprintln(status, "Nothing to destroy.")
+			return false
+		}
+		fmt.Fprintln(status, "No changes to apply.")
+		printDeferred(plan)
 		return false
 	}
 
@@ -171,96 +522,16 @@ func handlePlanChanges(plan *model.Plan) bool {
 	return true
 }
 
-// executeResources executes the planned resources
-func executeResources(ui *ui.UI, executer *executor.TerraformExecutor,
-	executionGraph *model.ExecutionGraph, plan *model.Plan, targetAddr string) []*model.Resource {
-
-	var executedResources []*model.Resource
-
-	// Iterate through each layer of the execution graph
-	for layerIndex, layer := range executionGraph.Layers {
-		fmt.Printf("Executing layer %d of %d\n", layerIndex+1, len(executionGraph.Layers))
-
-		// Process each resource in the layer
-		for _, resource := range layer {
-			// Skip resources that are not targeted, if a target is specified
-			if targetAddr != "" && resource.Address != targetAddr {
-				continue
-			}
-
-			// Display resource information
-			totalResources := len(plan.Resources)
-			currentIndex := len(executedResources) + 1
-			ui.DisplayResourceInfo(resource, currentIndex, totalResources)
-
-			// Process the user's action for this resource
-			if processResourceAction(ui, executer, resource) {
-				executedResources = append(executedResources, resource)
-			}
-		}
-	}
-
-	return executedResources
-}
-
-// processResourceAction handles user actions for a resource
-// Returns true if the resource was processed and added to executed resources
-func processResourceAction(ui *ui.UI, executer *executor.TerraformExecutor, resource *model.Resource) bool {
-	for {
-		// Get the user action
-		action, err := ui.GetUserAction()
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error getting user action: %s\n", err)
-			continue
-		}
-
-		// Handle abort action
-		if action == model.StepAbort {
-			if confirmAbort() {
-				fmt.Println("Execution aborted.")
-				os.Exit(0)
-			}
-			continue
-		}
-
-		// Handle detail action
-		if action == model.StepDetail {
-			if err := executer.ExecuteStepAction(action, resource); err != nil {
-				fmt.Fprintf(os.Stderr, "Error: %s\n", err)
-			}
-			continue
-		}
-
-		// Execute the action
-		startTime := time.Now()
-		err = executer.ExecuteStepAction(action, resource)
-		elapsed := time.Since(startTime)
-
-		// Display the result
-		ui.DisplayExecutionResult(resource, err == nil, elapsed)
-
-		// If there was an error, ask if the user wants to continue
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error: %s\n", err)
-			if !ui.ConfirmContinue() {
-				fmt.Println("Execution aborted due to errors.")
-				os.Exit(1)
-			}
-		}
-
-		return true
+// printDeferred reminds of the changes Terraform deferred, which need another
+// plan once this one is applied
+func printDeferred(plan *model.Plan) {
+	if len(plan.Deferred) == 0 {
+		return
 	}
-}
-
-// confirmAbort asks the user to confirm aborting the execution
-func confirmAbort() bool {
-	fmt.Print("Are you sure you want to abort? [y/n]: ")
-	var confirm string
-	if _, err := fmt.Scanln(&confirm); err != nil {
-		fmt.Fprintf(os.Stderr, "Error reading confirmation: %s\n", err)
-		return false
+	fmt.Fprintln(status, "Deferred by Terraform, run again to plan these changes:")
+	for _, change := range plan.Deferred {
+		fmt.Fprintf(status, "  %s (%s): %s\n", change.Address, change.Action, change.Reason)
 	}
-	return confirm == "y" || confirm == "Y"
 }
 
 // exitWithError prints an error message and exits with code 1
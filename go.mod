@@ -1,3 +1,7 @@
 module github.com/marc-poljak/terraform-step-debug
 
 go 1.21
+
+require golang.org/x/term v0.20.0
+
+require golang.org/x/sys v0.20.0 // indirect
@@ -0,0 +1,51 @@
+package executor
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/marc-poljak/terraform-step-debug/internal/util"
+)
+
+// Evaluate evaluates a Terraform expression against the current state with
+// 'terraform console', using the same directory, variables and workspace as
+// the apply steps. It returns the value as printed by Terraform.
+func (e *TerraformExecutor) Evaluate(ctx context.Context, expression string) (string, error) {
+	expression = strings.TrimSpace(expression)
+	if expression == "" {
+		return "", fmt.Errorf("empty expression")
+	}
+	if strings.Contains(expression, "\n") {
+		return "", fmt.Errorf("expressions must fit on a single line")
+	}
+
+	if err := e.verifyWorkspace(ctx); err != nil {
+		return "", fmt.Errorf("refusing to evaluate %q: %w", expression, err)
+	}
+
+	args := append([]string{"console"}, util.VariableArgs(e.inputs)...)
+	cmd := util.TerraformCommand(ctx, e.terraformPath, e.terraformDir, args...)
+	cmd.Stdin = strings.NewReader(expression + "\n")
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return "", fmt.Errorf("evaluation of %q was cancelled: %w", expression, ctx.Err())
+		}
+		diagnostics := extractDiagnostics(stderr.String())
+		if diagnostics == "" {
+			diagnostics = strings.TrimSpace(stderr.String())
+		}
+		if diagnostics == "" {
+			diagnostics = err.Error()
+		}
+		return "", fmt.Errorf("failed to evaluate %q: %s", expression, diagnostics)
+	}
+
+	return strings.TrimSpace(ansiEscape.ReplaceAllString(stdout.String(), "")), nil
+}
@@ -0,0 +1,41 @@
+package executor
+
+import (
+	"regexp"
+	"strings"
+)
+
+// ansiEscape matches terminal color sequences in Terraform output
+var ansiEscape = regexp.MustCompile(`\x1b\[[0-9;]*m`)
+
+// extractDiagnostics returns the error diagnostics from Terraform output.
+// Terraform frames each diagnostic with box drawing characters; only the
+// frames containing an error are kept. Output without frames is scanned for
+// plain "Error:" lines instead.
+func extractDiagnostics(output string) string {
+	var diagnostics []string
+	var current []string
+	inFrame := false
+
+	for _, line := range strings.Split(ansiEscape.ReplaceAllString(output, ""), "\n") {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(trimmed, "╷"):
+			inFrame = true
+			current = nil
+		case strings.HasPrefix(trimmed, "╵"):
+			if inFrame && len(current) > 0 && strings.HasPrefix(current[0], "Error:") {
+				diagnostics = append(diagnostics, strings.Join(current, "\n"))
+			}
+			inFrame = false
+		case inFrame:
+			if text := strings.TrimSpace(strings.TrimPrefix(trimmed, "│")); text != "" {
+				current = append(current, text)
+			}
+		case strings.HasPrefix(trimmed, "Error:"):
+			diagnostics = append(diagnostics, trimmed)
+		}
+	}
+
+	return strings.Join(diagnostics, "\n\n")
+}
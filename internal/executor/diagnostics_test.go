@@ -0,0 +1,109 @@
+package executor
+
+import "testing"
+
+// Terraform output of failed applies, as written to the terminal
+const (
+	throttledOutput = "aws_instance.web: Creating...\n" +
+		"╷\n" +
+		"│ Error: creating EC2 Instance: operation error EC2: RunInstances, https response error StatusCode: 400, RequestID: 5c1e, api error RequestLimitExceeded: Request limit exceeded.\n" +
+		"│ \n" +
+		"│   with aws_instance.web,\n" +
+		"│   on main.tf line 12, in resource \"aws_instance\" \"web\":\n" +
+		"│   12: resource \"aws_instance\" \"web\" {\n" +
+		"│ \n" +
+		"╵\n"
+
+	stateLockOutput = "╷\n" +
+		"│ Error: Error acquiring the state lock\n" +
+		"│ \n" +
+		"│ Error message: ConditionalCheckFailedException: The conditional request failed\n" +
+		"│ Lock Info:\n" +
+		"│   ID:        3b2c7f0e-8d4a-4c59-a0c5-0e8f1d7c2a11\n" +
+		"│   Operation: OperationTypeApply\n" +
+		"│ \n" +
+		"│ Terraform acquires a state lock to protect the state from being written\n" +
+		"│ by multiple users at the same time.\n" +
+		"╵\n"
+
+	conflictOutput = "╷\n" +
+		"│ Warning: Argument is deprecated\n" +
+		"│ \n" +
+		"│ Use the aws_s3_bucket_acl resource instead\n" +
+		"╵\n" +
+		"╷\n" +
+		"│ Error: creating S3 Bucket (logs): operation error S3: CreateBucket, https response error StatusCode: 409, RequestID: 7Q2, BucketAlreadyExists: \n" +
+		"│ \n" +
+		"│   with aws_s3_bucket.logs,\n" +
+		"│   on main.tf line 1, in resource \"aws_s3_bucket\" \"logs\":\n" +
+		"│    1: resource \"aws_s3_bucket\" \"logs\" {\n" +
+		"│ \n" +
+		"╵\n"
+
+	notFoundOutput = "╷\n" +
+		"│ Error: attaching policy to IAM Role (app): NoSuchEntity: The role with name app cannot be found.\n" +
+		"╵\n"
+
+	// With -no-color, diagnostics are not framed
+	plainOutput = "aws_instance.web: Creating...\n" +
+		"\n" +
+		"Error: creating EC2 Instance: api error Throttling: Rate exceeded\n" +
+		"\n" +
+		"  with aws_instance.web,\n" +
+		"  on main.tf line 12, in resource \"aws_instance\" \"web\":\n"
+)
+
+func TestExtractDiagnostics(t *testing.T) {
+	tests := []struct {
+		name   string
+		output string
+		want   string
+	}{
+		{
+			name:   "framed error",
+			output: throttledOutput,
+			want: "Error: creating EC2 Instance: operation error EC2: RunInstances, https response error StatusCode: 400, RequestID: 5c1e, api error RequestLimitExceeded: Request limit exceeded.\n" +
+				"with aws_instance.web,\n" +
+				"on main.tf line 12, in resource \"aws_instance\" \"web\":\n" +
+				"12: resource \"aws_instance\" \"web\" {",
+		},
+		{
+			name:   "warnings are left out",
+			output: conflictOutput,
+			want: "Error: creating S3 Bucket (logs): operation error S3: CreateBucket, https response error StatusCode: 409, RequestID: 7Q2, BucketAlreadyExists:\n" +
+				"with aws_s3_bucket.logs,\n" +
+				"on main.tf line 1, in resource \"aws_s3_bucket\" \"logs\":\n" +
+				"1: resource \"aws_s3_bucket\" \"logs\" {",
+		},
+		{
+			name:   "colored output",
+			output: "\x1b[31m╷\x1b[0m\x1b[0m\n\x1b[31m│\x1b[0m \x1b[0m\x1b[1m\x1b[31mError: \x1b[0m\x1b[0m\x1b[1mError acquiring the state lock\x1b[0m\n\x1b[31m╵\x1b[0m\x1b[0m\n",
+			want:   "Error: Error acquiring the state lock",
+		},
+		{
+			name:   "several errors",
+			output: throttledOutput + notFoundOutput,
+			want: "Error: creating EC2 Instance: operation error EC2: RunInstances, https response error StatusCode: 400, RequestID: 5c1e, api error RequestLimitExceeded: Request limit exceeded.\n" +
+				"with aws_instance.web,\n" +
+				"on main.tf line 12, in resource \"aws_instance\" \"web\":\n" +
+				"12: resource \"aws_instance\" \"web\" {\n\n" +
+				"Error: attaching policy to IAM Role (app): NoSuchEntity: The role with name app cannot be found.",
+		},
+		{
+			name:   "without frames",
+			output: plainOutput,
+			want:   "Error: creating EC2 Instance: api error Throttling: Rate exceeded",
+		},
+		{
+			name:   "no errors",
+			output: "Apply complete! Resources: 1 added, 0 changed, 0 destroyed.\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := extractDiagnostics(tt.output); got != tt.want {
+				t.Errorf("extractDiagnostics =\n%q\nwant\n%q", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,13 +1,17 @@
 package executor
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"os"
-	"os/exec"
 	"strings"
 	"time"
 
 	"github.com/marc-poljak/terraform-step-debug/internal/model"
+	"github.com/marc-poljak/terraform-step-debug/internal/util"
 )
 
 // TerraformExecutor handles the execution of Terraform operations
@@ -15,12 +19,20 @@ type TerraformExecutor struct {
 	terraformPath string
 	terraformDir  string
 	planFile      string
-	varFile       string
+	inputs        model.Inputs
 	dryRun        bool
+	stepTimeout   time.Duration
+	retryPolicy   *RetryPolicy
+	workspace     string
+	destroy       bool // Apply steps destroy the resource instead of applying the plan
+	stdout        io.Writer
+	stderr        io.Writer
 }
 
-// NewTerraformExecutor creates a new TerraformExecutor
-func NewTerraformExecutor(terraformPath, terraformDir, planFile, varFile string, dryRun bool) *TerraformExecutor {
+// NewTerraformExecutor creates a new TerraformExecutor.
+// A stepTimeout of zero means steps never time out.
+func NewTerraformExecutor(terraformPath, terraformDir, planFile string, inputs model.Inputs, dryRun bool,
+	stepTimeout time.Duration) *TerraformExecutor {
 	if terraformPath == "" {
 		terraformPath = "terraform" // Default to using terraform from PATH
 	}
@@ -29,18 +41,156 @@ func NewTerraformExecutor(terraformPath, terraformDir, planFile, varFile string,
 		terraformPath: terraformPath,
 		terraformDir:  terraformDir,
 		planFile:      planFile,
-		varFile:       varFile,
+		inputs:        inputs,
 		dryRun:        dryRun,
+		stepTimeout:   stepTimeout,
+		stdout:        os.Stdout,
+		stderr:        os.Stderr,
 	}
 }
 
-// ApplyResource applies a single resource from the plan
-func (e *TerraformExecutor) ApplyResource(resource *model.Resource) error {
-	fmt.Printf("Applying resource: %s (%s)\n", resource.Address, resource.Action)
+// SetOutput sets where Terraform output and progress messages are written
+func (e *TerraformExecutor) SetOutput(stdout, stderr io.Writer) {
+	e.stdout = stdout
+	e.stderr = stderr
+}
+
+// ForDestroy returns a copy of the executor whose apply steps destroy the
+// resource with 'terraform apply -destroy'
+func (e *TerraformExecutor) ForDestroy() *TerraformExecutor {
+	destroyer := *e
+	destroyer.destroy = true
+	return &destroyer
+}
+
+// SetRetryPolicy sets the policy used to retry failed applies.
+// A nil policy disables retries.
+func (e *TerraformExecutor) SetRetryPolicy(policy *RetryPolicy) {
+	e.retryPolicy = policy
+}
+
+// SetPlanFile sets the plan file used for resource details, after re-planning
+func (e *TerraformExecutor) SetPlanFile(planFile string) {
+	e.planFile = planFile
+}
+
+// DryRun reports whether applies are only simulated
+func (e *TerraformExecutor) DryRun() bool {
+	return e.dryRun
+}
 
+// SetWorkspace sets the workspace every apply must run against.
+// An empty workspace disables the check.
+func (e *TerraformExecutor) SetWorkspace(workspace string) {
+	e.workspace = workspace
+}
+
+// verifyWorkspace makes sure the selected workspace has not changed since the plan was made
+func (e *TerraformExecutor) verifyWorkspace(ctx context.Context) error {
+	if e.workspace == "" {
+		return nil
+	}
+
+	current, err := util.CurrentWorkspace(ctx, e.terraformPath, e.terraformDir)
+	if err != nil {
+		return err
+	}
+	if current != e.workspace {
+		return fmt.Errorf("workspace is %q, but the plan was made for workspace %q", current, e.workspace)
+	}
+	return nil
+}
+
+// IsInterrupted reports whether err was caused by a cancelled or timed out step
+func IsInterrupted(err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// stepContext derives the context for a single step, applying the step timeout
+func (e *TerraformExecutor) stepContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if e.stepTimeout > 0 {
+		return context.WithTimeout(ctx, e.stepTimeout)
+	}
+	return context.WithCancel(ctx)
+}
+
+// ApplyResource applies a single resource from the plan, retrying transient
+// failures according to the retry policy
+func (e *TerraformExecutor) ApplyResource(ctx context.Context, resource *model.Resource) error {
+	fmt.Fprintf(e.stdout, "Applying resource: %s (%s)\n", resource.Address, resource.Action)
+
+	// Refuse to apply against a different workspace than the plan
+	if err := e.verifyWorkspace(ctx); err != nil {
+		resource.Status = model.StatusFailed
+		return fmt.Errorf("refusing to apply resource %s: %w", resource.Address, err)
+	}
+
+	for attempt := 1; ; attempt++ {
+		err := e.applyAttempt(ctx, resource)
+		if err == nil || IsInterrupted(err) {
+			return err
+		}
+
+		last := &resource.Attempts[len(resource.Attempts)-1]
+		rule := e.retryPolicy.Match(attempt, last.Error)
+		if rule == nil {
+			return err
+		}
+		last.RetryRule = rule.Name
+
+		backoff := e.retryPolicy.Backoff(attempt)
+		fmt.Fprintf(e.stdout, "Attempt %d failed with a %s error, retrying in %s...\n", attempt, rule.Name, backoff)
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			resource.Status = model.StatusCanceled
+			return fmt.Errorf("retry of resource %s was cancelled: %w", resource.Address, ctx.Err())
+		}
+	}
+}
+
+// applyAttempt runs a single targeted apply and records it on the resource
+func (e *TerraformExecutor) applyAttempt(ctx context.Context, resource *model.Resource) error {
+	ctx, cancel := e.stepContext(ctx)
+	defer cancel()
+
+	attempt := model.Attempt{Number: len(resource.Attempts) + 1}
+	startTime := time.Now()
+	err := e.runApply(ctx, resource, &attempt)
+	attempt.Duration = time.Since(startTime)
+	resource.Attempts = append(resource.Attempts, attempt)
+
+	return err
+}
+
+// runApply executes the targeted apply, filling in the error of a failed attempt
+func (e *TerraformExecutor) runApply(ctx context.Context, resource *model.Resource, attempt *model.Attempt) error {
 	if e.dryRun {
-		fmt.Println("[DRY RUN] Would apply this resource")
-		time.Sleep(500 * time.Millisecond) // Simulate execution time
+		fmt.Fprintln(e.stdout, "[DRY RUN] Would apply this resource")
+		// Simulate execution time
+		select {
+		case <-time.After(500 * time.Millisecond):
+			resource.Status = model.StatusComplete
+			return nil
+		case <-ctx.Done():
+			err := e.interrupted(ctx, resource)
+			attempt.Error = err.Error()
+			return err
+		}
+	}
+
+	// State-only steps run their own commands instead of an apply
+	if stateCommand := e.stateCommand(resource); stateCommand != nil {
+		if err := stateCommand(ctx, resource); err != nil {
+			if ctx.Err() != nil {
+				err = e.interrupted(ctx, resource)
+			} else {
+				resource.Status = model.StatusFailed
+			}
+			attempt.Error = err.Error()
+			return err
+		}
+		resource.Status = model.StatusComplete
 		return nil
 	}
 
@@ -49,25 +199,41 @@ func (e *TerraformExecutor) ApplyResource(resource *model.Resource) error {
 	args := []string{
 		"apply",
 		"-auto-approve",
-		"-target",
-		resource.Address,
 	}
-
-	// Add var-file if specified
-	if e.varFile != "" {
-		args = append(args, "-var-file", e.varFile)
+	switch {
+	case e.destroy:
+		args = append(args, "-destroy")
+	case resource.Action == model.ActionRefresh:
+		// Only the state of the resource takes what the refresh found
+		args = append(args, "-refresh-only")
+	}
+	args = append(args, "-target", resource.Address)
+	for _, address := range resource.Group {
+		args = append(args, "-target", address)
 	}
 
-	cmd := exec.Command(e.terraformPath, args...)
+	// Add the variables and extra apply arguments
+	args = util.ApplyArgs(args, e.inputs)
 
-	cmd.Dir = e.terraformDir
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
+	// Keep a copy of the error output to find out whether the failure is transient
+	var stderr bytes.Buffer
+	cmd := util.TerraformCommand(ctx, e.terraformPath, e.terraformDir, args...)
+	cmd.Stdout = e.stdout
+	cmd.Stderr = io.MultiWriter(e.stderr, &stderr)
 
 	// Execute the command
 	err := cmd.Run()
 	if err != nil {
+		if ctx.Err() != nil {
+			err = e.interrupted(ctx, resource)
+			attempt.Error = err.Error()
+			return err
+		}
 		resource.Status = model.StatusFailed
+		attempt.Error = extractDiagnostics(stderr.String())
+		if attempt.Error == "" {
+			attempt.Error = err.Error()
+		}
 		return fmt.Errorf("failed to apply resource %s: %w", resource.Address, err)
 	}
 
@@ -75,75 +241,98 @@ func (e *TerraformExecutor) ApplyResource(resource *model.Resource) error {
 	return nil
 }
 
-// GetResourceDetails retrieves detailed information about a resource
-func (e *TerraformExecutor) GetResourceDetails(resource *model.Resource) (string, error) {
-	// For an existing resource, we can use terraform state show
-	// For a planned resource, we need to use the plan file
-
-	var cmd *exec.Cmd
-	if resource.Action == model.ActionCreate {
-		// For creates, use the plan file
-		cmd = exec.Command(
-			e.terraformPath,
-			"show",
-			"-json",
-			e.planFile,
-		)
-	} else {
-		// For updates/deletes, try to get current state
-		cmd = exec.Command(
-			e.terraformPath,
-			"state",
-			"show",
-			resource.Address,
-		)
-	}
-
-	cmd.Dir = e.terraformDir
-	output, err := cmd.Output()
-	if err != nil {
-		// If state show fails (resource might not exist), fall back to plan
-		cmd = exec.Command(
-			e.terraformPath,
-			"show",
-			"-json",
-			e.planFile,
-		)
-		cmd.Dir = e.terraformDir
-		output, err = cmd.Output()
-		if err != nil {
-			return "", fmt.Errorf("failed to get resource details: %w", err)
+// stateCommand returns the function that carries out a state-only step,
+// or nil for steps that are applied. Objects imported by identity have no
+// ID and are imported by a targeted apply.
+func (e *TerraformExecutor) stateCommand(resource *model.Resource) func(context.Context, *model.Resource) error {
+	switch {
+	case resource.Action == model.ActionRestore:
+		return e.restoreState
+	case resource.Action == model.ActionImport && resource.ImportID != "":
+		return e.importResource
+	case resource.Action == model.ActionMove:
+		return e.moveResource
+	case resource.Action == model.ActionForget:
+		return e.forgetResource
+	default:
+		return nil
+	}
+}
+
+// importResource imports the existing object with 'terraform import'
+func (e *TerraformExecutor) importResource(ctx context.Context, resource *model.Resource) error {
+	args := append([]string{"import"}, util.ColorArgs(e.inputs)...)
+	args = append(args, util.VariableArgs(e.inputs)...)
+	args = util.StateArgs(args, e.inputs)
+	return e.runStateCommand(ctx, resource, append(args, resource.Address, resource.ImportID)...)
+}
+
+// moveResource moves the object to its new address with 'terraform state mv'
+func (e *TerraformExecutor) moveResource(ctx context.Context, resource *model.Resource) error {
+	args := util.StateArgs([]string{"state", "mv"}, e.inputs)
+	return e.runStateCommand(ctx, resource, append(args, resource.PreviousAddress, resource.Address)...)
+}
+
+// forgetResource removes the object from the state with 'terraform state rm',
+// without destroying it
+func (e *TerraformExecutor) forgetResource(ctx context.Context, resource *model.Resource) error {
+	args := util.StateArgs([]string{"state", "rm"}, e.inputs)
+	return e.runStateCommand(ctx, resource, append(args, resource.Address)...)
+}
+
+// runStateCommand runs a Terraform command of a state-only step
+func (e *TerraformExecutor) runStateCommand(ctx context.Context, resource *model.Resource, args ...string) error {
+	var stderr bytes.Buffer
+	cmd := util.TerraformCommand(ctx, e.terraformPath, e.terraformDir, args...)
+	cmd.Stdout = e.stdout
+	cmd.Stderr = io.MultiWriter(e.stderr, &stderr)
+	if err := cmd.Run(); err != nil {
+		if diagnostics := extractDiagnostics(stderr.String()); diagnostics != "" {
+			return fmt.Errorf("failed to %s resource %s: %s", resource.Action, resource.Address, diagnostics)
 		}
+		return fmt.Errorf("failed to %s resource %s: %w", resource.Action, resource.Address, err)
+	}
+	return nil
+}
+
+// interrupted records a cancelled or timed out apply on the resource
+func (e *TerraformExecutor) interrupted(ctx context.Context, resource *model.Resource) error {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		resource.Status = model.StatusTimeout
+		return fmt.Errorf("apply of resource %s timed out after %s: %w", resource.Address, e.stepTimeout, ctx.Err())
 	}
 
-	// For JSON output, we'd need to extract the specific resource
-	// For simplicity, we'll just return the raw output for now
-	return string(output), nil
+	resource.Status = model.StatusCanceled
+	return fmt.Errorf("apply of resource %s was cancelled: %w", resource.Address, ctx.Err())
 }
 
 // AbortPlan aborts the current plan execution
 func (e *TerraformExecutor) AbortPlan() error {
-	fmt.Println("Aborting plan execution")
+	fmt.Fprintln(e.stdout, "Aborting plan execution")
 	return nil
 }
 
 // GetResourceDiff gets the diff for a specific resource
-func (e *TerraformExecutor) GetResourceDiff(resource *model.Resource) (string, error) {
+func (e *TerraformExecutor) GetResourceDiff(ctx context.Context, resource *model.Resource) (string, error) {
 	// Use terraform plan with -target to get the diff for a specific resource
 	// For Terraform 1.11.x, we use -target as separate arguments
-	args := []string{
-		"plan",
-		"-target",
-		resource.Address,
+	args := []string{"plan"}
+	switch {
+	case e.destroy:
+		args = append(args, "-destroy")
+	case resource.Action == model.ActionRefresh:
+		// Show what the refresh accepts into the state, not what undoes it
+		args = append(args, "-refresh-only")
 	}
-
-	// Add var-file if specified
-	if e.varFile != "" {
-		args = append(args, "-var-file", e.varFile)
+	args = append(args, "-target", resource.Address)
+	for _, address := range resource.Group {
+		args = append(args, "-target", address)
 	}
 
-	cmd := exec.Command(e.terraformPath, args...)
-	cmd.Dir = e.terraformDir
+	// Add the variables and extra plan arguments, as used for the plan itself
+	args = util.PlanArgs(args, e.inputs)
+
+	cmd := util.TerraformCommand(ctx, e.terraformPath, e.terraformDir, args...)
 
 	output, err := cmd.CombinedOutput()
 	if err != nil {
@@ -168,18 +357,19 @@ func (e *TerraformExecutor) GetResourceDiff(resource *model.Resource) (string, e
 }
 
 // ExecuteStepAction executes a step action on a resource
-func (e *TerraformExecutor) ExecuteStepAction(action model.StepAction, resource *model.Resource) error {
+func (e *TerraformExecutor) ExecuteStepAction(ctx context.Context, action model.StepAction,
+	resource *model.Resource) error {
 	switch action {
-	case model.StepApply:
+	case model.StepApply, model.StepRetry:
 		// Mark the resource as approved
 		resource.Status = model.StatusApproved
 		// Apply the resource
-		return e.ApplyResource(resource)
+		return e.ApplyResource(ctx, resource)
 
 	case model.StepSkip:
 		// Mark the resource as skipped
 		resource.Status = model.StatusSkipped
-		fmt.Printf("Skipping resource: %s\n", resource.Address)
+		fmt.Fprintf(e.stdout, "Skipping resource: %s\n", resource.Address)
 		return nil
 
 	case model.StepAbort:
@@ -188,14 +378,14 @@ func (e *TerraformExecutor) ExecuteStepAction(action model.StepAction, resource
 
 	case model.StepDetail:
 		// Show resource details
-		details, err := e.GetResourceDiff(resource)
+		details, err := e.GetResourceDiff(ctx, resource)
 		if err != nil {
 			return fmt.Errorf("failed to get resource details: %w", err)
 		}
-		fmt.Println("\nResource Details:")
-		fmt.Println(strings.Repeat("-", 80))
-		fmt.Println(details)
-		fmt.Println(strings.Repeat("-", 80))
+		fmt.Fprintln(e.stdout, "\nResource Details:")
+		fmt.Fprintln(e.stdout, strings.Repeat("-", 80))
+		fmt.Fprintln(e.stdout, details)
+		fmt.Fprintln(e.stdout, strings.Repeat("-", 80))
 		return nil
 
 	default:
@@ -0,0 +1,57 @@
+package executor
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/marc-poljak/terraform-step-debug/internal/util"
+)
+
+// OutputValue is the current value of a root module output
+type OutputValue struct {
+	Value     any  // The value, decoded from JSON
+	Sensitive bool // Whether the value is sensitive
+}
+
+// Outputs returns the root module outputs of the current state, as
+// written by 'terraform output -json'. Outputs that are not known yet
+// are missing from the result.
+func (e *TerraformExecutor) Outputs(ctx context.Context) (map[string]OutputValue, error) {
+	cmd := util.TerraformCommand(ctx, e.terraformPath, e.terraformDir, "output", "-json")
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		diagnostics := extractDiagnostics(stderr.String())
+		if diagnostics == "" {
+			diagnostics = err.Error()
+		}
+		return nil, fmt.Errorf("failed to read outputs: %s", diagnostics)
+	}
+	return ParseOutputs(stdout.Bytes())
+}
+
+// ParseOutputs reads the output values written by 'terraform output -json'
+func ParseOutputs(data []byte) (map[string]OutputValue, error) {
+	outputs := make(map[string]OutputValue)
+	if len(bytes.TrimSpace(data)) == 0 {
+		return outputs, nil
+	}
+
+	var values map[string]struct {
+		Value     any  `json:"value"`
+		Sensitive bool `json:"sensitive"`
+	}
+	if err := json.Unmarshal(data, &values); err != nil {
+		return nil, fmt.Errorf("failed to parse outputs: %w", err)
+	}
+
+	for name, value := range values {
+		outputs[name] = OutputValue{Value: value.Value, Sensitive: value.Sensitive}
+	}
+	return outputs, nil
+}
@@ -0,0 +1,91 @@
+package executor
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// RetryRule matches Terraform error diagnostics that are worth retrying
+type RetryRule struct {
+	Name    string         // Name shown in the run summary
+	Pattern *regexp.Regexp // Pattern matched against the error diagnostics
+}
+
+// builtinRetryRules are the transient errors known to resolve on their own
+var builtinRetryRules = map[string]string{
+	"throttling": `(?i)(throttl|rate exceeded|RequestLimitExceeded|TooManyRequests|too many requests|` +
+		`status code: 429|quota exceeded)`,
+	"eventual-consistency": `(?i)(not ?found|does not exist|NoSuch[A-Za-z]+|InvalidParameterValue.*not exist|` +
+		`propagat)`,
+	"state-lock": `(?i)(error acquiring the state lock|state (is )?locked|ConditionalCheckFailedException|` +
+		`lock timeout)`,
+}
+
+// BuiltinRetryRuleNames returns the names of the built-in retry rules
+func BuiltinRetryRuleNames() []string {
+	return []string{"throttling", "eventual-consistency", "state-lock"}
+}
+
+// DefaultRetryRuleNames returns the names of the built-in retry rules used
+// unless others are chosen. eventual-consistency is left out, since its
+// errors look the same as permanent ones, such as a misspelled name.
+func DefaultRetryRuleNames() []string {
+	return []string{"throttling", "state-lock"}
+}
+
+// NewRetryRule creates a retry rule from a regular expression
+func NewRetryRule(name, pattern string) (*RetryRule, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid retry pattern %q: %w", pattern, err)
+	}
+	return &RetryRule{Name: name, Pattern: re}, nil
+}
+
+// BuiltinRetryRule returns the built-in retry rule with the given name
+func BuiltinRetryRule(name string) (*RetryRule, error) {
+	pattern, ok := builtinRetryRules[strings.TrimSpace(name)]
+	if !ok {
+		return nil, fmt.Errorf("unknown retry rule %q (available: %s)",
+			name, strings.Join(BuiltinRetryRuleNames(), ", "))
+	}
+	return NewRetryRule(strings.TrimSpace(name), pattern)
+}
+
+// RetryPolicy decides whether and when a failed apply is attempted again
+type RetryPolicy struct {
+	MaxAttempts    int           // Maximum number of attempts, including the first
+	InitialBackoff time.Duration // Wait before the second attempt
+	MaxBackoff     time.Duration // Upper bound for the exponential backoff
+	Rules          []*RetryRule  // Errors that are retried
+}
+
+// Match returns the rule matching the diagnostics of a failed attempt,
+// or nil if the attempt should not be retried
+func (p *RetryPolicy) Match(attempt int, diagnostics string) *RetryRule {
+	if p == nil || attempt >= p.MaxAttempts {
+		return nil
+	}
+
+	for _, rule := range p.Rules {
+		if rule.Pattern.MatchString(diagnostics) {
+			return rule
+		}
+	}
+
+	return nil
+}
+
+// Backoff returns how long to wait after the given failed attempt
+func (p *RetryPolicy) Backoff(attempt int) time.Duration {
+	backoff := p.InitialBackoff
+	for i := 1; i < attempt && (p.MaxBackoff <= 0 || backoff < p.MaxBackoff); i++ {
+		backoff *= 2
+	}
+	if p.MaxBackoff > 0 && backoff > p.MaxBackoff {
+		return p.MaxBackoff
+	}
+	return backoff
+}
@@ -0,0 +1,104 @@
+package executor
+
+import (
+	"testing"
+	"time"
+)
+
+// retryRules returns the built-in retry rules with the given names
+func retryRules(t *testing.T, names ...string) []*RetryRule {
+	t.Helper()
+	var rules []*RetryRule
+	for _, name := range names {
+		rule, err := BuiltinRetryRule(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rules = append(rules, rule)
+	}
+	return rules
+}
+
+func TestRetryPolicyMatch(t *testing.T) {
+	defaults := DefaultRetryRuleNames()
+	custom, err := NewRetryRule("custom", `BucketAlreadyExists`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		output  string
+		attempt int
+		rules   []*RetryRule
+		want    string // Name of the matching rule, empty for no retry
+	}{
+		{name: "throttling", output: throttledOutput, attempt: 1, rules: retryRules(t, defaults...), want: "throttling"},
+		{name: "throttling without frames", output: plainOutput, attempt: 1, rules: retryRules(t, defaults...), want: "throttling"},
+		{name: "state lock", output: stateLockOutput, attempt: 2, rules: retryRules(t, defaults...), want: "state-lock"},
+		{name: "not retryable", output: conflictOutput, attempt: 1, rules: retryRules(t, defaults...)},
+		{name: "eventual consistency is opt-in", output: notFoundOutput, attempt: 1, rules: retryRules(t, defaults...)},
+		{name: "eventual consistency", output: notFoundOutput, attempt: 1, rules: retryRules(t, "eventual-consistency"), want: "eventual-consistency"},
+		{name: "custom rule", output: conflictOutput, attempt: 1, rules: append(retryRules(t, defaults...), custom), want: "custom"},
+		{name: "last attempt", output: throttledOutput, attempt: 3, rules: retryRules(t, defaults...)},
+		{name: "beyond the last attempt", output: throttledOutput, attempt: 4, rules: retryRules(t, defaults...)},
+		{name: "no rules", output: throttledOutput, attempt: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy := &RetryPolicy{MaxAttempts: 3, Rules: tt.rules}
+			got := ""
+			if rule := policy.Match(tt.attempt, extractDiagnostics(tt.output)); rule != nil {
+				got = rule.Name
+			}
+			if got != tt.want {
+				t.Errorf("Match = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	var policy *RetryPolicy
+	if rule := policy.Match(1, extractDiagnostics(throttledOutput)); rule != nil {
+		t.Errorf("Match without a policy = %q, want no retry", rule.Name)
+	}
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	tests := []struct {
+		name    string
+		initial time.Duration
+		max     time.Duration
+		attempt int
+		want    time.Duration
+	}{
+		{name: "first retry", initial: 5 * time.Second, max: 2 * time.Minute, attempt: 1, want: 5 * time.Second},
+		{name: "doubled", initial: 5 * time.Second, max: 2 * time.Minute, attempt: 3, want: 20 * time.Second},
+		{name: "clamped", initial: 5 * time.Second, max: 2 * time.Minute, attempt: 6, want: 2 * time.Minute},
+		{name: "many attempts", initial: 5 * time.Second, max: 2 * time.Minute, attempt: 100, want: 2 * time.Minute},
+		{name: "initial above the maximum", initial: 5 * time.Minute, max: 2 * time.Minute, attempt: 1, want: 2 * time.Minute},
+		{name: "no maximum", initial: time.Second, attempt: 11, want: 1024 * time.Second},
+		{name: "no backoff", max: time.Minute, attempt: 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy := &RetryPolicy{InitialBackoff: tt.initial, MaxBackoff: tt.max}
+			if got := policy.Backoff(tt.attempt); got != tt.want {
+				t.Errorf("Backoff(%d) = %s, want %s", tt.attempt, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuiltinRetryRule(t *testing.T) {
+	for _, name := range BuiltinRetryRuleNames() {
+		if _, err := BuiltinRetryRule(name); err != nil {
+			t.Errorf("BuiltinRetryRule(%q): %v", name, err)
+		}
+	}
+	if _, err := BuiltinRetryRule("network"); err == nil {
+		t.Error("BuiltinRetryRule(\"network\") succeeded, want an error")
+	}
+	if _, err := NewRetryRule("broken", "("); err == nil {
+		t.Error("NewRetryRule with an invalid pattern succeeded, want an error")
+	}
+}
@@ -0,0 +1,115 @@
+package executor
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sort"
+
+	"github.com/marc-poljak/terraform-step-debug/internal/model"
+	"github.com/marc-poljak/terraform-step-debug/internal/util"
+)
+
+// StaleCheckMode controls what happens when the plan no longer matches
+// the current state or configuration
+type StaleCheckMode string
+
+const (
+	StaleCheckOff   StaleCheckMode = "off"   // Do not check for a stale plan
+	StaleCheckWarn  StaleCheckMode = "warn"  // Warn and let the user decide
+	StaleCheckBlock StaleCheckMode = "block" // Do not apply until the plan is refreshed
+)
+
+// ParseStaleCheckMode validates a stale check mode given on the command line
+func ParseStaleCheckMode(mode string) (StaleCheckMode, error) {
+	switch StaleCheckMode(mode) {
+	case StaleCheckOff, StaleCheckWarn, StaleCheckBlock:
+		return StaleCheckMode(mode), nil
+	default:
+		return "", fmt.Errorf("invalid stale check mode %q (use off, warn or block)", mode)
+	}
+}
+
+// Baseline is the state and configuration the remaining steps were planned against
+type Baseline struct {
+	State        model.StateInfo   // State serial and lineage
+	ConfigHashes map[string]string // Checksums of the configuration files by path
+}
+
+// CaptureBaseline records the state the plan was made against. The state
+// recorded in the plan file is used when available, otherwise the current
+// state is pulled. configHashes should be taken before the plan was generated.
+func (e *TerraformExecutor) CaptureBaseline(ctx context.Context, plan *model.Plan,
+	configHashes map[string]string) (*Baseline, error) {
+	baseline := &Baseline{State: plan.PriorState, ConfigHashes: configHashes}
+	if baseline.State.Lineage != "" {
+		return baseline, nil
+	}
+
+	state, err := e.CurrentStateInfo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	baseline.State = state
+	return baseline, nil
+}
+
+// UpdateBaselineState records the state written by a step of this session,
+// so only changes made outside the session are reported as stale
+func (e *TerraformExecutor) UpdateBaselineState(ctx context.Context, baseline *Baseline) error {
+	state, err := e.CurrentStateInfo(ctx)
+	if err != nil {
+		return err
+	}
+	baseline.State = state
+	return nil
+}
+
+// CheckStaleness compares the current state and configuration files with the
+// baseline and returns the reasons why the plan is stale, if any
+func (e *TerraformExecutor) CheckStaleness(ctx context.Context, baseline *Baseline) ([]string, error) {
+	var reasons []string
+
+	state, err := e.CurrentStateInfo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case state.Lineage != baseline.State.Lineage:
+		reasons = append(reasons, fmt.Sprintf("state lineage changed from %q to %q",
+			baseline.State.Lineage, state.Lineage))
+	case state.Serial != baseline.State.Serial:
+		reasons = append(reasons, fmt.Sprintf("state serial changed from %d to %d outside this session",
+			baseline.State.Serial, state.Serial))
+	}
+
+	hashes, err := util.HashConfigFiles(e.terraformDir, e.inputs.VarFiles)
+	if err != nil {
+		return nil, err
+	}
+	reasons = append(reasons, compareConfigHashes(baseline.ConfigHashes, hashes)...)
+
+	return reasons, nil
+}
+
+// compareConfigHashes lists the configuration files that were changed, added or removed
+func compareConfigHashes(before, after map[string]string) []string {
+	var reasons []string
+	for path, hash := range after {
+		previous, ok := before[path]
+		switch {
+		case !ok:
+			reasons = append(reasons, fmt.Sprintf("configuration file %s was added", filepath.Base(path)))
+		case previous != hash:
+			reasons = append(reasons, fmt.Sprintf("configuration file %s was changed", filepath.Base(path)))
+		}
+	}
+	for path := range before {
+		if _, ok := after[path]; !ok {
+			reasons = append(reasons, fmt.Sprintf("configuration file %s was removed", filepath.Base(path)))
+		}
+	}
+
+	sort.Strings(reasons)
+	return reasons
+}
@@ -0,0 +1,346 @@
+package executor
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+
+	"github.com/marc-poljak/terraform-step-debug/internal/model"
+	"github.com/marc-poljak/terraform-step-debug/internal/util"
+)
+
+// PullState returns the current state as written by 'terraform state pull'.
+// The result is empty when no state exists yet.
+func (e *TerraformExecutor) PullState(ctx context.Context) ([]byte, error) {
+	cmd := util.TerraformCommand(ctx, e.terraformPath, e.terraformDir, "state", "pull")
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to pull state: %w", err)
+	}
+	return output, nil
+}
+
+// CurrentStateInfo returns the serial and lineage of the current state
+func (e *TerraformExecutor) CurrentStateInfo(ctx context.Context) (model.StateInfo, error) {
+	data, err := e.PullState(ctx)
+	if err != nil {
+		return model.StateInfo{}, err
+	}
+	return ParseStateInfo(data)
+}
+
+// ParseStateInfo reads the serial and lineage from a state file
+func ParseStateInfo(data []byte) (model.StateInfo, error) {
+	var info model.StateInfo
+	if len(data) == 0 {
+		return info, nil
+	}
+
+	var state struct {
+		Serial  int64  `json:"serial"`
+		Lineage string `json:"lineage"`
+	}
+	if err := json.Unmarshal(data, &state); err != nil {
+		return info, fmt.Errorf("failed to parse state: %w", err)
+	}
+
+	info.Serial = state.Serial
+	info.Lineage = state.Lineage
+	return info, nil
+}
+
+// ResourceState returns the attribute values of a resource in the current
+// state, and whether the resource exists in the state
+func (e *TerraformExecutor) ResourceState(ctx context.Context, address string) (map[string]any, bool, error) {
+	data, err := e.PullState(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+	return FindResourceState(data, address)
+}
+
+// FindResourceState looks up the attribute values of a resource instance in
+// a state file
+func FindResourceState(data []byte, address string) (map[string]any, bool, error) {
+	if len(data) == 0 {
+		return nil, false, nil
+	}
+
+	var state struct {
+		Resources []struct {
+			Module    string `json:"module"`
+			Mode      string `json:"mode"`
+			Type      string `json:"type"`
+			Name      string `json:"name"`
+			Instances []struct {
+				IndexKey   any            `json:"index_key"`
+				Attributes map[string]any `json:"attributes"`
+			} `json:"instances"`
+		} `json:"resources"`
+	}
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, false, fmt.Errorf("failed to parse state: %w", err)
+	}
+
+	for _, resource := range state.Resources {
+		for _, instance := range resource.Instances {
+			if instanceAddress(resource.Module, resource.Mode, resource.Type, resource.Name, instance.IndexKey) == address {
+				return instance.Attributes, true, nil
+			}
+		}
+	}
+
+	return nil, false, nil
+}
+
+// instanceAddress builds the address of a resource instance in a state file
+func instanceAddress(module, mode, resourceType, name string, indexKey any) string {
+	address := resourceType + "." + name
+	if mode == "data" {
+		address = "data." + address
+	}
+	if module != "" {
+		address = module + "." + address
+	}
+
+	switch key := indexKey.(type) {
+	case float64:
+		address += fmt.Sprintf("[%d]", int64(key))
+	case json.Number:
+		address += "[" + key.String() + "]"
+	case string:
+		address += "[" + quoteKey(key) + "]"
+	}
+	return address
+}
+
+// quoteKey quotes a for_each key the way Terraform writes it in addresses:
+// HCL string syntax, which unlike Go keeps printable non-ASCII characters
+// and doubles the $ and % of template sequences
+func quoteKey(key string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for i, r := range key {
+		switch r {
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\t':
+			b.WriteString(`\t`)
+		case '"':
+			b.WriteString(`\"`)
+		case '\\':
+			b.WriteString(`\\`)
+		case '$', '%':
+			b.WriteRune(r)
+			if strings.HasPrefix(key[i+1:], "{") {
+				b.WriteRune(r)
+			}
+		default:
+			switch {
+			case unicode.IsPrint(r):
+				b.WriteRune(r)
+			case r < 0x10000:
+				fmt.Fprintf(&b, "\\u%04x", r)
+			default:
+				fmt.Fprintf(&b, "\\U%08x", r)
+			}
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+// restoreState puts back the state of a resource recorded before it was
+// applied, and pushes the result as the new state
+func (e *TerraformExecutor) restoreState(ctx context.Context, resource *model.Resource) error {
+	fmt.Fprintf(e.stdout, "Restoring the state of %s recorded before the step\n", resource.Address)
+
+	current, err := e.PullState(ctx)
+	if err != nil {
+		return err
+	}
+	restored, err := RestoreResourceState(current, resource.PriorState, resource.Address)
+	if err != nil {
+		return fmt.Errorf("failed to restore the state of %s: %w", resource.Address, err)
+	}
+
+	return e.PushState(ctx, restored)
+}
+
+// RestoreResourceState replaces a resource instance in the current state
+// with the instance from a backup of the same state, leaving everything else
+// as it is. The serial is increased so that the result can be pushed.
+func RestoreResourceState(current, backup []byte, address string) ([]byte, error) {
+	if len(backup) == 0 {
+		return nil, fmt.Errorf("no state was recorded before the step")
+	}
+	currentState, err := decodeState(current)
+	if err != nil {
+		return nil, err
+	}
+	backupState, err := decodeState(backup)
+	if err != nil {
+		return nil, err
+	}
+	if currentState["lineage"] != backupState["lineage"] {
+		return nil, fmt.Errorf("the state lineage changed since the step")
+	}
+
+	block, index := findStateInstance(backupState, address)
+	if index < 0 {
+		return nil, fmt.Errorf("the resource did not exist before the step")
+	}
+	instance := block["instances"].([]any)[index]
+
+	// Replace the instance in the current state, or add it back
+	currentBlock, currentIndex := findStateInstance(currentState, address)
+	switch {
+	case currentIndex >= 0:
+		currentBlock["instances"].([]any)[currentIndex] = instance
+	case currentBlock != nil:
+		currentBlock["instances"] = append(currentBlock["instances"].([]any), instance)
+	default:
+		restoredBlock := make(map[string]any, len(block))
+		for key, value := range block {
+			restoredBlock[key] = value
+		}
+		restoredBlock["instances"] = []any{instance}
+		resources, _ := currentState["resources"].([]any)
+		currentState["resources"] = append(resources, restoredBlock)
+	}
+
+	serial, err := currentState["serial"].(json.Number).Int64()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse state serial: %w", err)
+	}
+	currentState["serial"] = serial + 1
+
+	return json.MarshalIndent(currentState, "", "  ")
+}
+
+// decodeState parses a state file, keeping numbers as they are written
+func decodeState(data []byte) (map[string]any, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var state map[string]any
+	if err := decoder.Decode(&state); err != nil {
+		return nil, fmt.Errorf("failed to parse state: %w", err)
+	}
+	if _, ok := state["serial"].(json.Number); !ok {
+		return nil, fmt.Errorf("failed to parse state: no serial")
+	}
+	return state, nil
+}
+
+// StateInstances returns the attribute values of every resource instance in
+// a state file, by instance address
+func StateInstances(data []byte) (map[string]map[string]any, error) {
+	instances := make(map[string]map[string]any)
+	if len(data) == 0 {
+		return instances, nil
+	}
+	state, err := decodeState(data)
+	if err != nil {
+		return nil, err
+	}
+
+	resources, _ := state["resources"].([]any)
+	for _, item := range resources {
+		block, _ := item.(map[string]any)
+		module, _ := block["module"].(string)
+		mode, _ := block["mode"].(string)
+		resourceType, _ := block["type"].(string)
+		name, _ := block["name"].(string)
+		items, _ := block["instances"].([]any)
+		for _, instance := range items {
+			values, _ := instance.(map[string]any)
+			attributes, _ := values["attributes"].(map[string]any)
+			instances[instanceAddress(module, mode, resourceType, name, values["index_key"])] = attributes
+		}
+	}
+	return instances, nil
+}
+
+// ReplaceState prepares a backup of the current state to be pushed in its
+// place. The backup must have the same lineage, and gets the serial after
+// the current one, so that Terraform accepts it as the newer state.
+func ReplaceState(current, backup []byte) ([]byte, error) {
+	currentState, err := decodeState(current)
+	if err != nil {
+		return nil, err
+	}
+	backupState, err := decodeState(backup)
+	if err != nil {
+		return nil, err
+	}
+	if currentState["lineage"] != backupState["lineage"] {
+		return nil, fmt.Errorf("the state lineage differs from the current state (%v instead of %v)",
+			backupState["lineage"], currentState["lineage"])
+	}
+
+	serial, err := currentState["serial"].(json.Number).Int64()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse state serial: %w", err)
+	}
+	backupState["serial"] = serial + 1
+
+	return json.MarshalIndent(backupState, "", "  ")
+}
+
+// PushState writes the data as the new state with 'terraform state push'.
+// Terraform refuses states with another lineage or an older serial.
+func (e *TerraformExecutor) PushState(ctx context.Context, data []byte) error {
+	var stderr bytes.Buffer
+	cmd := util.TerraformCommand(ctx, e.terraformPath, e.terraformDir, "state", "push", "-")
+	cmd.Stdin = bytes.NewReader(data)
+	cmd.Stdout = e.stdout
+	cmd.Stderr = io.MultiWriter(e.stderr, &stderr)
+	if err := cmd.Run(); err != nil {
+		if diagnostics := extractDiagnostics(stderr.String()); diagnostics != "" {
+			return fmt.Errorf("failed to push state: %s", diagnostics)
+		}
+		return fmt.Errorf("failed to push state: %w", err)
+	}
+	return nil
+}
+
+// findStateInstance returns the resource block of a parsed state that the
+// address belongs to, and the index of the instance with that address, or
+// -1 when the block has no such instance
+func findStateInstance(state map[string]any, address string) (map[string]any, int) {
+	resources, _ := state["resources"].([]any)
+	for _, item := range resources {
+		block, ok := item.(map[string]any)
+		if !ok {
+			continue
+		}
+		module, _ := block["module"].(string)
+		mode, _ := block["mode"].(string)
+		resourceType, _ := block["type"].(string)
+		name, _ := block["name"].(string)
+		base := instanceAddress(module, mode, resourceType, name, nil)
+		if address != base && !strings.HasPrefix(address, base+"[") {
+			continue
+		}
+
+		instances, ok := block["instances"].([]any)
+		if !ok {
+			block["instances"] = []any{}
+		}
+		for i, instance := range instances {
+			values, _ := instance.(map[string]any)
+			if instanceAddress(module, mode, resourceType, name, values["index_key"]) == address {
+				return block, i
+			}
+		}
+		return block, -1
+	}
+	return nil, -1
+}
@@ -0,0 +1,254 @@
+package executor
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// testState is a state with a counted resource, a for_each resource in a
+// module instance and a data source
+const testState = `{
+  "version": 4,
+  "serial": 41,
+  "lineage": "lineage-1",
+  "resources": [
+    {
+      "mode": "managed",
+      "type": "aws_instance",
+      "name": "web",
+      "instances": [
+        {"index_key": 0, "attributes": {"id": "i-0"}},
+        {"index_key": 1, "attributes": {"id": "i-1"}}
+      ]
+    },
+    {
+      "module": "module.app[\"eu\"]",
+      "mode": "managed",
+      "type": "aws_s3_bucket",
+      "name": "logs",
+      "instances": [
+        {"index_key": "münchen", "attributes": {"id": "logs-muc"}}
+      ]
+    },
+    {
+      "mode": "data",
+      "type": "aws_ami",
+      "name": "ubuntu",
+      "instances": [
+        {"attributes": {"id": "ami-1"}}
+      ]
+    }
+  ]
+}`
+
+// editState returns testState with its serial, lineage and resource
+// attributes changed, for use as the current state or a backup
+func editState(t *testing.T, serial int, lineage string, replacements ...string) []byte {
+	t.Helper()
+	state := strings.Replace(testState, `"serial": 41`, `"serial": `+strconv.Itoa(serial), 1)
+	state = strings.Replace(state, "lineage-1", lineage, 1)
+	return []byte(strings.NewReplacer(replacements...).Replace(state))
+}
+
+func TestInstanceAddress(t *testing.T) {
+	tests := []struct {
+		name     string
+		module   string
+		mode     string
+		indexKey any
+		want     string
+	}{
+		{name: "single instance", mode: "managed", want: "aws_instance.web"},
+		{name: "count", mode: "managed", indexKey: float64(2), want: "aws_instance.web[2]"},
+		{name: "count as number", mode: "managed", indexKey: json.Number("3"), want: "aws_instance.web[3]"},
+		{name: "for_each", mode: "managed", indexKey: "a", want: `aws_instance.web["a"]`},
+		{name: "non-ASCII key", mode: "managed", indexKey: "münchen", want: `aws_instance.web["münchen"]`},
+		{name: "escaped key", mode: "managed", indexKey: "a\"b\\c\nd", want: `aws_instance.web["a\"b\\c\nd"]`},
+		{name: "template sequences", mode: "managed", indexKey: "${x}%{y}$z", want: `aws_instance.web["$${x}%%{y}$z"]`},
+		{name: "non-printable key", mode: "managed", indexKey: "a\u200bb", want: `aws_instance.web["a\u200bb"]`},
+		{name: "data source", mode: "data", want: "data.aws_instance.web"},
+		{name: "module", module: "module.app", mode: "managed", indexKey: float64(0), want: "module.app.aws_instance.web[0]"},
+		{name: "module instance", module: `module.app["eu"].module.db[1]`, mode: "data", want: `module.app["eu"].module.db[1].data.aws_instance.web`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := instanceAddress(tt.module, tt.mode, "aws_instance", "web", tt.indexKey); got != tt.want {
+				t.Errorf("instanceAddress = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFindStateInstance(t *testing.T) {
+	tests := []struct {
+		address string
+		block   string // Name of the resource block found, empty for none
+		index   int
+	}{
+		{"aws_instance.web[1]", "web", 1},
+		{"aws_instance.web[0]", "web", 0},
+		{"aws_instance.web[2]", "web", -1},
+		{`module.app["eu"].aws_s3_bucket.logs["münchen"]`, "logs", 0},
+		{`module.app["us"].aws_s3_bucket.logs["münchen"]`, "", -1},
+		{"data.aws_ami.ubuntu", "ubuntu", 0},
+		{"aws_ami.ubuntu", "", -1},
+		{"aws_instance.web_backup[0]", "", -1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.address, func(t *testing.T) {
+			state, err := decodeState([]byte(testState))
+			if err != nil {
+				t.Fatal(err)
+			}
+			block, index := findStateInstance(state, tt.address)
+			name := ""
+			if block != nil {
+				name, _ = block["name"].(string)
+			}
+			if name != tt.block || index != tt.index {
+				t.Errorf("findStateInstance = %q %d, want %q %d", name, index, tt.block, tt.index)
+			}
+		})
+	}
+}
+
+func TestRestoreResourceState(t *testing.T) {
+	backup := []byte(testState)
+
+	tests := []struct {
+		name    string
+		current []byte
+		backup  []byte
+		address string
+		wantErr string
+		want    map[string]string // Expected id of each instance after the restore
+	}{
+		{
+			name:    "changed instance",
+			current: editState(t, 45, "lineage-1", `"i-1"`, `"i-1-changed"`, `"logs-muc"`, `"logs-changed"`),
+			backup:  backup,
+			address: "aws_instance.web[1]",
+			want:    map[string]string{"aws_instance.web[0]": "i-0", "aws_instance.web[1]": "i-1", `module.app["eu"].aws_s3_bucket.logs["münchen"]`: "logs-changed"},
+		},
+		{
+			name:    "for_each instance in a module",
+			current: editState(t, 45, "lineage-1", `"logs-muc"`, `"logs-changed"`),
+			backup:  backup,
+			address: `module.app["eu"].aws_s3_bucket.logs["münchen"]`,
+			want:    map[string]string{`module.app["eu"].aws_s3_bucket.logs["münchen"]`: "logs-muc"},
+		},
+		{
+			name:    "deleted instance",
+			current: editState(t, 45, "lineage-1", `{"index_key": 1, "attributes": {"id": "i-1"}}`, `{"index_key": 5, "attributes": {"id": "i-5"}}`),
+			backup:  backup,
+			address: "aws_instance.web[1]",
+			want:    map[string]string{"aws_instance.web[1]": "i-1", "aws_instance.web[5]": "i-5"},
+		},
+		{
+			name:    "deleted resource",
+			current: []byte(`{"version": 4, "serial": 45, "lineage": "lineage-1", "resources": []}`),
+			backup:  backup,
+			address: "data.aws_ami.ubuntu",
+			want:    map[string]string{"data.aws_ami.ubuntu": "ami-1", "aws_instance.web[0]": ""},
+		},
+		{
+			name:    "missing from the backup",
+			current: editState(t, 45, "lineage-1"),
+			backup:  backup,
+			address: "aws_instance.web[7]",
+			wantErr: "did not exist before the step",
+		},
+		{
+			name:    "lineage mismatch",
+			current: editState(t, 45, "lineage-2"),
+			backup:  backup,
+			address: "aws_instance.web[1]",
+			wantErr: "lineage changed",
+		},
+		{
+			name:    "no backup",
+			current: editState(t, 45, "lineage-1"),
+			address: "aws_instance.web[1]",
+			wantErr: "no state was recorded",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			restored, err := RestoreResourceState(tt.current, tt.backup, tt.address)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("RestoreResourceState error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("RestoreResourceState: %v", err)
+			}
+
+			info, err := ParseStateInfo(restored)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info.Serial != 46 || info.Lineage != "lineage-1" {
+				t.Errorf("serial and lineage = %d %s, want 46 lineage-1", info.Serial, info.Lineage)
+			}
+			instances, err := StateInstances(restored)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for address, id := range tt.want {
+				got, _ := instances[address]["id"].(string)
+				if got != id {
+					t.Errorf("%s id = %q, want %q", address, got, id)
+				}
+			}
+		})
+	}
+}
+
+func TestReplaceState(t *testing.T) {
+	tests := []struct {
+		name       string
+		current    []byte
+		backup     []byte
+		wantErr    string
+		wantSerial int64
+	}{
+		{name: "newer current state", current: editState(t, 45, "lineage-1"), backup: []byte(testState), wantSerial: 46},
+		{name: "same serial", current: []byte(testState), backup: []byte(testState), wantSerial: 42},
+		{name: "lineage mismatch", current: editState(t, 45, "lineage-2"), backup: []byte(testState), wantErr: "lineage differs"},
+		{name: "invalid backup", current: []byte(testState), backup: []byte(`{"lineage": "lineage-1"}`), wantErr: "no serial"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			replaced, err := ReplaceState(tt.current, tt.backup)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("ReplaceState error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ReplaceState: %v", err)
+			}
+
+			info, err := ParseStateInfo(replaced)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info.Serial != tt.wantSerial {
+				t.Errorf("serial = %d, want %d", info.Serial, tt.wantSerial)
+			}
+			// The resources are those of the backup
+			instances, err := StateInstances(replaced)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, _ := instances["aws_instance.web[1]"]["id"].(string); got != "i-1" {
+				t.Errorf("aws_instance.web[1] id = %q, want i-1", got)
+			}
+		})
+	}
+}
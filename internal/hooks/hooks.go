@@ -0,0 +1,245 @@
+// Package hooks runs user-defined checks before and after apply steps. A
+// hook is a shell command or a Go plugin, selected by resource address
+// pattern and action, that receives the resource as JSON on standard input.
+package hooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/marc-poljak/terraform-step-debug/internal/model"
+	"github.com/marc-poljak/terraform-step-debug/internal/util"
+)
+
+// Phase tells whether a hook runs before or after a step
+type Phase string
+
+const (
+	PhasePre  Phase = "pre"  // Before the apply; a failure blocks the apply
+	PhasePost Phase = "post" // After a successful apply; a failure marks the resource failed
+)
+
+// defaultTimeout limits hooks that do not set a timeout
+const defaultTimeout = 5 * time.Minute
+
+// Hook is a shell command or Go plugin run before or after matching steps
+type Hook struct {
+	Name    string         // Name shown in messages, defaults to the command or plugin
+	Phase   Phase          // When the hook runs
+	Match   []string       // Address patterns with * and ?, empty to match every resource
+	Actions []model.Action // Resource actions, empty to match every action
+	Command string         // Shell command line, run in the Terraform directory
+	Plugin  string         // Path to a Go plugin exporting a Hook function
+	Timeout time.Duration  // Maximum duration of a single run
+
+	run PluginFunc // Loaded plugin function
+}
+
+// PluginFunc is the signature of the Hook symbol a Go plugin exports. It
+// receives the same JSON input as shell hooks and fails the hook with an error.
+type PluginFunc func(ctx context.Context, input []byte) error
+
+// Input is the JSON document a hook receives on standard input
+type Input struct {
+	Phase   Phase                `json:"phase"`
+	Address string               `json:"address"`
+	Type    string               `json:"type"`
+	Action  model.Action         `json:"action"`
+	Status  model.ResourceStatus `json:"status"`
+	Before  map[string]any       `json:"before"`            // Values before the change
+	Planned map[string]any       `json:"planned"`           // Planned values, without those known after apply
+	Applied map[string]any       `json:"applied,omitempty"` // Values in the state after the apply, for post hooks
+}
+
+// hookFile is the format of a hooks file
+type hookFile struct {
+	Hooks []struct {
+		Name    string   `json:"name"`
+		Phase   Phase    `json:"phase"`
+		Match   []string `json:"match"`
+		Actions []string `json:"actions"`
+		Command string   `json:"command"`
+		Plugin  string   `json:"plugin"`
+		Timeout string   `json:"timeout"`
+	} `json:"hooks"`
+}
+
+// Load reads the hooks defined in a JSON file and loads their plugins.
+// Relative plugin paths are resolved against the directory of the file.
+func Load(file string) ([]*Hook, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read hooks: %w", err)
+	}
+
+	var config hookFile
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("failed to parse hooks file %s: %w", file, err)
+	}
+
+	hooks := make([]*Hook, 0, len(config.Hooks))
+	for i, entry := range config.Hooks {
+		hook := &Hook{
+			Name:    entry.Name,
+			Phase:   entry.Phase,
+			Match:   entry.Match,
+			Command: entry.Command,
+			Plugin:  entry.Plugin,
+			Timeout: defaultTimeout,
+		}
+		for _, action := range entry.Actions {
+			hook.Actions = append(hook.Actions, model.Action(action))
+		}
+		if entry.Timeout != "" {
+			if hook.Timeout, err = time.ParseDuration(entry.Timeout); err != nil {
+				return nil, fmt.Errorf("hook %d: invalid timeout %q", i+1, entry.Timeout)
+			}
+		}
+		if hook.Plugin != "" && !filepath.IsAbs(hook.Plugin) {
+			hook.Plugin = filepath.Join(filepath.Dir(file), hook.Plugin)
+		}
+
+		if err := hook.validate(); err != nil {
+			return nil, fmt.Errorf("hook %d: %w", i+1, err)
+		}
+		if hook.Plugin != "" {
+			if hook.run, err = loadPlugin(hook.Plugin); err != nil {
+				return nil, fmt.Errorf("hook %d: %w", i+1, err)
+			}
+		}
+		hooks = append(hooks, hook)
+	}
+
+	return hooks, nil
+}
+
+// validate checks that the hook is complete
+func (h *Hook) validate() error {
+	if h.Phase != PhasePre && h.Phase != PhasePost {
+		return fmt.Errorf("phase must be %q or %q, not %q", PhasePre, PhasePost, h.Phase)
+	}
+	if (h.Command == "") == (h.Plugin == "") {
+		return errors.New("exactly one of command and plugin must be set")
+	}
+	for _, pattern := range h.Match {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid address pattern %q", pattern)
+		}
+	}
+	return nil
+}
+
+// String returns the name of the hook
+func (h *Hook) String() string {
+	switch {
+	case h.Name != "":
+		return h.Name
+	case h.Command != "":
+		return h.Command
+	default:
+		return filepath.Base(h.Plugin)
+	}
+}
+
+// Matches reports whether the hook runs in the phase for the resource
+func (h *Hook) Matches(phase Phase, resource *model.Resource) bool {
+	if h.Phase != phase {
+		return false
+	}
+
+	if len(h.Actions) > 0 {
+		found := false
+		for _, action := range h.Actions {
+			if action == resource.Action {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	if len(h.Match) == 0 {
+		return true
+	}
+	for _, pattern := range h.Match {
+		if matched, _ := path.Match(pattern, resource.Address); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// Run runs the hook with the input. The output of shell commands is written
+// to stdout and stderr; a failure includes the last lines of error output.
+func (h *Hook) Run(ctx context.Context, dir string, input Input, stdout, stderr io.Writer) error {
+	data, err := json.Marshal(input)
+	if err != nil {
+		return fmt.Errorf("failed to encode the input of hook %s: %w", h, err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, h.Timeout)
+	defer cancel()
+
+	if h.run != nil {
+		err = h.run(ctx, data)
+	} else {
+		err = h.runCommand(ctx, dir, input, data, stdout, stderr)
+	}
+
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		return fmt.Errorf("%s hook %s timed out after %s", h.Phase, h, h.Timeout)
+	default:
+		return fmt.Errorf("%s hook %s failed: %w", h.Phase, h, err)
+	}
+}
+
+// runCommand runs a shell hook with the input on standard input and the
+// address, action and phase in the environment
+func (h *Hook) runCommand(ctx context.Context, dir string, input Input, data []byte, stdout, stderr io.Writer) error {
+	var errorOutput bytes.Buffer
+	cmd := util.ShellCommand(ctx, dir, h.Command)
+	cmd.Stdin = bytes.NewReader(data)
+	cmd.Stdout = stdout
+	cmd.Stderr = io.MultiWriter(stderr, &errorOutput)
+	cmd.Env = append(os.Environ(),
+		"TSD_HOOK_PHASE="+string(input.Phase),
+		"TSD_ADDRESS="+input.Address,
+		"TSD_ACTION="+string(input.Action),
+	)
+
+	err := cmd.Run()
+	if err != nil {
+		if lines := lastLines(errorOutput.String(), 3); lines != "" {
+			return fmt.Errorf("%w: %s", err, lines)
+		}
+	}
+	return err
+}
+
+// lastLines returns the last non-empty lines of the text, joined with "; "
+func lastLines(text string, count int) string {
+	var lines []string
+	for _, line := range strings.Split(text, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	if len(lines) > count {
+		lines = lines[len(lines)-count:]
+	}
+	return strings.Join(lines, "; ")
+}
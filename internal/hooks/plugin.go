@@ -0,0 +1,34 @@
+package hooks
+
+import (
+	"context"
+	"fmt"
+	"plugin"
+)
+
+// loadPlugin opens a Go plugin and looks up its Hook function, declared as
+//
+//	func Hook(ctx context.Context, input []byte) error
+//
+// Plugins must be built with 'go build -buildmode=plugin' by the same Go
+// version as this tool, and are only supported on Linux and macOS.
+func loadPlugin(path string) (PluginFunc, error) {
+	p, err := plugin.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open plugin: %w", err)
+	}
+
+	symbol, err := p.Lookup("Hook")
+	if err != nil {
+		return nil, fmt.Errorf("plugin %s: %w", path, err)
+	}
+
+	switch hook := symbol.(type) {
+	case func(context.Context, []byte) error:
+		return hook, nil
+	case *func(context.Context, []byte) error:
+		return *hook, nil
+	default:
+		return nil, fmt.Errorf("plugin %s: Hook must be a func(context.Context, []byte) error, not %T", path, symbol)
+	}
+}
@@ -1,29 +1,80 @@
 package model
 
+import (
+	"strings"
+	"time"
+)
+
 // Resource represents a single Terraform resource operation
 // (create, update, delete) from the plan
 type Resource struct {
-	Address      string         // The resource address (e.g., aws_instance.example)
-	Type         string         // Resource type (e.g., aws_instance)
-	Name         string         // Resource name (e.g., example)
-	Action       Action         // The action (create, update, delete)
-	Dependencies []string       // List of resource addresses this resource depends on
-	Attributes   map[string]any // The resource attributes
-	Status       ResourceStatus // Current status of the resource during execution
-	Warnings     []string       // Any warnings associated with this resource
+	Address         string         // The resource address (e.g., aws_instance.example)
+	Type            string         // Resource type (e.g., aws_instance)
+	Name            string         // Resource name (e.g., example)
+	Action          Action         // The action (create, update, delete)
+	Dependencies    []string       // List of resource addresses this resource depends on
+	Attributes      map[string]any // The resource attributes
+	Before          map[string]any // Attribute values before the change (nil for creates)
+	After           map[string]any // Attribute values after the change (nil for deletes)
+	Status          ResourceStatus // Current status of the resource during execution
+	Warnings        []string       // Any warnings associated with this resource
+	Attempts        []Attempt      // Apply attempts made for this resource
+	Breakpoint      bool           // Whether continuing stops at this resource
+	Outputs         []string       // Names of the root module outputs that refer to this resource
+	Checks          []*Check       // Check blocks and conditions that refer to this resource
+	PreventDestroy  bool           // Whether the configuration sets lifecycle prevent_destroy
+	Protected       string         // Why deleting or replacing requires typing the address, if protected
+	Blocked         string         // Why the resource can never be applied through this tool, if blocked
+	ReplacePaths    []string       // Attribute paths whose change forces the replacement
+	Risk            int            // Risk score from 0 to 100
+	RiskReasons     []string       // What contributes to the risk score
+	PriorState      []byte         // State pulled before the resource was applied, for rollbacks
+	ImportID        string         // ID of the existing object to import, for imports
+	PreviousAddress string         // Address the object is moved from, for moves
+	FollowUp        Action         // Change applied after the state-only step, if any
+	ReadReason      string         // Why a data source is read during apply, for reads
+	UnknownInputs   []string       // Arguments of a data source that are only known after apply
+	ReadTriggers    []string       // Changing resources a data source read waits for
+	Drift           *Drift         // Changes made outside Terraform since the last apply, if any
+	DriftCaused     bool           // Whether the planned change only undoes the drift
+	Group           []string       // Dependents destroyed together with the resource, in a teardown
+}
+
+// Attempt records a single try at applying a resource
+type Attempt struct {
+	Number    int           // Attempt number, starting at 1
+	Duration  time.Duration // How long the attempt took
+	Error     string        // Error diagnostics of a failed attempt, empty on success
+	RetryRule string        // Name of the retry rule that matched the error, if retried
 }
 
 // Action represents the type of operation to be performed on a resource
 type Action string
 
 const (
-	ActionCreate Action = "create"
-	ActionUpdate Action = "update"
-	ActionDelete Action = "delete"
-	ActionRead   Action = "read"
-	ActionNoop   Action = "no-op"
+	ActionCreate  Action = "create"
+	ActionUpdate  Action = "update"
+	ActionDelete  Action = "delete"
+	ActionReplace Action = "replace" // Delete and create, in either order
+	ActionRead    Action = "read"
+	ActionNoop    Action = "no-op"
+	ActionRestore Action = "restore" // Put back the state recorded before a step, when rolling back
+	ActionImport  Action = "import"  // Bring an existing object under management
+	ActionMove    Action = "move"    // Change the address of an object in the state
+	ActionForget  Action = "forget"  // Remove an object from the state without destroying it
+	ActionRefresh Action = "refresh" // Accept the changes made outside Terraform into the state
 )
 
+// Destructive reports whether the action deletes an existing object
+func (a Action) Destructive() bool {
+	return a == ActionDelete || a == ActionReplace
+}
+
+// StateOnly reports whether the action changes the state but no infrastructure
+func (a Action) StateOnly() bool {
+	return a == ActionImport || a == ActionMove || a == ActionForget || a == ActionRestore || a == ActionRefresh
+}
+
 // ResourceStatus represents the current status of a resource in the execution process
 type ResourceStatus string
 
@@ -33,6 +84,8 @@ const (
 	StatusSkipped  ResourceStatus = "skipped"
 	StatusFailed   ResourceStatus = "failed"
 	StatusComplete ResourceStatus = "complete"
+	StatusCanceled ResourceStatus = "canceled"
+	StatusTimeout  ResourceStatus = "timed-out"
 )
 
 // Plan represents a parsed Terraform plan
@@ -43,14 +96,117 @@ type Plan struct {
 	TerraformDir string               // Path to the Terraform directory
 	HasChanges   bool                 // Whether the plan has any changes
 	Stats        PlanStats            // Statistics about the plan
+	Variables    map[string]any       // Input variable values recorded in the plan
+	Workspace    string               // Terraform workspace the plan runs against
+	Backend      string               // Backend type storing the state (e.g., s3, local)
+	PriorState   StateInfo            // State the plan was made against, if recorded in the plan file
+	Outputs      []*OutputChange      // Planned changes to root module outputs, by name
+	Checks       []*Check             // Check blocks and conditions, with their latest results
+	Deferred     []*DeferredChange    // Changes Terraform postponed to a later plan
+	Drift        []*Drift             // Resources changed outside Terraform, found by the refresh
+	Mode         PlanMode             // Kind of plan, normal unless set otherwise
+}
+
+// PlanMode is the kind of plan a session steps through
+type PlanMode string
+
+const (
+	ModeNormal      PlanMode = "normal"       // Changes to reach the configuration
+	ModeRefreshOnly PlanMode = "refresh-only" // State updates for changes made outside Terraform
+	ModeDestroy     PlanMode = "destroy"      // Deletion of every managed resource
+)
+
+// Drift is a change made to a resource outside Terraform, found when the
+// state was refreshed for the plan
+type Drift struct {
+	Address    string         // The resource address
+	Action     Action         // Update, or delete when the object is gone
+	Attributes []string       // Top-level attributes that changed, for updates
+	Before     map[string]any // Values recorded in the state
+	After      map[string]any // Values found by the refresh (nil when deleted)
+}
+
+// DeferredChange is a change that Terraform could not plan yet, and left
+// for a later plan and apply
+type DeferredChange struct {
+	Address string // The resource address
+	Action  Action // The action as far as it is known
+	Reason  string // Why the change is deferred, as reported by Terraform
+}
+
+// OutputChange is a planned change to a root module output
+type OutputChange struct {
+	Name       string   // Output name
+	Action     Action   // The action (create, update, delete, no-op)
+	Before     any      // Value before the change (nil for creates)
+	After      any      // Planned value, nil if it is only known after apply
+	Unknown    bool     // Whether the value is only known after apply
+	Sensitive  bool     // Whether the value is sensitive
+	References []string // Addresses of the resources the output refers to
+}
+
+// StateInfo identifies a version of the Terraform state
+type StateInfo struct {
+	Serial  int64  // Incremented on every state write
+	Lineage string // Unique ID of the state, set when it is first created
+}
+
+// PlanDiff describes how re-planning changed the steps that were still pending
+type PlanDiff struct {
+	Added   []*Resource       // Steps that were not pending before
+	Removed []*Resource       // Pending steps that are no longer in the plan
+	Changed []*ResourceChange // Pending steps whose planned change is different
+}
+
+// ResourceChange pairs a pending resource with its counterpart in a fresh plan
+type ResourceChange struct {
+	Previous *Resource // The resource in the previous plan
+	Current  *Resource // The resource in the fresh plan
+}
+
+// CheckStatus is the result of a check block or of the conditions of a resource or output
+type CheckStatus string
+
+const (
+	CheckPass    CheckStatus = "pass"
+	CheckFail    CheckStatus = "fail"
+	CheckError   CheckStatus = "error"
+	CheckUnknown CheckStatus = "unknown"
+)
+
+// Check is a check block, or the preconditions and postconditions of a
+// resource or output, with its latest result
+type Check struct {
+	Address   string      // Address of the checked object, e.g. check.health or aws_instance.web[0]
+	Kind      string      // Kind of object: resource, output_value or check
+	Status    CheckStatus // Latest result
+	Problems  []string    // Error messages of the failed conditions
+	Resources []string    // Addresses of the resources the check refers to
+}
+
+// Inputs holds the variables and extra arguments passed to every Terraform
+// plan and apply, so that all steps see the same configuration
+type Inputs struct {
+	VarFiles  []string // Variable files passed with -var-file, in order
+	Vars      []string // Variables passed with -var as name=value
+	TFArgs    []string // Extra arguments shared by plan and apply commands
+	PlanArgs  []string // Extra arguments for plan commands (plan generation and diffs)
+	ApplyArgs []string // Extra arguments for apply commands
+	NoColor   bool     // Pass -no-color to every Terraform command that prints output
 }
 
 // PlanStats contains statistics about a plan
 type PlanStats struct {
-	Create int // Number of resources to create
-	Update int // Number of resources to update
-	Delete int // Number of resources to delete
-	Noop   int // Number of resources with no changes
+	Create  int // Number of resources to create
+	Update  int // Number of resources to update
+	Delete  int // Number of resources to delete
+	Replace int // Number of resources to replace
+	Noop    int // Number of resources with no changes
+	Import  int // Number of resources to import
+	Move    int // Number of resources moved to another address
+	Forget  int // Number of resources removed from the state only
+	Read    int // Number of data sources read during apply
+	Refresh int // Number of drifted resources whose state is refreshed only
 }
 
 // NewPlan creates a new empty Plan
@@ -62,7 +218,45 @@ func NewPlan(planFile, terraformDir string) *Plan {
 		TerraformDir: terraformDir,
 		HasChanges:   false,
 		Stats:        PlanStats{},
+		Variables:    make(map[string]any),
+		Mode:         ModeNormal,
+	}
+}
+
+// DependsOn reports whether the resource refers to the address directly.
+// Dependencies may name an attribute or all instances of the resource.
+func (r *Resource) DependsOn(address string) bool {
+	base := address
+	if i := strings.LastIndex(address, "["); i > 0 && strings.HasSuffix(address, "]") {
+		base = address[:i]
+	}
+	for _, dep := range r.Dependencies {
+		if dep == address || dep == base || strings.HasPrefix(dep, address+".") || strings.HasPrefix(dep, address+"[") ||
+			strings.HasPrefix(dep, base+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// Dependents returns the resources of the plan that depend on the resource,
+// directly or through other resources, in breadth-first order
+func (p *Plan) Dependents(resource *Resource) []*Resource {
+	var dependents []*Resource
+	seen := map[*Resource]bool{resource: true}
+	queue := []*Resource{resource}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		for _, item := range p.Resources {
+			if !seen[item] && item.DependsOn(current.Address) {
+				seen[item] = true
+				dependents = append(dependents, item)
+				queue = append(queue, item)
+			}
+		}
 	}
+	return dependents
 }
 
 // ExecutionGraph represents the ordered list of resources to be executed
@@ -75,8 +269,27 @@ type ExecutionGraph struct {
 type StepAction string
 
 const (
-	StepApply  StepAction = "apply"  // Apply the current resource
-	StepSkip   StepAction = "skip"   // Skip the current resource
-	StepAbort  StepAction = "abort"  // Abort the entire process
-	StepDetail StepAction = "detail" // Show more details about the current resource
+	StepApply     StepAction = "apply"     // Apply the current resource
+	StepSkip      StepAction = "skip"      // Skip the current resource
+	StepAbort     StepAction = "abort"     // Abort the entire process
+	StepDetail    StepAction = "detail"    // Show more details about the current resource
+	StepRetry     StepAction = "retry"     // Retry the current resource after an interruption
+	StepReplan    StepAction = "replan"    // Generate a fresh plan for the remaining resources
+	StepContinue  StepAction = "continue"  // Apply resources until the next breakpoint
+	StepPostpone  StepAction = "postpone"  // Re-queue the current resource at the end of its layer
+	StepJump      StepAction = "jump"      // Continue with another pending or skipped resource
+	StepInspect   StepAction = "inspect"   // Show the state, planned values and dependents of a resource
+	StepImpact    StepAction = "impact"    // Show everything that depends on a resource, transitively
+	StepEval      StepAction = "eval"      // Evaluate a Terraform expression against the current state
+	StepWatch     StepAction = "watch"     // Add an expression to the watch list, or show the watch list
+	StepUnwatch   StepAction = "unwatch"   // Remove an expression from the watch list
+	StepList      StepAction = "list"      // List the remaining steps
+	StepSearch    StepAction = "search"    // Search resources by address
+	StepHistory   StepAction = "history"   // Show the decisions made so far
+	StepRollback  StepAction = "rollback"  // Undo the steps applied so far, in reverse order
+	StepSnapshots StepAction = "snapshots" // List, compare or restore the state snapshots of the session
+	StepTeardown  StepAction = "teardown"  // Destroy a resource together with its pending dependents
+	StepBreak     StepAction = "break"     // Set or clear the breakpoint of a resource
+	StepYes       StepAction = "yes"       // Confirm a question
+	StepNo        StepAction = "no"        // Decline a question
 )
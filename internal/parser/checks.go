@@ -0,0 +1,199 @@
+package parser
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/marc-poljak/terraform-step-debug/internal/model"
+	"github.com/marc-poljak/terraform-step-debug/internal/util"
+)
+
+// checkBlockStart matches the start of a check block in a .tf file
+var checkBlockStart = regexp.MustCompile(`(?m)^\s*check\s+"([^"]*)"\s*\{`)
+
+// extractChecks extracts the results of check blocks and conditions from the
+// plan and attaches them to the resources they refer to
+func extractChecks(planData map[string]interface{}, plan *model.Plan) {
+	plan.Checks = parseChecks(planData)
+	if len(plan.Checks) == 0 {
+		return
+	}
+
+	blocks := checkBlocks(plan.TerraformDir)
+	for _, check := range plan.Checks {
+		for _, resource := range plan.Resources {
+			if checkRefersTo(check, resource, plan, blocks) {
+				check.Resources = append(check.Resources, resource.Address)
+				resource.Checks = append(resource.Checks, check)
+			}
+		}
+	}
+}
+
+// EvaluateChecks creates a refresh-only plan and returns the check results
+// it reports, so that checks can be evaluated against the current state
+// without planning any changes
+func (p *TerraformPlanParser) EvaluateChecks(ctx context.Context, terraformDir string, inputs model.Inputs) ([]*model.Check, error) {
+	planFile, err := util.CreateTempPlanFile()
+	if err != nil {
+		return nil, err
+	}
+	defer util.CleanupFiles(planFile)
+
+	var output bytes.Buffer
+	args := util.RefreshOnlyArgs([]string{"plan", "-refresh-only", "-out", planFile}, inputs)
+	cmd := util.TerraformCommand(ctx, p.terraformPath, terraformDir, args...)
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("refresh-only plan failed: %w\n%s", err, strings.TrimSpace(output.String()))
+	}
+
+	jsonData, err := p.convertPlanToJSON(planFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert plan to JSON: %w", err)
+	}
+	var planData map[string]interface{}
+	if err := json.Unmarshal(jsonData, &planData); err != nil {
+		return nil, fmt.Errorf("failed to parse plan JSON: %w", err)
+	}
+
+	return parseChecks(planData), nil
+}
+
+// parseChecks reads the checks section of a plan, with one check for each
+// instance of a checked object
+func parseChecks(planData map[string]interface{}) []*model.Check {
+	var checks []*model.Check
+
+	objects, ok := planData["checks"].([]interface{})
+	if !ok {
+		return checks
+	}
+
+	for _, object := range objects {
+		objectMap, ok := object.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		address, _ := objectMap["address"].(map[string]interface{})
+		kind, _ := address["kind"].(string)
+
+		instances, _ := objectMap["instances"].([]interface{})
+		if len(instances) == 0 {
+			instances = []interface{}{objectMap}
+		}
+		for _, instance := range instances {
+			instanceMap, ok := instance.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			check := &model.Check{
+				Kind:   kind,
+				Status: model.CheckUnknown,
+			}
+			if instanceAddress, ok := instanceMap["address"].(map[string]interface{}); ok {
+				check.Address, _ = instanceAddress["to_display"].(string)
+			}
+			if status, ok := instanceMap["status"].(string); ok {
+				check.Status = model.CheckStatus(status)
+			}
+			if problems, ok := instanceMap["problems"].([]interface{}); ok {
+				for _, problem := range problems {
+					if problemMap, ok := problem.(map[string]interface{}); ok {
+						if message, ok := problemMap["message"].(string); ok {
+							check.Problems = append(check.Problems, message)
+						}
+					}
+				}
+			}
+			if check.Address != "" {
+				checks = append(checks, check)
+			}
+		}
+	}
+
+	return checks
+}
+
+// checkRefersTo reports whether the check is about the resource. The
+// conditions of a resource refer to the resource itself, those of an output
+// to the resources of the output expression, and check blocks to the
+// resources named in their body.
+func checkRefersTo(check *model.Check, resource *model.Resource, plan *model.Plan, blocks map[string]string) bool {
+	switch check.Kind {
+	case "resource":
+		return check.Address == resource.Address || check.Address == baseAddress(resource.Address)
+	case "output_value":
+		name := strings.TrimPrefix(check.Address, "output.")
+		for _, output := range plan.Outputs {
+			if output.Name != name {
+				continue
+			}
+			for _, address := range output.References {
+				if address == resource.Address {
+					return true
+				}
+			}
+		}
+	case "check":
+		body, ok := blocks[strings.TrimPrefix(check.Address, "check.")]
+		if !ok || strings.HasPrefix(resource.Address, "module.") {
+			return false
+		}
+		return containsWord(body, baseAddress(resource.Address))
+	}
+	return false
+}
+
+// containsWord reports whether text contains word, not as part of a longer
+// identifier such as aws_instance.web_backup for aws_instance.web
+func containsWord(text, word string) bool {
+	for offset := 0; ; {
+		index := strings.Index(text[offset:], word)
+		if index < 0 {
+			return false
+		}
+		start := offset + index
+		end := start + len(word)
+		if (start == 0 || !isWordByte(text[start-1])) && (end == len(text) || !isWordByte(text[end])) {
+			return true
+		}
+		offset = start + 1
+	}
+}
+
+// isWordByte reports whether the byte is a letter, digit or underscore
+func isWordByte(b byte) bool {
+	return b == '_' || '0' <= b && b <= '9' || 'a' <= b && b <= 'z' || 'A' <= b && b <= 'Z'
+}
+
+// checkBlocks returns the body of each check block in the .tf files of the
+// root module, by name, as the plan does not record what they refer to.
+// Comments are left out of the bodies.
+func checkBlocks(terraformDir string) map[string]string {
+	blocks := make(map[string]string)
+
+	files, err := filepath.Glob(filepath.Join(terraformDir, "*.tf"))
+	if err != nil {
+		return blocks
+	}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			continue
+		}
+		source := scanHCL(string(data))
+		for _, block := range source.blocks(checkBlockStart) {
+			blocks[block.labels[0]] = source.noComments[block.start:block.end]
+		}
+	}
+
+	return blocks
+}
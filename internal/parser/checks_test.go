@@ -0,0 +1,76 @@
+package parser
+
+import "testing"
+
+func TestContainsWord(t *testing.T) {
+	tests := []struct {
+		text string
+		word string
+		want bool
+	}{
+		{"url = aws_instance.web.public_dns", "aws_instance.web", true},
+		{"aws_instance.web", "aws_instance.web", true},
+		{"ids = [aws_instance.web[0].id]", "aws_instance.web", true},
+		{"url = aws_instance.web_backup.public_dns", "aws_instance.web", false},
+		{"url = my_aws_instance.web.id", "aws_instance.web", false},
+		{"url = aws_instance.web_backup.id, aws_instance.web.id", "aws_instance.web", true},
+		{"data.aws_instance.web.id", "aws_instance.web", true},
+		{"", "aws_instance.web", false},
+	}
+	for _, tt := range tests {
+		if got := containsWord(tt.text, tt.word); got != tt.want {
+			t.Errorf("containsWord(%q, %q) = %v, want %v", tt.text, tt.word, got, tt.want)
+		}
+	}
+}
+
+func TestCheckBlocks(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"checks.tf": `
+check "health" {
+  data "http" "web" {
+    url = "https://${aws_lb.web.dns_name}/health?q={"
+  }
+  assert {
+    condition     = data.http.web.status_code == 200 # not aws_instance.old
+    error_message = "unhealthy }"
+  }
+}
+
+/*
+check "disabled" {
+  assert { condition = aws_instance.old.id != "" }
+}
+*/
+
+check "database" {
+  assert {
+    condition     = aws_db_instance.main.status == "available"
+    error_message = <<EOT
+Database is down }
+EOT
+  }
+}
+`})
+
+	blocks := checkBlocks(dir)
+	tests := []struct {
+		check   string
+		address string
+		want    bool
+	}{
+		{"health", "aws_lb.web", true},
+		{"health", "aws_instance.old", false},
+		{"health", "aws_db_instance.main", false},
+		{"database", "aws_db_instance.main", true},
+		{"disabled", "aws_instance.old", false},
+	}
+	for _, tt := range tests {
+		if got := containsWord(blocks[tt.check], tt.address); got != tt.want {
+			t.Errorf("check %s refers to %s = %v, want %v (body %q)", tt.check, tt.address, got, tt.want, blocks[tt.check])
+		}
+	}
+	if len(blocks) != 2 {
+		t.Errorf("found %d check blocks, want 2", len(blocks))
+	}
+}
@@ -0,0 +1,137 @@
+package parser
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/marc-poljak/terraform-step-debug/internal/model"
+)
+
+// SetDriftSteps sets whether resources changed outside Terraform, without a
+// planned change of their own, become steps that refresh their state
+func (p *TerraformPlanParser) SetDriftSteps(enabled bool) {
+	p.driftSteps = enabled
+}
+
+// extractDrift records the resources that changed outside Terraform, and
+// marks the planned changes that only undo the drift. Drifted resources
+// without a planned change become refresh steps, if enabled, and always in
+// refresh-only plans.
+func (p *TerraformPlanParser) extractDrift(planData map[string]interface{}, plan *model.Plan) {
+	drifted, ok := planData["resource_drift"].([]interface{})
+	if !ok {
+		return
+	}
+
+	for _, item := range drifted {
+		changeMap, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		address, _ := changeMap["address"].(string)
+		change, _ := changeMap["change"].(map[string]interface{})
+		actions, _ := change["actions"].([]interface{})
+		if address == "" || len(actions) == 0 {
+			continue
+		}
+
+		drift := &model.Drift{
+			Address: address,
+			Action:  model.Action(actionsKey(actions)),
+			Before:  extractValues(changeMap, "before"),
+			After:   extractValues(changeMap, "after"),
+		}
+		if drift.Action == model.ActionNoop {
+			continue
+		}
+		if drift.Action == model.ActionUpdate {
+			drift.Attributes = changedAttributes(drift.Before, drift.After)
+		}
+		plan.Drift = append(plan.Drift, drift)
+
+		if resource, ok := plan.ResourcesMap[address]; ok {
+			resource.Drift = drift
+			resource.DriftCaused = causedByDrift(resource, drift)
+			continue
+		}
+		if !p.driftSteps && p.mode != model.ModeRefreshOnly {
+			continue
+		}
+
+		resourceType, _ := changeMap["type"].(string)
+		resourceName, _ := changeMap["name"].(string)
+		resource := &model.Resource{
+			Address:      address,
+			Type:         resourceType,
+			Name:         resourceName,
+			Action:       model.ActionRefresh,
+			Dependencies: []string{},
+			Attributes:   extractAttributes(changeMap),
+			Before:       drift.Before,
+			After:        drift.After,
+			Status:       model.StatusPending,
+			Drift:        drift,
+		}
+		plan.Resources = append(plan.Resources, resource)
+		plan.ResourcesMap[address] = resource
+		plan.Stats.Refresh++
+	}
+
+	plan.HasChanges = len(plan.Resources) > 0
+}
+
+// causedByDrift reports whether the planned change of a resource only
+// undoes its drift: an object deleted outside Terraform is created again,
+// or the attributes changed outside Terraform are set back
+func causedByDrift(resource *model.Resource, drift *model.Drift) bool {
+	if drift.Action == model.ActionDelete {
+		return resource.Action == model.ActionCreate || resource.Action == model.ActionReplace
+	}
+
+	drifted := make(map[string]bool, len(drift.Attributes))
+	for _, name := range drift.Attributes {
+		drifted[name] = true
+	}
+
+	switch resource.Action {
+	case model.ActionUpdate:
+		planned := changedAttributes(resource.Before, resource.After)
+		for _, name := range planned {
+			if !drifted[name] || !reflect.DeepEqual(resource.After[name], drift.Before[name]) {
+				return false
+			}
+		}
+		return len(planned) > 0
+	case model.ActionReplace:
+		for _, path := range resource.ReplacePaths {
+			if i := strings.IndexAny(path, ".["); i >= 0 {
+				path = path[:i]
+			}
+			if !drifted[path] {
+				return false
+			}
+		}
+		return len(resource.ReplacePaths) > 0
+	default:
+		return false
+	}
+}
+
+// changedAttributes returns the sorted names of the top-level attributes
+// that differ between two sets of values
+func changedAttributes(before, after map[string]any) []string {
+	var names []string
+	for name, value := range after {
+		if previous, ok := before[name]; !ok || !reflect.DeepEqual(previous, value) {
+			names = append(names, name)
+		}
+	}
+	for name := range before {
+		if _, ok := after[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
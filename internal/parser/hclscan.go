@@ -0,0 +1,166 @@
+package parser
+
+import (
+	"regexp"
+	"strings"
+)
+
+// heredocStart matches the introducer of a heredoc, e.g. <<EOT or <<-EOT
+var heredocStart = regexp.MustCompile(`^<<-?([A-Za-z_][A-Za-z0-9_-]*)\r?\n`)
+
+// hclSource is the text of a .tf file with two masked copies of the same
+// length, so that offsets found in one apply to all of them
+type hclSource struct {
+	text string
+	// code has comments, quoted strings and heredocs blanked out, so that
+	// braces and keywords inside them are not taken for syntax
+	code string
+	// noComments only has the comments blanked out, keeping the references
+	// made in string templates
+	noComments string
+}
+
+// scanHCL masks the comments, strings and heredocs of a .tf file. Masked
+// characters become spaces; line breaks are kept, so that patterns anchored
+// at line starts still work.
+func scanHCL(text string) hclSource {
+	code := []byte(text)
+	noComments := []byte(text)
+	blank := func(masked []byte, from, to int) {
+		for i := from; i < to && i < len(masked); i++ {
+			if masked[i] != '\n' {
+				masked[i] = ' '
+			}
+		}
+	}
+
+	// The open strings and template interpolations, innermost last: -1 for
+	// a quoted string, otherwise a ${ or %{ sequence inside one, with the
+	// number of braces opened in it
+	var stack []int
+	for i := 0; i < len(text); i++ {
+		top := len(stack) - 1
+		inString := top >= 0 && stack[top] < 0
+		masked := top >= 0
+		switch {
+		case inString && text[i] == '\\':
+			code[i] = ' '
+			i++
+		case inString && text[i] == '"':
+			stack = stack[:top]
+		case inString && (strings.HasPrefix(text[i:], "${") || strings.HasPrefix(text[i:], "%{")):
+			if i > 0 && text[i-1] == text[i] {
+				// $${ and %%{ are escaped, literal sequences
+				break
+			}
+			stack = append(stack, 0)
+			code[i] = ' '
+			i++
+		case inString:
+		case text[i] == '"':
+			stack = append(stack, -1)
+		case text[i] == '#' || strings.HasPrefix(text[i:], "//"):
+			end := strings.IndexByte(text[i:], '\n')
+			if end < 0 {
+				end = len(text) - i
+			}
+			blank(code, i, i+end)
+			blank(noComments, i, i+end)
+			i += end
+		case strings.HasPrefix(text[i:], "/*"):
+			end := strings.Index(text[i+2:], "*/")
+			if end < 0 {
+				end = len(text) - i - 4
+			}
+			blank(code, i, i+end+4)
+			blank(noComments, i, i+end+4)
+			i += end + 3
+		case strings.HasPrefix(text[i:], "<<"):
+			match := heredocStart.FindStringSubmatch(text[i:])
+			if match == nil {
+				break
+			}
+			end := heredocEnd(text, i+len(match[0]), match[1])
+			blank(code, i, end)
+			i = end - 1
+		case top >= 0 && text[i] == '{':
+			stack[top]++
+		case top >= 0 && text[i] == '}':
+			if stack[top] > 0 {
+				stack[top]--
+				break
+			}
+			// The interpolation ends and its string continues
+			stack = stack[:top]
+		}
+		// Everything inside strings is masked, but the outermost quotes
+		if masked && len(stack) > 0 && i < len(text) {
+			code[i] = maskByte(text[i])
+		}
+	}
+
+	return hclSource{text: text, code: string(code), noComments: string(noComments)}
+}
+
+// maskByte returns the replacement of a character inside a string
+func maskByte(b byte) byte {
+	if b == '\n' {
+		return b
+	}
+	return ' '
+}
+
+// heredocEnd returns the offset after the line closing a heredoc whose body
+// starts at start, or the end of the text when the heredoc is not closed
+func heredocEnd(text string, start int, marker string) int {
+	for offset := start; offset < len(text); {
+		end := strings.IndexByte(text[offset:], '\n')
+		if end < 0 {
+			end = len(text) - offset
+		}
+		if strings.TrimSpace(text[offset:offset+end]) == marker {
+			return offset + end
+		}
+		offset += end + 1
+	}
+	return len(text)
+}
+
+// blockEnd returns the offset of the brace closing a block, given the
+// offset following its opening brace in the masked code
+func (s hclSource) blockEnd(start int) int {
+	depth := 1
+	for i := start; i < len(s.code); i++ {
+		switch s.code[i] {
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return len(s.code)
+}
+
+// blocks returns the labels and the body range of every block that the
+// pattern finds in the masked code. The pattern ends with the opening brace
+// and captures the labels, which are read from the original text.
+func (s hclSource) blocks(pattern *regexp.Regexp) []hclBlock {
+	var blocks []hclBlock
+	for _, match := range pattern.FindAllStringSubmatchIndex(s.code, -1) {
+		block := hclBlock{start: match[1], end: s.blockEnd(match[1])}
+		for i := 2; i+1 < len(match); i += 2 {
+			block.labels = append(block.labels, s.text[match[i]:match[i+1]])
+		}
+		blocks = append(blocks, block)
+	}
+	return blocks
+}
+
+// hclBlock is a block found in a .tf file
+type hclBlock struct {
+	labels     []string
+	start, end int // Range of the body, between the braces
+}
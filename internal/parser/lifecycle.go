@@ -0,0 +1,139 @@
+package parser
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/marc-poljak/terraform-step-debug/internal/model"
+)
+
+var (
+	// resourceBlockStart matches the start of a resource block in a .tf file
+	resourceBlockStart = regexp.MustCompile(`(?m)^\s*resource\s+"([^"]*)"\s+"([^"]*)"\s*\{`)
+	// preventDestroySetting matches an enabled prevent_destroy lifecycle setting
+	preventDestroySetting = regexp.MustCompile(`(?m)^\s*prevent_destroy\s*=\s*true\b`)
+)
+
+// extractPreventDestroy marks the resources whose configuration sets
+// lifecycle prevent_destroy. The JSON plan does not record lifecycle
+// settings, so they are read from the .tf files of the root module and of
+// the modules installed by terraform init.
+func (p *TerraformPlanParser) extractPreventDestroy(plan *model.Plan) {
+	protected, allModules := preventDestroyAddresses(plan.TerraformDir)
+	if !allModules {
+		for _, resource := range plan.Resources {
+			if strings.HasPrefix(resource.Address, "module.") {
+				fmt.Fprintf(p.stderr, "Warning: the modules are not installed, prevent_destroy is only read from the root module and does not cover the resources in modules (run terraform init)\n")
+				break
+			}
+		}
+	}
+	if len(protected) == 0 {
+		return
+	}
+
+	for _, resource := range plan.Resources {
+		if protected[configAddress(resource.Address)] {
+			resource.PreventDestroy = true
+		}
+	}
+}
+
+// preventDestroyAddresses returns the configuration addresses of the
+// resource blocks that set prevent_destroy, and whether the modules were
+// read as well as the root module
+func preventDestroyAddresses(terraformDir string) (map[string]bool, bool) {
+	addresses := make(map[string]bool)
+
+	dirs, allModules := moduleDirs(terraformDir)
+	for prefix, dir := range dirs {
+		files, err := filepath.Glob(filepath.Join(dir, "*.tf"))
+		if err != nil {
+			continue
+		}
+		for _, file := range files {
+			data, err := os.ReadFile(file)
+			if err != nil {
+				continue
+			}
+			source := scanHCL(string(data))
+			for _, block := range source.blocks(resourceBlockStart) {
+				if preventDestroySetting.MatchString(source.code[block.start:block.end]) {
+					addresses[prefix+block.labels[0]+"."+block.labels[1]] = true
+				}
+			}
+		}
+	}
+
+	return addresses, allModules
+}
+
+// moduleDirs returns the directory of every module call, by the address
+// prefix of its resources, e.g. "module.app.module.db." and "" for the root
+// module. The directories are listed by terraform init in
+// .terraform/modules/modules.json; without it only the root module is
+// returned, and false.
+func moduleDirs(terraformDir string) (map[string]string, bool) {
+	dirs := map[string]string{"": terraformDir}
+
+	dataDir := os.Getenv("TF_DATA_DIR")
+	if dataDir == "" {
+		dataDir = ".terraform"
+	}
+	if !filepath.IsAbs(dataDir) {
+		dataDir = filepath.Join(terraformDir, dataDir)
+	}
+	data, err := os.ReadFile(filepath.Join(dataDir, "modules", "modules.json"))
+	if err != nil {
+		return dirs, false
+	}
+	var manifest struct {
+		Modules []struct {
+			Key string `json:"Key"`
+			Dir string `json:"Dir"`
+		} `json:"Modules"`
+	}
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return dirs, false
+	}
+
+	for _, module := range manifest.Modules {
+		if module.Key == "" {
+			continue
+		}
+		dir := module.Dir
+		if !filepath.IsAbs(dir) {
+			dir = filepath.Join(terraformDir, dir)
+		}
+		dirs["module."+strings.ReplaceAll(module.Key, ".", ".module.")+"."] = dir
+	}
+	return dirs, true
+}
+
+// configAddress returns the address of the configuration block a resource
+// instance belongs to, without the instance keys of the resource and of
+// the modules it is in
+func configAddress(address string) string {
+	var b strings.Builder
+	for i := 0; i < len(address); i++ {
+		if address[i] != '[' {
+			b.WriteByte(address[i])
+			continue
+		}
+		// Skip the key, which may be a quoted string containing brackets
+		quoted := false
+		for i++; i < len(address) && (quoted || address[i] != ']'); i++ {
+			switch {
+			case quoted && address[i] == '\\':
+				i++
+			case address[i] == '"':
+				quoted = !quoted
+			}
+		}
+	}
+	return b.String()
+}
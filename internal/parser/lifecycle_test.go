@@ -0,0 +1,181 @@
+package parser
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/marc-poljak/terraform-step-debug/internal/model"
+)
+
+// writeFiles writes files given by path relative to the directory
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestPreventDestroyAddresses(t *testing.T) {
+	tests := []struct {
+		name       string
+		files      map[string]string
+		want       []string
+		allModules bool
+	}{
+		{
+			name: "braces in strings",
+			files: map[string]string{"main.tf": `
+resource "aws_s3_bucket" "logs" {
+  description = "}"
+  tags = { note = "{{" }
+}
+
+resource "aws_db_instance" "main" {
+  lifecycle {
+    prevent_destroy = true
+  }
+}
+`},
+			want: []string{"aws_db_instance.main"},
+		},
+		{
+			name: "comments and heredocs",
+			files: map[string]string{"main.tf": `
+# resource "aws_iam_role" "commented" {
+resource "aws_iam_role" "app" {
+  policy = <<EOT
+{
+  "Statement": [{"Effect": "Allow"}
+EOT
+  /* } prevent_destroy = true */
+  // prevent_destroy = true
+  lifecycle {
+    prevent_destroy = false # prevent_destroy = true
+  }
+}
+
+resource "aws_kms_key" "main" {
+  policy = <<-POLICY
+    resource "aws_x" "y" {
+    POLICY
+  lifecycle {
+    prevent_destroy = true
+  }
+}
+`},
+			want: []string{"aws_kms_key.main"},
+		},
+		{
+			name: "templates",
+			files: map[string]string{"main.tf": `
+resource "aws_ssm_parameter" "config" {
+  value = "${jsonencode({ brace = "}" })} and $${literal} %{ if true }x%{ endif }"
+  name  = "prevent_destroy = true"
+}
+
+resource "aws_ssm_parameter" "escaped" {
+  value = "quote \" and brace }"
+  lifecycle {
+    prevent_destroy = true
+  }
+}
+`},
+			want: []string{"aws_ssm_parameter.escaped"},
+		},
+		{
+			name: "installed modules",
+			files: map[string]string{
+				"main.tf":                         `module "app" { source = "./modules/app" }`,
+				"modules/app/main.tf":             "resource \"aws_s3_bucket\" \"data\" {\n  lifecycle {\n    prevent_destroy = true\n  }\n}\n",
+				".terraform/modules/db/main.tf":   "resource \"aws_db_instance\" \"main\" {\n  lifecycle {\n    prevent_destroy = true\n  }\n}\n",
+				".terraform/modules/modules.json": `{"Modules":[{"Key":"","Source":"","Dir":"."},{"Key":"app","Source":"./modules/app","Dir":"modules/app"},{"Key":"app.db","Source":"registry.example.com/db/aws","Dir":".terraform/modules/db"}]}`,
+			},
+			want:       []string{"module.app.aws_s3_bucket.data", "module.app.module.db.aws_db_instance.main"},
+			allModules: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeFiles(t, dir, tt.files)
+
+			addresses, allModules := preventDestroyAddresses(dir)
+			var got []string
+			for address := range addresses {
+				got = append(got, address)
+			}
+			sort.Strings(got)
+			if !reflect.DeepEqual(got, tt.want) || allModules != tt.allModules {
+				t.Errorf("preventDestroyAddresses = %v %v, want %v %v", got, allModules, tt.want, tt.allModules)
+			}
+		})
+	}
+}
+
+func TestExtractPreventDestroyWarning(t *testing.T) {
+	tests := []struct {
+		name      string
+		manifest  bool
+		address   string
+		warning   bool
+		protected bool
+	}{
+		{name: "root resources only", address: "aws_db_instance.main", protected: true},
+		{name: "modules not installed", address: `module.app["eu"].aws_db_instance.main`, warning: true},
+		{name: "modules installed", manifest: true, address: `module.app["eu"].aws_db_instance.main`, protected: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			files := map[string]string{"main.tf": "resource \"aws_db_instance\" \"main\" {\n  lifecycle {\n    prevent_destroy = true\n  }\n}\n"}
+			if tt.manifest {
+				files[".terraform/modules/modules.json"] = `{"Modules":[{"Key":"app","Dir":"."}]}`
+			}
+			writeFiles(t, dir, files)
+
+			var stderr bytes.Buffer
+			p := NewTerraformPlanParser("")
+			p.SetOutput(&stderr, &stderr)
+			plan := model.NewPlan("", dir)
+			resource := &model.Resource{Address: tt.address}
+			plan.Resources = []*model.Resource{resource}
+			p.extractPreventDestroy(plan)
+
+			if got := strings.Contains(stderr.String(), "Warning"); got != tt.warning {
+				t.Errorf("warning = %v, want %v: %q", got, tt.warning, stderr.String())
+			}
+			if resource.PreventDestroy != tt.protected {
+				t.Errorf("%s prevent_destroy = %v, want %v", tt.address, resource.PreventDestroy, tt.protected)
+			}
+		})
+	}
+}
+
+func TestConfigAddress(t *testing.T) {
+	tests := []struct {
+		address string
+		want    string
+	}{
+		{"aws_instance.web", "aws_instance.web"},
+		{"aws_instance.web[0]", "aws_instance.web"},
+		{`module.app["eu"].aws_instance.web["a"]`, "module.app.aws_instance.web"},
+		{`module.app[1].module.db["x]y"].aws_db_instance.main`, "module.app.module.db.aws_db_instance.main"},
+		{`aws_instance.web["a\"]"]`, "aws_instance.web"},
+	}
+	for _, tt := range tests {
+		if got := configAddress(tt.address); got != tt.want {
+			t.Errorf("configAddress(%s) = %s, want %s", tt.address, got, tt.want)
+		}
+	}
+}
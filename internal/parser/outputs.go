@@ -0,0 +1,135 @@
+package parser
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/marc-poljak/terraform-step-debug/internal/model"
+)
+
+// extractOutputChanges extracts the planned changes to root module outputs
+// and links each output to the resources its expression refers to
+func extractOutputChanges(planData map[string]interface{}, plan *model.Plan) {
+	changes, ok := planData["output_changes"].(map[string]interface{})
+	if !ok {
+		return
+	}
+
+	references := outputReferences(planData)
+
+	names := make([]string, 0, len(changes))
+	for name := range changes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		change, ok := changes[name].(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		output := &model.OutputChange{
+			Name:      name,
+			Action:    model.ActionNoop,
+			Before:    change["before"],
+			After:     change["after"],
+			Unknown:   isTrue(change["after_unknown"]),
+			Sensitive: isTrue(change["before_sensitive"]) || isTrue(change["after_sensitive"]),
+		}
+		if actions, ok := change["actions"].([]interface{}); ok && len(actions) > 0 {
+			if action, ok := actions[0].(string); ok {
+				output.Action = model.Action(action)
+			}
+		}
+		if output.Unknown {
+			output.After = nil
+		}
+
+		for _, resource := range plan.Resources {
+			if refersToResource(references[name], resource.Address) {
+				output.References = append(output.References, resource.Address)
+				resource.Outputs = append(resource.Outputs, name)
+			}
+		}
+
+		plan.Outputs = append(plan.Outputs, output)
+	}
+}
+
+// outputReferences returns the references of each root module output
+// expression, from the configuration recorded in the plan
+func outputReferences(planData map[string]interface{}) map[string][]string {
+	references := make(map[string][]string)
+
+	configMap, ok := planData["configuration"].(map[string]interface{})
+	if !ok {
+		return references
+	}
+	rootModule, ok := configMap["root_module"].(map[string]interface{})
+	if !ok {
+		return references
+	}
+	outputs, ok := rootModule["outputs"].(map[string]interface{})
+	if !ok {
+		return references
+	}
+
+	for name, output := range outputs {
+		outputMap, ok := output.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		expression, ok := outputMap["expression"].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if refs, ok := expression["references"].([]interface{}); ok {
+			for _, ref := range refs {
+				if refStr, ok := ref.(string); ok {
+					references[name] = append(references[name], refStr)
+				}
+			}
+		}
+	}
+
+	return references
+}
+
+// refersToResource reports whether any of the references points to the
+// resource. A reference to a resource without an index covers all of its
+// instances, and a reference to a module output covers every resource in
+// the module, as the output may be derived from any of them.
+func refersToResource(references []string, address string) bool {
+	base := baseAddress(address)
+	for _, ref := range references {
+		if strings.HasPrefix(ref, "module.") {
+			parts := strings.SplitN(ref, ".", 3)
+			module := "module." + strings.SplitN(parts[1], "[", 2)[0]
+			if strings.HasPrefix(address, module+".") || strings.HasPrefix(address, module+"[") {
+				return true
+			}
+			continue
+		}
+
+		if ref == address || ref == base ||
+			strings.HasPrefix(ref, address+".") || strings.HasPrefix(ref, base+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// baseAddress returns the address of a resource without its instance key
+func baseAddress(address string) string {
+	if i := strings.LastIndex(address, "["); i > 0 && strings.HasSuffix(address, "]") {
+		return address[:i]
+	}
+	return address
+}
+
+// isTrue reports whether a JSON value is the boolean true
+func isTrue(value interface{}) bool {
+	b, ok := value.(bool)
+	return ok && b
+}
@@ -1,18 +1,26 @@
 package parser
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
+	"slices"
 	"strings"
 
 	"github.com/marc-poljak/terraform-step-debug/internal/model"
+	"github.com/marc-poljak/terraform-step-debug/internal/util"
 )
 
 // TerraformPlanParser is responsible for parsing Terraform plan files
 type TerraformPlanParser struct {
 	terraformPath string
+	driftSteps    bool           // Whether drift without a planned change becomes refresh steps
+	mode          model.PlanMode // Kind of plan generated and parsed
+	stdout        io.Writer
+	stderr        io.Writer
 }
 
 // NewTerraformPlanParser creates a new TerraformPlanParser
@@ -22,24 +30,39 @@ func NewTerraformPlanParser(terraformPath string) *TerraformPlanParser {
 	}
 	return &TerraformPlanParser{
 		terraformPath: terraformPath,
+		mode:          model.ModeNormal,
+		stdout:        os.Stdout,
+		stderr:        os.Stderr,
 	}
 }
 
-// GeneratePlan generates a new Terraform plan file
-func (p *TerraformPlanParser) GeneratePlan(terraformDir, outFile, varFile string) error {
-	// Build the command
-	args := []string{"plan", "-out", outFile}
+// SetOutput sets where the output of plan generation is written
+func (p *TerraformPlanParser) SetOutput(stdout, stderr io.Writer) {
+	p.stdout = stdout
+	p.stderr = stderr
+}
+
+// SetMode sets the kind of plan to generate and parse
+func (p *TerraformPlanParser) SetMode(mode model.PlanMode) {
+	p.mode = mode
+}
 
-	// Add var-file if specified
-	if varFile != "" {
-		args = append(args, "-var-file", varFile)
+// GeneratePlan generates a new Terraform plan file
+func (p *TerraformPlanParser) GeneratePlan(ctx context.Context, terraformDir, outFile string, inputs model.Inputs) error {
+	// Build the command with the variables and extra plan arguments
+	args := []string{"plan"}
+	switch p.mode {
+	case model.ModeRefreshOnly:
+		args = append(args, "-refresh-only")
+	case model.ModeDestroy:
+		args = append(args, "-destroy")
 	}
+	args = util.PlanArgs(append(args, "-out", outFile), inputs)
 
 	// For Terraform 1.11.x, we use proper argument separation
-	cmd := exec.Command(p.terraformPath, args...)
-	cmd.Dir = terraformDir
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
+	cmd := util.TerraformCommand(ctx, p.terraformPath, terraformDir, args...)
+	cmd.Stdout = p.stdout
+	cmd.Stderr = p.stderr
 
 	return cmd.Run()
 }
@@ -60,18 +83,39 @@ func (p *TerraformPlanParser) ParsePlan(planFile, terraformDir string) (*model.P
 
 	// Create a new plan
 	plan := model.NewPlan(planFile, terraformDir)
+	plan.Mode = p.mode
 
 	// Extract resources from the plan
 	if err := p.extractResources(planData, plan); err != nil {
 		return nil, fmt.Errorf("failed to extract resources: %w", err)
 	}
 
+	// Extract the changes made outside Terraform
+	p.extractDrift(planData, plan)
+
+	// Extract the input variables and prior state used for the plan
+	extractVariables(planData, plan)
+	plan.PriorState = planFileState(planFile)
+
 	// Calculate plan statistics
 	p.calculatePlanStats(plan)
 
 	// Resolve dependencies
 	p.resolveDependencies(plan, planData)
 
+	// Extract the planned output changes and the resources they refer to
+	extractOutputChanges(planData, plan)
+
+	// Mark the resources that must not be destroyed
+	p.extractPreventDestroy(plan)
+
+	// Extract the check results and the resources they are about
+	extractChecks(planData, plan)
+
+	// Explain the data source reads, and list the deferred changes
+	extractReadInputs(planData, plan)
+	extractDeferredChanges(planData, plan)
+
 	return plan, nil
 }
 
@@ -97,9 +141,13 @@ func (p *TerraformPlanParser) extractResources(planData map[string]interface{},
 				continue
 			}
 
-			// Get the primary action (create, update, delete)
+			// Get the primary action (create, update, delete), or replace
+			// when the object is deleted and created again
 			var action model.Action
-			switch actions[0].(string) {
+			switch actionsKey(actions) {
+			case "delete,create", "create,delete":
+				action = model.ActionReplace
+				plan.Stats.Replace++
 			case "create":
 				action = model.ActionCreate
 				plan.Stats.Create++
@@ -111,29 +159,79 @@ func (p *TerraformPlanParser) extractResources(planData map[string]interface{},
 				plan.Stats.Delete++
 			case "read":
 				action = model.ActionRead
+				plan.Stats.Read++
+			case "forget":
+				action = model.ActionForget
+				plan.Stats.Forget++
 			case "no-op":
 				action = model.ActionNoop
-				plan.Stats.Noop++
-				continue // Skip no-op resources
 			default:
 				continue // Skip unknown actions
 			}
 
+			// Imports and moves are state-only steps of their own. A change
+			// planned on top of them follows once the state step is done.
+			// Objects imported by identity have no ID for 'terraform import',
+			// so they are imported by a targeted apply with their changes.
+			importing, importID, previousAddress := extractStateChange(changeMap)
+			var followUp model.Action
+			var warnings []string
+			switch {
+			case importing:
+				plan.Stats.Import++
+				if importID == "" && action != model.ActionNoop {
+					warnings = append(warnings, fmt.Sprintf("Imported by identity, the %s is applied together with the import", action))
+				} else if action != model.ActionNoop {
+					followUp = action
+				}
+				action = model.ActionImport
+			case previousAddress != "":
+				plan.Stats.Move++
+				if action != model.ActionNoop {
+					followUp = action
+				}
+				action = model.ActionMove
+			}
+			if action == model.ActionNoop {
+				plan.Stats.Noop++
+				continue // Skip no-op resources
+			}
+
 			// Create a new resource
 			address := changeMap["address"].(string)
 			parts := strings.Split(address, ".")
 			resourceType := parts[0]
 			resourceName := strings.Join(parts[1:], ".")
+			if changeType, ok := changeMap["type"].(string); ok {
+				// The address starts with the module path for resources in
+				// modules, and with "data." for data sources
+				resourceType = changeType
+			}
+			if changeName, ok := changeMap["name"].(string); ok {
+				resourceName = changeName
+			}
 
+			readReason, _ := changeMap["action_reason"].(string)
 			resource := &model.Resource{
-				Address:      address,
-				Type:         resourceType,
-				Name:         resourceName,
-				Action:       action,
-				Dependencies: []string{},
-				Attributes:   extractAttributes(changeMap),
-				Status:       model.StatusPending,
-				Warnings:     extractWarnings(changeMap),
+				Address:         address,
+				Type:            resourceType,
+				Name:            resourceName,
+				Action:          action,
+				Dependencies:    []string{},
+				Attributes:      extractAttributes(changeMap),
+				Before:          extractValues(changeMap, "before"),
+				After:           extractValues(changeMap, "after"),
+				Status:          model.StatusPending,
+				Warnings:        extractWarnings(changeMap),
+				ReplacePaths:    extractReplacePaths(changeMap),
+				ImportID:        importID,
+				FollowUp:        followUp,
+				PreviousAddress: previousAddress,
+			}
+			if description, ok := readReasons[readReason]; ok {
+				resource.ReadReason = description
+			} else if action == model.ActionRead {
+				resource.ReadReason = readReason
 			}
 
 			// Add the resource to the plan
@@ -146,6 +244,17 @@ func (p *TerraformPlanParser) extractResources(planData map[string]interface{},
 	return nil
 }
 
+// actionsKey joins the actions of a resource change with commas
+func actionsKey(actions []interface{}) string {
+	names := make([]string, 0, len(actions))
+	for _, action := range actions {
+		if name, ok := action.(string); ok {
+			names = append(names, name)
+		}
+	}
+	return strings.Join(names, ",")
+}
+
 // extractAttributes extracts attributes from a resource change
 func extractAttributes(changeMap map[string]interface{}) map[string]any {
 	attributes := make(map[string]any)
@@ -172,6 +281,20 @@ func extractAttributes(changeMap map[string]interface{}) map[string]any {
 	return attributes
 }
 
+// extractValues extracts the "before" or "after" values of a resource change
+func extractValues(changeMap map[string]interface{}, key string) map[string]any {
+	change, ok := changeMap["change"].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+
+	values, ok := change[key].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	return values
+}
+
 // extractWarnings extracts warnings from a resource change
 func extractWarnings(changeMap map[string]interface{}) []string {
 	warnings := []string{}
@@ -187,6 +310,72 @@ func extractWarnings(changeMap map[string]interface{}) []string {
 	return warnings
 }
 
+// extractStateChange extracts whether the change imports an object, with
+// its ID unless it is imported by identity, and the address an object is
+// moved from
+func extractStateChange(changeMap map[string]interface{}) (bool, string, string) {
+	previousAddress, _ := changeMap["previous_address"].(string)
+
+	if change, ok := changeMap["change"].(map[string]interface{}); ok {
+		if importing, ok := change["importing"].(map[string]interface{}); ok {
+			importID, _ := importing["id"].(string)
+			return true, importID, previousAddress
+		}
+	}
+	return false, "", previousAddress
+}
+
+// extractReplacePaths extracts the attribute paths that force a replacement,
+// written as attribute references, e.g. "ebs_block_device[0].size"
+func extractReplacePaths(changeMap map[string]interface{}) []string {
+	change, ok := changeMap["change"].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	paths, ok := change["replace_paths"].([]interface{})
+	if !ok {
+		return nil
+	}
+
+	var replacePaths []string
+	for _, path := range paths {
+		steps, ok := path.([]interface{})
+		if !ok {
+			continue
+		}
+		var b strings.Builder
+		for _, step := range steps {
+			switch step := step.(type) {
+			case string:
+				if b.Len() > 0 {
+					b.WriteString(".")
+				}
+				b.WriteString(step)
+			case float64:
+				fmt.Fprintf(&b, "[%d]", int(step))
+			}
+		}
+		if b.Len() > 0 {
+			replacePaths = append(replacePaths, b.String())
+		}
+	}
+	return replacePaths
+}
+
+// extractVariables extracts the input variable values recorded in the plan
+func extractVariables(planData map[string]interface{}, plan *model.Plan) {
+	variables, ok := planData["variables"].(map[string]interface{})
+	if !ok {
+		return
+	}
+
+	for name, variable := range variables {
+		if varMap, ok := variable.(map[string]interface{}); ok {
+			plan.Variables[name] = varMap["value"]
+		}
+	}
+}
+
 // calculatePlanStats calculates statistics for the plan
 func (p *TerraformPlanParser) calculatePlanStats(plan *model.Plan) {
 	// Stats are already calculated during resource extraction
@@ -284,22 +473,17 @@ func extractExplicitDependencies(resMap map[string]interface{}) []string {
 	return deps
 }
 
-// extractImplicitDependencies gets dependencies implied by expressions
+// extractImplicitDependencies gets dependencies implied by expressions,
+// including the expressions of nested blocks
 func extractImplicitDependencies(resMap map[string]interface{}) []string {
 	var deps []string
 
 	if expressions, ok := resMap["expressions"].(map[string]interface{}); ok {
 		for _, expr := range expressions {
-			if exprMap, ok := expr.(map[string]interface{}); ok {
-				if refs, ok := exprMap["references"].([]interface{}); ok {
-					for _, ref := range refs {
-						if refStr, ok := ref.(string); ok {
-							// Only add if it's a resource reference (not a variable)
-							if strings.Contains(refStr, ".") && !strings.HasPrefix(refStr, "var.") {
-								deps = append(deps, refStr)
-							}
-						}
-					}
+			for _, refStr := range expressionReferences(expr) {
+				// Only add if it's a resource reference (not a variable)
+				if strings.Contains(refStr, ".") && !strings.HasPrefix(refStr, "var.") {
+					deps = append(deps, refStr)
 				}
 			}
 		}
@@ -308,6 +492,32 @@ func extractImplicitDependencies(resMap map[string]interface{}) []string {
 	return deps
 }
 
+// expressionReferences collects the references of an expression, including
+// those of the expressions in nested blocks
+func expressionReferences(expression interface{}) []string {
+	var references []string
+	switch value := expression.(type) {
+	case map[string]interface{}:
+		for key, nested := range value {
+			if key != "references" {
+				references = append(references, expressionReferences(nested)...)
+				continue
+			}
+			refs, _ := nested.([]interface{})
+			for _, ref := range refs {
+				if refStr, ok := ref.(string); ok {
+					references = append(references, refStr)
+				}
+			}
+		}
+	case []interface{}:
+		for _, nested := range value {
+			references = append(references, expressionReferences(nested)...)
+		}
+	}
+	return references
+}
+
 // assignDependenciesToResources assigns the collected dependencies to resources
 func assignDependenciesToResources(plan *model.Plan, depMap map[string][]string) {
 	for _, resource := range plan.Resources {
@@ -349,6 +559,50 @@ func (p *TerraformPlanParser) BuildExecutionGraph(plan *model.Plan) *model.Execu
 		}
 	}
 
+	// Resources are destroyed after everything that depends on them, so a
+	// destroy plan runs the layers backwards, from the leaves to the roots
+	if plan.Mode == model.ModeDestroy {
+		slices.Reverse(graph.Layers)
+	}
+
+	return withStateLayer(graph)
+}
+
+// withStateLayer moves the state-only steps (imports, moves and forgets)
+// to a first layer of their own, so they can be reviewed before any
+// infrastructure changes. Resources with a change after their state step
+// also keep their place in the dependency order, for that change. Refresh
+// steps for drifted resources come first, in a layer of their own.
+func withStateLayer(graph *model.ExecutionGraph) *model.ExecutionGraph {
+	var refreshLayer, stateLayer []*model.Resource
+	layers := make([][]*model.Resource, 0, len(graph.Layers)+2)
+	for _, layer := range graph.Layers {
+		remaining := make([]*model.Resource, 0, len(layer))
+		for _, resource := range layer {
+			switch {
+			case resource.Action == model.ActionRefresh:
+				refreshLayer = append(refreshLayer, resource)
+				continue
+			case resource.Action.StateOnly():
+				stateLayer = append(stateLayer, resource)
+				if resource.FollowUp == "" {
+					continue
+				}
+			}
+			remaining = append(remaining, resource)
+		}
+		if len(remaining) > 0 {
+			layers = append(layers, remaining)
+		}
+	}
+
+	var first [][]*model.Resource
+	for _, layer := range [][]*model.Resource{refreshLayer, stateLayer} {
+		if len(layer) > 0 {
+			first = append(first, layer)
+		}
+	}
+	graph.Layers = append(first, layers...)
 	return graph
 }
 
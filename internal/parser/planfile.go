@@ -0,0 +1,42 @@
+package parser
+
+import (
+	"archive/zip"
+	"encoding/json"
+
+	"github.com/marc-poljak/terraform-step-debug/internal/model"
+)
+
+// planFileState returns the serial and lineage of the state a saved plan was
+// made against. The JSON plan does not include them, but the plan file is a
+// zip archive with a copy of that state. An empty result means the plan file
+// could not be read or holds no state, and the current state has to do.
+func planFileState(planFile string) model.StateInfo {
+	archive, err := zip.OpenReader(planFile)
+	if err != nil {
+		return model.StateInfo{}
+	}
+	defer archive.Close()
+
+	for _, file := range archive.File {
+		if file.Name != "tfstate" {
+			continue
+		}
+		content, err := file.Open()
+		if err != nil {
+			return model.StateInfo{}
+		}
+		defer content.Close()
+
+		var state struct {
+			Serial  int64  `json:"serial"`
+			Lineage string `json:"lineage"`
+		}
+		if err := json.NewDecoder(content).Decode(&state); err != nil {
+			return model.StateInfo{}
+		}
+		return model.StateInfo{Serial: state.Serial, Lineage: state.Lineage}
+	}
+
+	return model.StateInfo{}
+}
@@ -0,0 +1,70 @@
+package parser
+
+import (
+	"archive/zip"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/marc-poljak/terraform-step-debug/internal/model"
+)
+
+func TestPlanFileState(t *testing.T) {
+	dir := t.TempDir()
+
+	writeZip := func(name string, entries map[string]string) string {
+		path := filepath.Join(dir, name)
+		file, err := os.Create(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		archive := zip.NewWriter(file)
+		for entry, content := range entries {
+			w, err := archive.Create(entry)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := w.Write([]byte(content)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := archive.Close(); err != nil {
+			t.Fatal(err)
+		}
+		file.Close()
+		return path
+	}
+
+	notZip := filepath.Join(dir, "plain.tfplan")
+	if err := os.WriteFile(notZip, []byte("not a plan"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		planFile string
+		want     model.StateInfo
+	}{
+		{
+			name: "state in plan file",
+			planFile: writeZip("state.tfplan", map[string]string{
+				"tfplan":  "binary",
+				"tfstate": `{"version": 4, "serial": 7, "lineage": "abc-123", "resources": []}`,
+			}),
+			want: model.StateInfo{Serial: 7, Lineage: "abc-123"},
+		},
+		{
+			name:     "no state in plan file",
+			planFile: writeZip("empty.tfplan", map[string]string{"tfplan": "binary"}),
+		},
+		{name: "not a zip archive", planFile: notZip},
+		{name: "missing plan file", planFile: filepath.Join(dir, "missing.tfplan")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := planFileState(tt.planFile); got != tt.want {
+				t.Errorf("planFileState = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
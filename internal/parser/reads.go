@@ -0,0 +1,146 @@
+package parser
+
+import (
+	"sort"
+
+	"github.com/marc-poljak/terraform-step-debug/internal/model"
+)
+
+// readReasons describes why a data source is read during apply, by the
+// action reason of its change
+var readReasons = map[string]string{
+	"read_because_config_unknown":     "its configuration depends on values only known after apply",
+	"read_because_dependency_pending": "a resource it depends on has changes pending",
+	"read_because_check_nested":       "it is nested in a check block, and read on every apply",
+}
+
+// deferredReasons describes why Terraform deferred a change to a later plan
+var deferredReasons = map[string]string{
+	"instance_count_unknown":  "its count or for_each is only known after apply",
+	"resource_config_unknown": "its configuration depends on values only known after apply",
+	"provider_config_unknown": "the configuration of its provider is only known after apply",
+	"absent_prereq":           "something it needs does not exist yet",
+	"deferred_prereq":         "a change it depends on is deferred too",
+}
+
+// extractReadInputs finds, for every data source read during apply, the
+// arguments that refer to changing resources, and those resources
+func extractReadInputs(planData map[string]interface{}, plan *model.Plan) {
+	expressions := dataSourceExpressions(planData)
+
+	for _, resource := range plan.Resources {
+		if resource.Action != model.ActionRead {
+			continue
+		}
+
+		arguments := expressions[baseAddress(resource.Address)]
+		names := make([]string, 0, len(arguments))
+		for name := range arguments {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if len(changingResources(plan, resource, arguments[name])) > 0 {
+				resource.UnknownInputs = append(resource.UnknownInputs, name)
+			}
+		}
+
+		// Dependencies include depends_on, which delays the read as well
+		for _, trigger := range changingResources(plan, resource, resource.Dependencies) {
+			resource.ReadTriggers = append(resource.ReadTriggers, trigger.Address)
+		}
+	}
+}
+
+// changingResources returns the resources of the plan other than the given
+// one that the references point to
+func changingResources(plan *model.Plan, resource *model.Resource, references []string) []*model.Resource {
+	var changing []*model.Resource
+	for _, other := range plan.Resources {
+		if other != resource && other.Action != model.ActionRead && refersToResource(references, other.Address) {
+			changing = append(changing, other)
+		}
+	}
+	return changing
+}
+
+// dataSourceExpressions returns the references of every argument of the
+// root module data sources, by data source address. References in nested
+// blocks count for the block argument.
+func dataSourceExpressions(planData map[string]interface{}) map[string]map[string][]string {
+	dataSources := make(map[string]map[string][]string)
+
+	configResources, ok := extractConfigResources(planData)
+	if !ok {
+		return dataSources
+	}
+	for _, res := range configResources {
+		resMap, ok := res.(map[string]interface{})
+		if !ok || resMap["mode"] != "data" {
+			continue
+		}
+		expressions, ok := resMap["expressions"].(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		arguments := make(map[string][]string)
+		for name, expression := range expressions {
+			if refs := expressionReferences(expression); len(refs) > 0 {
+				arguments[name] = refs
+			}
+		}
+		dataSources[formatResourceAddress(resMap)] = arguments
+	}
+
+	return dataSources
+}
+
+// extractDeferredChanges lists the changes that Terraform deferred to a
+// later plan, with the reason for each
+func extractDeferredChanges(planData map[string]interface{}, plan *model.Plan) {
+	deferred, ok := planData["deferred_changes"].([]interface{})
+	if !ok {
+		return
+	}
+
+	for _, item := range deferred {
+		itemMap, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		change, ok := itemMap["resource_change"].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		address, _ := change["address"].(string)
+		if address == "" {
+			continue
+		}
+
+		reason, _ := itemMap["reason"].(string)
+		if description, ok := deferredReasons[reason]; ok {
+			reason = description
+		}
+		plan.Deferred = append(plan.Deferred, &model.DeferredChange{
+			Address: address,
+			Action:  deferredAction(change),
+			Reason:  reason,
+		})
+	}
+}
+
+// deferredAction returns the action of a deferred change, which may not be
+// known yet
+func deferredAction(change map[string]interface{}) model.Action {
+	details, _ := change["change"].(map[string]interface{})
+	actions, _ := details["actions"].([]interface{})
+	switch key := actionsKey(actions); key {
+	case "delete,create", "create,delete":
+		return model.ActionReplace
+	case "":
+		return "unknown"
+	default:
+		return model.Action(key)
+	}
+}
@@ -0,0 +1,63 @@
+package parser
+
+import (
+	"reflect"
+	"sort"
+
+	"github.com/marc-poljak/terraform-step-debug/internal/model"
+)
+
+// RemapResources matches the resources of a fresh plan against the resources
+// still pending in the previous plan. Resources that were applied or skipped in
+// the session are removed from the fresh plan so they keep their decisions.
+func RemapResources(previous, next *model.Plan, decided map[string]bool) *model.PlanDiff {
+	removeResources(next, decided)
+
+	diff := &model.PlanDiff{}
+	for _, resource := range next.Resources {
+		old, ok := previous.ResourcesMap[resource.Address]
+		switch {
+		case !ok:
+			diff.Added = append(diff.Added, resource)
+		case old.Action != resource.Action || !reflect.DeepEqual(old.Attributes, resource.Attributes):
+			diff.Changed = append(diff.Changed, &model.ResourceChange{Previous: old, Current: resource})
+		}
+	}
+
+	for _, resource := range previous.Resources {
+		if decided[resource.Address] {
+			continue
+		}
+		if _, ok := next.ResourcesMap[resource.Address]; !ok {
+			diff.Removed = append(diff.Removed, resource)
+		}
+	}
+
+	sortResources(diff.Added)
+	sortResources(diff.Removed)
+	sort.Slice(diff.Changed, func(i, j int) bool {
+		return diff.Changed[i].Current.Address < diff.Changed[j].Current.Address
+	})
+
+	return diff
+}
+
+// removeResources drops the given addresses from a plan
+func removeResources(plan *model.Plan, addresses map[string]bool) {
+	remaining := make([]*model.Resource, 0, len(plan.Resources))
+	for _, resource := range plan.Resources {
+		if addresses[resource.Address] {
+			delete(plan.ResourcesMap, resource.Address)
+			continue
+		}
+		remaining = append(remaining, resource)
+	}
+	plan.Resources = remaining
+}
+
+// sortResources sorts resources by address
+func sortResources(resources []*model.Resource) {
+	sort.Slice(resources, func(i, j int) bool {
+		return resources[i].Address < resources[j].Address
+	})
+}
@@ -0,0 +1,229 @@
+package parser
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/marc-poljak/terraform-step-debug/internal/model"
+)
+
+// tfvarsAssignment matches a top-level "name = value" line in a .tfvars file
+var tfvarsAssignment = regexp.MustCompile(`^([A-Za-z_][A-Za-z0-9_-]*)\s*=\s*(.*)$`)
+
+// VerifyPlanInputs checks that the variables recorded in a saved plan match
+// the given inputs, so steps are not applied with different values than the
+// plan was created with. Values that cannot be read without evaluating HCL,
+// such as lists and maps, are not compared.
+func VerifyPlanInputs(plan *model.Plan, terraformDir string, inputs model.Inputs) error {
+	values, err := ResolveInputVariables(terraformDir, inputs)
+	if err != nil {
+		return err
+	}
+
+	var mismatches []string
+	for name, value := range values {
+		planned, ok := plan.Variables[name]
+		if ok && isScalar(planned) && formatScalar(planned) != formatScalar(value) {
+			mismatches = append(mismatches, fmt.Sprintf("%s is %q, but the plan was created with %q",
+				name, formatScalar(value), formatScalar(planned)))
+		}
+	}
+
+	if len(mismatches) > 0 {
+		sort.Strings(mismatches)
+		return fmt.Errorf("plan inputs do not match the plan file:\n  %s", strings.Join(mismatches, "\n  "))
+	}
+
+	return nil
+}
+
+// ResolveInputVariables returns the scalar variable values set through
+// TF_VAR_ environment variables, the variable files Terraform loads by
+// itself, -var-file and -var arguments, with later sources taking precedence
+// like in Terraform. The variable files are passed before the -var arguments.
+func ResolveInputVariables(terraformDir string, inputs model.Inputs) (map[string]any, error) {
+	values := make(map[string]any)
+
+	for _, env := range os.Environ() {
+		if name, value, ok := strings.Cut(env, "="); ok && strings.HasPrefix(name, "TF_VAR_") {
+			values[strings.TrimPrefix(name, "TF_VAR_")] = value
+		}
+	}
+
+	varFiles, err := autoVarFiles(terraformDir)
+	if err != nil {
+		return nil, err
+	}
+	for _, varFile := range inputs.VarFiles {
+		if !filepath.IsAbs(varFile) {
+			varFile = filepath.Join(terraformDir, varFile)
+		}
+		varFiles = append(varFiles, varFile)
+	}
+
+	for _, varFile := range varFiles {
+		fileValues, err := readVarFile(varFile)
+		if err != nil {
+			return nil, err
+		}
+		for name, value := range fileValues {
+			values[name] = value
+		}
+	}
+
+	for _, variable := range inputs.Vars {
+		name, value, ok := strings.Cut(variable, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid variable %q, expected name=value", variable)
+		}
+		values[strings.TrimSpace(name)] = value
+	}
+
+	return values, nil
+}
+
+// autoVarFiles returns the variable files that Terraform loads without being
+// asked to, in its order: terraform.tfvars, terraform.tfvars.json, then the
+// *.auto.tfvars and *.auto.tfvars.json files by name
+func autoVarFiles(terraformDir string) ([]string, error) {
+	if terraformDir == "" {
+		terraformDir = "."
+	}
+
+	var files []string
+	for _, name := range []string{"terraform.tfvars", "terraform.tfvars.json"} {
+		path := filepath.Join(terraformDir, name)
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			files = append(files, path)
+		}
+	}
+
+	entries, err := os.ReadDir(terraformDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list variable files: %w", err)
+	}
+	// Directory entries are sorted by name already
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.IsDir() && (strings.HasSuffix(name, ".auto.tfvars") || strings.HasSuffix(name, ".auto.tfvars.json")) {
+			files = append(files, filepath.Join(terraformDir, name))
+		}
+	}
+
+	return files, nil
+}
+
+// readVarFile reads the scalar values from a .tfvars or .tfvars.json file
+func readVarFile(path string) (map[string]any, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read variable file: %w", err)
+	}
+
+	if strings.HasSuffix(path, ".json") {
+		values := make(map[string]any)
+		if err := json.Unmarshal(data, &values); err != nil {
+			return nil, fmt.Errorf("failed to parse variable file %s: %w", path, err)
+		}
+		return values, nil
+	}
+
+	return parseTfvars(string(data)), nil
+}
+
+// parseTfvars extracts the top-level scalar assignments from a .tfvars file.
+// Nested blocks and multi-line values are skipped.
+func parseTfvars(content string) map[string]any {
+	values := make(map[string]any)
+	depth := 0
+
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "//") {
+			continue
+		}
+
+		if depth == 0 {
+			if match := tfvarsAssignment.FindStringSubmatch(line); match != nil {
+				if value, ok := parseTfvarsScalar(match[2]); ok {
+					values[match[1]] = value
+					continue
+				}
+			}
+		}
+
+		depth += strings.Count(line, "{") + strings.Count(line, "[") + strings.Count(line, "(")
+		depth -= strings.Count(line, "}") + strings.Count(line, "]") + strings.Count(line, ")")
+		if depth < 0 {
+			depth = 0
+		}
+	}
+
+	return values
+}
+
+// parseTfvarsScalar parses a string, number or bool literal
+func parseTfvarsScalar(raw string) (any, bool) {
+	raw = strings.TrimSpace(raw)
+
+	if strings.HasPrefix(raw, `"`) {
+		end := strings.LastIndex(raw, `"`)
+		if end <= 0 {
+			return nil, false
+		}
+		value, err := strconv.Unquote(raw[:end+1])
+		if err != nil || strings.Contains(value, "${") {
+			return nil, false
+		}
+		return value, true
+	}
+
+	// Drop trailing comments from unquoted values
+	if i := strings.IndexAny(raw, "#/"); i >= 0 {
+		raw = strings.TrimSpace(raw[:i])
+	}
+
+	switch raw {
+	case "true":
+		return true, true
+	case "false":
+		return false, true
+	}
+	if number, err := strconv.ParseFloat(raw, 64); err == nil {
+		return number, true
+	}
+
+	return nil, false
+}
+
+// isScalar reports whether a plan value is a string, number or bool
+func isScalar(value any) bool {
+	switch value.(type) {
+	case string, float64, bool:
+		return true
+	default:
+		return false
+	}
+}
+
+// formatScalar formats a scalar so that values of different types that
+// Terraform converts to each other compare equal
+func formatScalar(value any) string {
+	switch v := value.(type) {
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case string:
+		if number, err := strconv.ParseFloat(v, 64); err == nil {
+			return strconv.FormatFloat(number, 'f', -1, 64)
+		}
+		return v
+	default:
+		return fmt.Sprint(v)
+	}
+}
@@ -0,0 +1,59 @@
+package parser
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/marc-poljak/terraform-step-debug/internal/model"
+)
+
+func TestResolveInputVariablesPrecedence(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"terraform.tfvars":       "env = \"tfvars\"\nregion = \"tfvars\"\nsize = \"tfvars\"\nname = \"tfvars\"\ncount_a = 1\n",
+		"terraform.tfvars.json":  `{"region": "tfvars-json"}`,
+		"b.auto.tfvars":          "size = \"b-auto\"\n",
+		"a.auto.tfvars.json":     `{"size": "a-auto", "name": "a-auto"}`,
+		"prod.tfvars":            "name = \"var-file\"\n",
+		"ignored.tfvars":         "env = \"ignored\"\n",
+		"nested/x.auto.tfvars":   "env = \"nested\"\n",
+		"terraform.tfvars.extra": "env = \"extra\"\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("TF_VAR_env", "environment")
+	t.Setenv("TF_VAR_only_env", "environment")
+
+	values, err := ResolveInputVariables(dir, model.Inputs{
+		VarFiles: []string{"prod.tfvars"},
+		Vars:     []string{"count_a=2"},
+	})
+	if err != nil {
+		t.Fatalf("ResolveInputVariables: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		want any
+	}{
+		{"only_env", "environment"},
+		{"env", "tfvars"},         // terraform.tfvars overrides the environment
+		{"region", "tfvars-json"}, // terraform.tfvars.json overrides terraform.tfvars
+		{"size", "b-auto"},        // *.auto.tfvars files load by name
+		{"name", "var-file"},      // -var-file overrides the automatic files
+		{"count_a", "2"},          // -var overrides everything
+	}
+	for _, tt := range tests {
+		if got := values[tt.name]; formatScalar(got) != formatScalar(tt.want) {
+			t.Errorf("%s = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
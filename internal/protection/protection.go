@@ -0,0 +1,119 @@
+// Package protection decides which steps are too dangerous to apply with a
+// single keystroke. Protected resources need their full address typed to
+// confirm a delete or replace, and blocked resources are never applied.
+package protection
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/marc-poljak/terraform-step-debug/internal/model"
+)
+
+// Rules select resources by address pattern, type or tag
+type Rules struct {
+	Addresses []string `json:"addresses"` // Address patterns with * and ?
+	Types     []string `json:"types"`     // Resource types, e.g. aws_db_instance
+	Tags      []string `json:"tags"`      // Tag keys, or key=value pairs
+}
+
+// Policy holds the protection rules
+type Policy struct {
+	Protect Rules `json:"protect"` // Deletes and replaces need the address typed to confirm
+	Block   Rules `json:"block"`   // Never applied through this tool
+}
+
+// Load reads a protection policy from a JSON file
+func Load(file string) (*Policy, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read protection rules: %w", err)
+	}
+
+	var policy Policy
+	if err := json.Unmarshal(data, &policy); err != nil {
+		return nil, fmt.Errorf("failed to parse protection rules %s: %w", file, err)
+	}
+	for _, pattern := range append(policy.Protect.Addresses, policy.Block.Addresses...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid address pattern %q in %s", pattern, file)
+		}
+	}
+
+	return &policy, nil
+}
+
+// Apply marks the resources of the plan that are protected or blocked.
+// Resources whose configuration sets prevent_destroy are blocked from being
+// deleted or replaced, even without a policy file.
+func (p *Policy) Apply(plan *model.Plan) {
+	for _, resource := range plan.Resources {
+		resource.Protected, resource.Blocked = "", ""
+
+		if reason := p.Block.match(resource); reason != "" {
+			resource.Blocked = "on the block list (" + reason + ")"
+			continue
+		}
+		if !resource.Action.Destructive() {
+			continue
+		}
+		if resource.PreventDestroy {
+			resource.Blocked = "lifecycle prevent_destroy is set"
+			continue
+		}
+		if reason := p.Protect.match(resource); reason != "" {
+			resource.Protected = reason
+		}
+	}
+}
+
+// match returns which rule selects the resource, or an empty string
+func (r Rules) match(resource *model.Resource) string {
+	for _, pattern := range r.Addresses {
+		if matched, _ := path.Match(pattern, resource.Address); matched {
+			return "address " + pattern
+		}
+	}
+	for _, resourceType := range r.Types {
+		if resourceType == resource.Type {
+			return "type " + resourceType
+		}
+	}
+
+	tags := resourceTags(resource)
+	for _, tag := range r.Tags {
+		key, value, hasValue := strings.Cut(tag, "=")
+		values, ok := tags[key]
+		if ok && (!hasValue || values[value]) {
+			return "tag " + tag
+		}
+	}
+	return ""
+}
+
+// resourceTags returns the values of the tags of a resource before and
+// after the change, so that changing or removing a tag does not lift the
+// protection
+func resourceTags(resource *model.Resource) map[string]map[string]bool {
+	tags := make(map[string]map[string]bool)
+	for _, values := range []map[string]any{resource.After, resource.Before} {
+		for _, attribute := range []string{"tags_all", "tags", "labels"} {
+			attributeTags, ok := values[attribute].(map[string]any)
+			if !ok {
+				continue
+			}
+			for key, value := range attributeTags {
+				if tags[key] == nil {
+					tags[key] = make(map[string]bool)
+				}
+				if text, ok := value.(string); ok {
+					tags[key][text] = true
+				}
+			}
+		}
+	}
+	return tags
+}
@@ -0,0 +1,178 @@
+// Package risk scores the steps of a plan by how much damage a mistake
+// could do, and orders the resources of each layer by their score.
+package risk
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/marc-poljak/terraform-step-debug/internal/model"
+)
+
+// Level is a coarse risk class derived from the score
+type Level string
+
+const (
+	LevelLow    Level = "low"
+	LevelMedium Level = "medium"
+	LevelHigh   Level = "high"
+)
+
+// Order tells how the resources of a layer are sorted by risk
+type Order string
+
+const (
+	OrderPlan  Order = "plan"  // Keep the order of the execution graph
+	OrderFirst Order = "first" // Riskiest resources first
+	OrderLast  Order = "last"  // Riskiest resources last
+)
+
+// DefaultStatefulTypes are the resource types that hold data which is lost
+// when they are deleted or replaced
+var DefaultStatefulTypes = []string{
+	"aws_db_instance", "aws_rds_cluster", "aws_rds_cluster_instance", "aws_dynamodb_table",
+	"aws_s3_bucket", "aws_efs_file_system", "aws_ebs_volume", "aws_elasticache_*",
+	"aws_redshift_cluster", "aws_docdb_cluster", "aws_neptune_cluster", "aws_kms_key",
+	"aws_opensearch_domain", "aws_elasticsearch_domain", "aws_msk_cluster",
+	"google_sql_database_instance", "google_sql_database", "google_storage_bucket",
+	"google_bigquery_dataset", "google_bigquery_table", "google_spanner_*", "google_kms_crypto_key",
+	"azurerm_*_database", "azurerm_*_server", "azurerm_storage_account", "azurerm_cosmosdb_account",
+	"azurerm_key_vault",
+}
+
+// Scores added for each risk factor
+const (
+	scoreDestructive    = 60 // Delete or replace, high on its own
+	scoreUpdate         = 15
+	scoreCreate         = 5
+	scoreStateful       = 25 // Stateful type being deleted or replaced
+	scoreStatefulChange = 10 // Stateful type being changed otherwise
+	scoreReplacePaths   = 10 // Replacement forced by attribute changes
+	scorePerDependent   = 3
+	maxDependentScore   = 15
+)
+
+// Model scores resources by action, type, forced replacement and dependents
+type Model struct {
+	statefulTypes []string // Type patterns with * and ?
+}
+
+// ParseOrder validates a risk order
+func ParseOrder(order string) (Order, error) {
+	switch Order(order) {
+	case OrderPlan, OrderFirst, OrderLast:
+		return Order(order), nil
+	default:
+		return "", fmt.Errorf("invalid risk order %q (must be plan, first or last)", order)
+	}
+}
+
+// NewModel creates a risk model treating the default stateful types and
+// the extra type patterns as stateful
+func NewModel(extraStatefulTypes []string) (*Model, error) {
+	for _, pattern := range extraStatefulTypes {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid stateful type pattern %q", pattern)
+		}
+	}
+	return &Model{statefulTypes: append(append([]string{}, DefaultStatefulTypes...), extraStatefulTypes...)}, nil
+}
+
+// Apply scores every resource of the plan. In destroy plans, stateful
+// resources are also warned about, as their data goes with them.
+func (m *Model) Apply(plan *model.Plan) {
+	for _, resource := range plan.Resources {
+		resource.Risk, resource.RiskReasons = m.Score(plan, resource)
+		if plan.Mode == model.ModeDestroy && resource.Action.Destructive() && m.stateful(resource.Type) {
+			resource.Warnings = append(resource.Warnings,
+				fmt.Sprintf("%s is stateful: the data it holds is lost, make sure it is backed up or no longer needed", resource.Type))
+		}
+	}
+}
+
+// Score returns the risk score of a resource from 0 to 100, and the
+// factors that contribute to it
+func (m *Model) Score(plan *model.Plan, resource *model.Resource) (int, []string) {
+	score := 0
+	var reasons []string
+
+	switch {
+	case resource.Action.Destructive():
+		score += scoreDestructive
+		reasons = append(reasons, string(resource.Action))
+	case resource.Action == model.ActionUpdate:
+		score += scoreUpdate
+		reasons = append(reasons, "update")
+	case resource.Action == model.ActionCreate:
+		score += scoreCreate
+	}
+
+	if m.stateful(resource.Type) {
+		if resource.Action.Destructive() {
+			score += scoreStateful
+		} else {
+			score += scoreStatefulChange
+		}
+		reasons = append(reasons, "stateful type "+resource.Type)
+	}
+
+	if len(resource.ReplacePaths) > 0 {
+		score += scoreReplacePaths
+		reasons = append(reasons, "replaced because of "+strings.Join(resource.ReplacePaths, ", "))
+	}
+
+	if dependents := len(plan.Dependents(resource)); dependents > 0 {
+		score += min(dependents*scorePerDependent, maxDependentScore)
+		reasons = append(reasons, fmt.Sprintf("%d %s", dependents, plural(dependents, "dependent")))
+	}
+
+	return min(score, 100), reasons
+}
+
+// stateful reports whether the resource type is in the table of stateful types
+func (m *Model) stateful(resourceType string) bool {
+	for _, pattern := range m.statefulTypes {
+		if matched, _ := path.Match(pattern, resourceType); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// LevelOf returns the risk level of a score
+func LevelOf(score int) Level {
+	switch {
+	case score >= 60:
+		return LevelHigh
+	case score >= 30:
+		return LevelMedium
+	default:
+		return LevelLow
+	}
+}
+
+// SortLayers sorts the resources of each layer by risk score, keeping the
+// order of resources with the same score
+func SortLayers(graph *model.ExecutionGraph, order Order) {
+	if order != OrderFirst && order != OrderLast {
+		return
+	}
+	for _, layer := range graph.Layers {
+		sort.SliceStable(layer, func(i, j int) bool {
+			if order == OrderFirst {
+				return layer[i].Risk > layer[j].Risk
+			}
+			return layer[i].Risk < layer[j].Risk
+		})
+	}
+}
+
+// plural returns the word with an s unless the count is one
+func plural(count int, word string) string {
+	if count == 1 {
+		return word
+	}
+	return word + "s"
+}
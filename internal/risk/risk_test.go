@@ -0,0 +1,204 @@
+package risk
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/marc-poljak/terraform-step-debug/internal/model"
+)
+
+func TestScore(t *testing.T) {
+	riskModel, err := NewModel([]string{"custom_store_*"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		resource    *model.Resource
+		dependents  int
+		wantScore   int
+		wantReasons []string
+	}{
+		{
+			name:      "create",
+			resource:  &model.Resource{Type: "null_resource", Action: model.ActionCreate},
+			wantScore: 5,
+		},
+		{
+			name:        "update",
+			resource:    &model.Resource{Type: "aws_instance", Action: model.ActionUpdate},
+			wantScore:   15,
+			wantReasons: []string{"update"},
+		},
+		{
+			name:        "no change",
+			resource:    &model.Resource{Type: "aws_db_instance", Action: model.ActionNoop},
+			wantScore:   10,
+			wantReasons: []string{"stateful type aws_db_instance"},
+		},
+		{
+			name:        "stateful delete",
+			resource:    &model.Resource{Type: "aws_db_instance", Action: model.ActionDelete},
+			wantScore:   85,
+			wantReasons: []string{"delete", "stateful type aws_db_instance"},
+		},
+		{
+			name:        "forced replacement",
+			resource:    &model.Resource{Type: "aws_instance", Action: model.ActionReplace, ReplacePaths: []string{"ami", "subnet_id"}},
+			wantScore:   70,
+			wantReasons: []string{"replace", "replaced because of ami, subnet_id"},
+		},
+		{
+			name:        "stateful type pattern",
+			resource:    &model.Resource{Type: "aws_elasticache_cluster", Action: model.ActionUpdate},
+			wantScore:   25,
+			wantReasons: []string{"update", "stateful type aws_elasticache_cluster"},
+		},
+		{
+			name:        "extra stateful type",
+			resource:    &model.Resource{Type: "custom_store_table", Action: model.ActionCreate},
+			wantScore:   15,
+			wantReasons: []string{"stateful type custom_store_table"},
+		},
+		{
+			name:        "one dependent",
+			resource:    &model.Resource{Type: "aws_vpc", Action: model.ActionUpdate},
+			dependents:  1,
+			wantScore:   18,
+			wantReasons: []string{"update", "1 dependent"},
+		},
+		{
+			name:        "dependents are capped",
+			resource:    &model.Resource{Type: "aws_vpc", Action: model.ActionUpdate},
+			dependents:  8,
+			wantScore:   30,
+			wantReasons: []string{"update", "8 dependents"},
+		},
+		{
+			name:        "score is capped",
+			resource:    &model.Resource{Type: "aws_rds_cluster", Action: model.ActionReplace, ReplacePaths: []string{"engine"}},
+			dependents:  6,
+			wantScore:   100,
+			wantReasons: []string{"replace", "stateful type aws_rds_cluster", "replaced because of engine", "6 dependents"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plan := model.NewPlan("", "")
+			tt.resource.Address = tt.resource.Type + ".main"
+			plan.Resources = []*model.Resource{tt.resource}
+			// A chain of dependents, counted transitively
+			previous := tt.resource.Address
+			for i := 0; i < tt.dependents; i++ {
+				dependent := &model.Resource{Address: fmt.Sprintf("null_resource.d%d", i), Dependencies: []string{previous}}
+				plan.Resources = append(plan.Resources, dependent)
+				previous = dependent.Address
+			}
+
+			score, reasons := riskModel.Score(plan, tt.resource)
+			if score != tt.wantScore || !reflect.DeepEqual(reasons, tt.wantReasons) {
+				t.Errorf("Score = %d %q, want %d %q", score, reasons, tt.wantScore, tt.wantReasons)
+			}
+		})
+	}
+}
+
+func TestStateful(t *testing.T) {
+	riskModel, err := NewModel(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		resourceType string
+		want         bool
+	}{
+		{"aws_s3_bucket", true},
+		{"aws_s3_bucket_policy", false},
+		{"aws_elasticache_replication_group", true},
+		{"aws_elasticache", false},
+		{"google_spanner_database", true},
+		{"azurerm_mssql_database", true},
+		{"azurerm_postgresql_flexible_server", true},
+		{"azurerm_database", false},
+		{"azurerm_mssql_database_extended_auditing_policy", false},
+		{"aws_instance", false},
+	}
+	for _, tt := range tests {
+		if got := riskModel.stateful(tt.resourceType); got != tt.want {
+			t.Errorf("stateful(%s) = %v, want %v", tt.resourceType, got, tt.want)
+		}
+	}
+
+	if _, err := NewModel([]string{"aws_[db"}); err == nil {
+		t.Error("NewModel with an invalid pattern succeeded, want an error")
+	}
+}
+
+func TestLevelOf(t *testing.T) {
+	tests := []struct {
+		score int
+		want  Level
+	}{
+		{0, LevelLow},
+		{29, LevelLow},
+		{30, LevelMedium},
+		{59, LevelMedium},
+		{60, LevelHigh},
+		{100, LevelHigh},
+	}
+	for _, tt := range tests {
+		if got := LevelOf(tt.score); got != tt.want {
+			t.Errorf("LevelOf(%d) = %s, want %s", tt.score, got, tt.want)
+		}
+	}
+}
+
+func TestSortLayers(t *testing.T) {
+	tests := []struct {
+		order Order
+		want  []string
+	}{
+		{OrderPlan, []string{"a b c d", "e f"}},
+		{OrderFirst, []string{"b d a c", "f e"}},
+		{OrderLast, []string{"a c b d", "e f"}},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.order), func(t *testing.T) {
+			resource := func(name string, score int) *model.Resource {
+				return &model.Resource{Address: name, Risk: score}
+			}
+			graph := &model.ExecutionGraph{Layers: [][]*model.Resource{
+				{resource("a", 10), resource("b", 50), resource("c", 10), resource("d", 50)},
+				{resource("e", 5), resource("f", 85)},
+			}}
+
+			SortLayers(graph, tt.order)
+			var got []string
+			for _, layer := range graph.Layers {
+				var names []string
+				for _, resource := range layer {
+					names = append(names, resource.Address)
+				}
+				got = append(got, strings.Join(names, " "))
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("layers = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseOrder(t *testing.T) {
+	for _, order := range []string{"plan", "first", "last"} {
+		if got, err := ParseOrder(order); err != nil || string(got) != order {
+			t.Errorf("ParseOrder(%q) = %q, %v", order, got, err)
+		}
+	}
+	if _, err := ParseOrder("riskiest"); err == nil {
+		t.Error("ParseOrder(\"riskiest\") succeeded, want an error")
+	}
+}
@@ -0,0 +1,75 @@
+package session
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/marc-poljak/terraform-step-debug/internal/model"
+)
+
+// refreshChecks re-evaluates the checks of the plan with a refresh-only
+// plan after a step was applied. It prints the checks of the resource and
+// any other check whose status changed.
+func (s *Session) refreshChecks(resource *model.Resource) {
+	ctx, cancel := s.stepContext()
+	results, err := s.planner.EvaluateChecks(ctx, s.plan.TerraformDir, s.inputs)
+	cancel()
+	if err != nil {
+		s.errorf("Warning: could not re-evaluate checks: %s\n", err)
+		return
+	}
+
+	latest := make(map[string]*model.Check, len(results))
+	for _, result := range results {
+		latest[result.Address] = result
+	}
+
+	var changed []*model.Check
+	previous := make(map[*model.Check]model.CheckStatus, len(s.plan.Checks))
+	for _, check := range s.plan.Checks {
+		previous[check] = check.Status
+		check.Status, check.Problems = model.CheckUnknown, nil
+		if result, ok := latest[check.Address]; ok {
+			check.Status, check.Problems = result.Status, result.Problems
+		}
+		if check.Status != previous[check] {
+			changed = append(changed, check)
+		}
+	}
+
+	var b strings.Builder
+	for _, check := range resource.Checks {
+		writeCheck(&b, check, previous[check])
+	}
+	for _, check := range changed {
+		if !containsCheck(resource.Checks, check) {
+			writeCheck(&b, check, previous[check])
+		}
+	}
+	if b.Len() > 0 {
+		s.printf("Checks:\n%s", b.String())
+	}
+}
+
+// writeCheck writes the status of a check and its problems, with the
+// previous status if it changed
+func writeCheck(b *strings.Builder, check *model.Check, previous model.CheckStatus) {
+	fmt.Fprintf(b, "  [%s] %s", check.Status, check.Address)
+	if previous != "" && previous != check.Status {
+		fmt.Fprintf(b, " (was %s)", previous)
+	}
+	b.WriteString("\n")
+	for _, problem := range check.Problems {
+		fmt.Fprintf(b, "      %s\n", problem)
+	}
+}
+
+// containsCheck reports whether the check is in the list
+func containsCheck(checks []*model.Check, check *model.Check) bool {
+	for _, item := range checks {
+		if item == check {
+			return true
+		}
+	}
+	return false
+}
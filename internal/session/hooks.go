@@ -0,0 +1,58 @@
+package session
+
+import (
+	"github.com/marc-poljak/terraform-step-debug/internal/hooks"
+	"github.com/marc-poljak/terraform-step-debug/internal/model"
+	"github.com/marc-poljak/terraform-step-debug/internal/ui"
+)
+
+// runHooks runs the hooks of the phase that match the resource, in order,
+// and stops at the first failure. Hooks do not run in dry runs.
+func (s *Session) runHooks(phase hooks.Phase, resource *model.Resource) error {
+	if s.executer.DryRun() {
+		return nil
+	}
+
+	var matching []*hooks.Hook
+	for _, hook := range s.hooks {
+		if hook.Matches(phase, resource) {
+			matching = append(matching, hook)
+		}
+	}
+	if len(matching) == 0 {
+		return nil
+	}
+
+	input := hooks.Input{
+		Phase:   phase,
+		Address: resource.Address,
+		Type:    resource.Type,
+		Action:  resource.Action,
+		Status:  resource.Status,
+		Before:  resource.Before,
+		Planned: resource.After,
+	}
+	if phase == hooks.PhasePost {
+		ctx, cancel := s.stepContext()
+		state, exists, err := s.executer.ResourceState(ctx, resource.Address)
+		cancel()
+		switch {
+		case err != nil:
+			s.errorf("Warning: hooks get no applied values: %s\n", err)
+		case exists:
+			input.Applied = state
+		}
+	}
+
+	for _, hook := range matching {
+		s.printf("Running %s hook %s\n", phase, hook)
+		ctx, cancel := s.stepContext()
+		err := hook.Run(ctx, s.plan.TerraformDir, input,
+			ui.Writer(s.presenter, ui.StreamOutput), ui.Writer(s.presenter, ui.StreamError))
+		cancel()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package session
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/marc-poljak/terraform-step-debug/internal/model"
+)
+
+// showImpact prints the blast radius of a resource: everything that depends
+// on it transitively, how many of those changes are still pending, which of
+// them delete or replace an object, and the root outputs affected
+func (s *Session) showImpact(resource *model.Resource) {
+	dependents := s.plan.Dependents(resource)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Impact of %s (%s):\n", resource.Address, resource.Action)
+	if len(dependents) == 0 {
+		b.WriteString("  Nothing in the plan depends on it.\n")
+	}
+
+	direct := 0
+	pending := 0
+	var destructive []string
+	for _, dependent := range dependents {
+		if dependent.DependsOn(resource.Address) {
+			direct++
+		}
+		if dependent.Status == model.StatusPending {
+			pending++
+		}
+		if dependent.Action.Destructive() {
+			destructive = append(destructive, fmt.Sprintf("%s (%s)", dependent.Address, dependent.Action))
+		}
+	}
+	if len(dependents) > 0 {
+		fmt.Fprintf(&b, "  Dependents: %d (%d direct)\n", len(dependents), direct)
+		fmt.Fprintf(&b, "  Pending changes downstream: %d\n", pending)
+		if len(destructive) > 0 {
+			fmt.Fprintf(&b, "  Deletes and replaces downstream: %s\n", strings.Join(destructive, ", "))
+		}
+	}
+
+	outputs := affectedOutputs(append([]*model.Resource{resource}, dependents...))
+	if len(outputs) > 0 {
+		fmt.Fprintf(&b, "  Affected outputs: %s\n", strings.Join(outputs, ", "))
+	}
+
+	if len(dependents) > 0 {
+		b.WriteString("  Dependency tree:\n")
+		s.writeDependentTree(&b, resource, 2, map[*model.Resource]bool{resource: true})
+	}
+
+	s.printf("%s", b.String())
+}
+
+// writeDependentTree writes the direct dependents of a resource, each
+// followed by its own dependents. Resources reached earlier are not repeated.
+func (s *Session) writeDependentTree(b *strings.Builder, resource *model.Resource, depth int, seen map[*model.Resource]bool) {
+	for _, item := range s.plan.Resources {
+		if seen[item] || !item.DependsOn(resource.Address) {
+			continue
+		}
+		seen[item] = true
+		fmt.Fprintf(b, "%s- %s (%s, %s)\n", strings.Repeat("  ", depth), item.Address, item.Action, item.Status)
+		s.writeDependentTree(b, item, depth+1, seen)
+	}
+}
+
+// affectedOutputs returns the names of the root outputs that refer to any of the resources
+func affectedOutputs(resources []*model.Resource) []string {
+	names := make(map[string]bool)
+	for _, resource := range resources {
+		for _, name := range resource.Outputs {
+			names[name] = true
+		}
+	}
+
+	outputs := make([]string, 0, len(names))
+	for name := range names {
+		outputs = append(outputs, name)
+	}
+	sort.Strings(outputs)
+	return outputs
+}
@@ -0,0 +1,135 @@
+package session
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/marc-poljak/terraform-step-debug/internal/model"
+)
+
+// inspect prints the current state values, the planned values and the
+// dependents of a resource. It works for pending resources as well as for
+// those already applied in this session, to verify their results.
+func (s *Session) inspect(resource *model.Resource) error {
+	ctx, cancel := s.stepContext()
+	state, exists, err := s.executer.ResourceState(ctx, resource.Address)
+	cancel()
+	if err != nil {
+		return fmt.Errorf("failed to read the state of %s: %w", resource.Address, err)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Inspect %s (%s, %s)\n", resource.Address, resource.Action, resource.Status)
+
+	b.WriteString("\nCurrent state:\n")
+	if exists {
+		writeValues(&b, state)
+	} else {
+		b.WriteString("  (not in state)\n")
+	}
+
+	b.WriteString("\nPlanned values:\n")
+	switch {
+	case resource.Action == model.ActionDelete:
+		b.WriteString("  (deleted)\n")
+	case resource.After == nil:
+		b.WriteString("  (known after apply)\n")
+	default:
+		writeValues(&b, resource.After)
+	}
+
+	// After an apply, point out where the state differs from the plan
+	if exists && resource.Status == model.StatusComplete && resource.After != nil {
+		differences := valueDifferences(state, resource.After)
+		if len(differences) > 0 {
+			b.WriteString("\nDiffers from the plan:\n")
+			for _, difference := range differences {
+				fmt.Fprintf(&b, "  ! %s\n", difference)
+			}
+		}
+	}
+
+	b.WriteString("\nDependents:\n")
+	dependents := s.dependents(resource)
+	if len(dependents) == 0 {
+		b.WriteString("  (nothing)\n")
+	}
+	for _, dependent := range dependents {
+		fmt.Fprintf(&b, "  - %s (%s)\n", dependent.Address, dependent.Status)
+	}
+
+	if len(resource.Outputs) > 0 {
+		b.WriteString("\nAffects outputs:\n")
+		for _, name := range resource.Outputs {
+			value := "(not known yet)"
+			if output, ok := s.outputs[name]; ok {
+				value = formatOutput(output)
+			}
+			fmt.Fprintf(&b, "  - %s = %s\n", name, value)
+		}
+	}
+
+	s.printf("%s", b.String())
+	return nil
+}
+
+// dependents returns the resources of the plan that depend on the resource directly
+func (s *Session) dependents(resource *model.Resource) []*model.Resource {
+	var dependents []*model.Resource
+	for _, item := range s.plan.Resources {
+		if item.DependsOn(resource.Address) {
+			dependents = append(dependents, item)
+		}
+	}
+	return dependents
+}
+
+// writeValues writes attribute values sorted by name
+func writeValues(b *strings.Builder, values map[string]any) {
+	if len(values) == 0 {
+		b.WriteString("  (no attributes)\n")
+		return
+	}
+	for _, key := range sortedKeys(values) {
+		fmt.Fprintf(b, "  %s = %s\n", key, formatValue(values[key]))
+	}
+}
+
+// valueDifferences lists the planned values that the state does not match.
+// Values unknown at plan time are missing from the planned values and are
+// not compared.
+func valueDifferences(state, planned map[string]any) []string {
+	var differences []string
+	for _, key := range sortedKeys(planned) {
+		if !reflect.DeepEqual(state[key], planned[key]) {
+			differences = append(differences, fmt.Sprintf("%s: state %s, planned %s",
+				key, formatValue(state[key]), formatValue(planned[key])))
+		}
+	}
+	return differences
+}
+
+// sortedKeys returns the keys of a map in alphabetical order
+func sortedKeys(values map[string]any) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// formatValue formats an attribute value compactly
+func formatValue(value any) string {
+	if value == nil {
+		return "null"
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(data)
+}
@@ -0,0 +1,270 @@
+package session
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/marc-poljak/terraform-step-debug/internal/model"
+)
+
+// decisionRecord is an entry of the decision history
+type decisionRecord struct {
+	Time    time.Time
+	Address string
+	Action  model.StepAction
+	Result  string // Resulting status, or a note such as the jump target
+}
+
+// record adds a decision to the history
+func (s *Session) record(address string, action model.StepAction, result string) {
+	s.history = append(s.history, decisionRecord{
+		Time:    time.Now(),
+		Address: address,
+		Action:  action,
+		Result:  result,
+	})
+}
+
+// showHistory prints the decisions made so far
+func (s *Session) showHistory() {
+	if len(s.history) == 0 {
+		s.printf("No decisions made yet.\n")
+		return
+	}
+
+	var b strings.Builder
+	b.WriteString("Decision history:\n")
+	for i, entry := range s.history {
+		fmt.Fprintf(&b, "  %3d. %s  %-8s %s", i+1, entry.Time.Format("15:04:05"), entry.Action, entry.Address)
+		if entry.Result != "" {
+			fmt.Fprintf(&b, " -> %s", entry.Result)
+		}
+		b.WriteString("\n")
+	}
+	s.printf("%s", b.String())
+}
+
+// listRemaining prints the steps still waiting for a decision, by layer
+func (s *Session) listRemaining(current *model.Resource) {
+	var b strings.Builder
+	count := 0
+	for layerIndex, layer := range s.graph.Layers {
+		var pending []*model.Resource
+		for _, resource := range layer {
+			if s.targeted(resource) && !s.processed[resource.Address] {
+				pending = append(pending, resource)
+			}
+		}
+		if len(pending) == 0 {
+			continue
+		}
+
+		fmt.Fprintf(&b, "  Layer %d:\n", layerIndex+1)
+		for _, resource := range pending {
+			marker := " "
+			if resource == current {
+				marker = ">"
+			}
+			fmt.Fprintf(&b, "   %s %s (%s)", marker, resource.Address, resource.Action)
+			if resource.Breakpoint {
+				b.WriteString(" [breakpoint]")
+			}
+			b.WriteString("\n")
+			count++
+		}
+	}
+
+	if count == 0 {
+		s.printf("No remaining steps.\n")
+	} else {
+		s.printf("Remaining steps (%d):\n%s", count, b.String())
+	}
+
+	// Changes deferred by Terraform are not steps of this plan, but still to do
+	if len(s.plan.Deferred) > 0 {
+		b.Reset()
+		for _, change := range s.plan.Deferred {
+			fmt.Fprintf(&b, "     %s (%s): %s\n", change.Address, change.Action, change.Reason)
+		}
+		s.printf("Postponed by Terraform to a later plan (%d):\n%s", len(s.plan.Deferred), b.String())
+	}
+}
+
+// search prints the resources whose address contains the text, or matches
+// the regular expression when the pattern is written as /regex/
+func (s *Session) search(pattern string) error {
+	match := func(address string) bool { return strings.Contains(address, pattern) }
+	if len(pattern) > 2 && strings.HasPrefix(pattern, "/") && strings.HasSuffix(pattern, "/") {
+		re, err := regexp.Compile(pattern[1 : len(pattern)-1])
+		if err != nil {
+			return fmt.Errorf("invalid search pattern: %w", err)
+		}
+		match = re.MatchString
+	}
+
+	var b strings.Builder
+	count := 0
+	for _, resource := range s.plan.Resources {
+		if !match(resource.Address) {
+			continue
+		}
+		fmt.Fprintf(&b, "  %s (%s) %s\n", resource.Address, resource.Action, resource.Status)
+		count++
+	}
+
+	if count == 0 {
+		s.printf("No resources match %q.\n", pattern)
+		return nil
+	}
+	s.printf("Resources matching %q (%d):\n%s", pattern, count, b.String())
+	return nil
+}
+
+// postpone moves the resource to the end of its layer, so that the other
+// pending resources of the layer come first. Returns false when there is
+// nothing to move it behind.
+func (s *Session) postpone(resource *model.Resource) bool {
+	for layerIndex, layer := range s.graph.Layers {
+		position := -1
+		others := 0
+		for i, item := range layer {
+			switch {
+			case item == resource:
+				position = i
+			case s.targeted(item) && !s.processed[item.Address]:
+				others++
+			}
+		}
+		if position < 0 {
+			continue
+		}
+		if others == 0 {
+			return false
+		}
+
+		reordered := make([]*model.Resource, 0, len(layer))
+		reordered = append(reordered, layer[:position]...)
+		reordered = append(reordered, layer[position+1:]...)
+		s.graph.Layers[layerIndex] = append(reordered, resource)
+		return true
+	}
+	return false
+}
+
+// findResource finds a resource by its address, or by a part of the
+// address that only one resource contains
+func (s *Session) findResource(query string) (*model.Resource, error) {
+	if resource, ok := s.plan.ResourcesMap[query]; ok {
+		return resource, nil
+	}
+
+	var matches []*model.Resource
+	for _, resource := range s.plan.Resources {
+		if strings.Contains(resource.Address, query) {
+			matches = append(matches, resource)
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		return nil, fmt.Errorf("no resource matches %q", query)
+	case 1:
+		return matches[0], nil
+	default:
+		addresses := make([]string, 0, len(matches))
+		for _, match := range matches {
+			addresses = append(addresses, match.Address)
+		}
+		return nil, fmt.Errorf("%q matches several resources: %s", query, strings.Join(addresses, ", "))
+	}
+}
+
+// jump makes the resource the next one to decide on. A resource that was
+// skipped or did not complete is reopened, so it can be revisited. Jumping
+// is refused while resources the target depends on are still pending, or in
+// a destroy plan, resources that depend on the target.
+func (s *Session) jump(query string) (*model.Resource, error) {
+	target, err := s.findResource(query)
+	if err != nil {
+		return nil, err
+	}
+	if !s.targeted(target) {
+		return nil, fmt.Errorf("%s is not the targeted resource", target.Address)
+	}
+	if s.processed[target.Address] && target.Status == model.StatusComplete {
+		return nil, fmt.Errorf("%s was already applied", target.Address)
+	}
+
+	var pending, incomplete []string
+	for _, resource := range s.prerequisites(target) {
+		switch {
+		case !s.processed[resource.Address]:
+			pending = append(pending, resource.Address)
+		case resource.Status != model.StatusComplete:
+			incomplete = append(incomplete, resource.Address)
+		}
+	}
+	if s.plan.Mode == model.ModeDestroy {
+		if len(pending) > 0 {
+			return nil, fmt.Errorf("%s is still needed by pending resources: %s (use teardown to destroy them together)",
+				target.Address, strings.Join(pending, ", "))
+		}
+		if len(incomplete) > 0 {
+			s.errorf("Warning: %s is needed by resources that were not destroyed, Terraform destroys them as well: %s\n",
+				target.Address, strings.Join(incomplete, ", "))
+		}
+	} else {
+		if len(pending) > 0 {
+			return nil, fmt.Errorf("%s depends on pending resources: %s", target.Address, strings.Join(pending, ", "))
+		}
+		if len(incomplete) > 0 {
+			s.errorf("Warning: %s depends on resources that were not applied: %s\n",
+				target.Address, strings.Join(incomplete, ", "))
+		}
+	}
+
+	if s.processed[target.Address] {
+		s.reopen(target)
+	}
+	s.jumpTo = target
+	return target, nil
+}
+
+// toggleBreakpoint sets or clears the breakpoint of the resource given by
+// address, or of the current one. Continuing stops at breakpoints.
+func (s *Session) toggleBreakpoint(current *model.Resource, query string) error {
+	resource := current
+	if query != "" {
+		var err error
+		if resource, err = s.findResource(query); err != nil {
+			return err
+		}
+	}
+
+	resource.Breakpoint = !resource.Breakpoint
+	if resource.Breakpoint {
+		s.printf("Breakpoint set at %s.\n", resource.Address)
+	} else {
+		s.printf("Breakpoint cleared at %s.\n", resource.Address)
+	}
+	return nil
+}
+
+// reopen returns a processed resource to the pending steps
+func (s *Session) reopen(resource *model.Resource) {
+	delete(s.processed, resource.Address)
+	for i, executed := range s.executed {
+		if executed == resource {
+			s.executed = append(s.executed[:i:i], s.executed[i+1:]...)
+			break
+		}
+	}
+	resource.Status = model.StatusPending
+}
+
+// targeted reports whether the resource is stepped through, given the target filter
+func (s *Session) targeted(resource *model.Resource) bool {
+	return s.targetAddr == "" || resource.Address == s.targetAddr
+}
@@ -0,0 +1,95 @@
+package session
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/marc-poljak/terraform-step-debug/internal/executor"
+	"github.com/marc-poljak/terraform-step-debug/internal/model"
+)
+
+// captureOutputs records the current output values, so that the outputs
+// changed by each applied step can be shown
+func (s *Session) captureOutputs() {
+	if len(s.plan.Outputs) == 0 || s.executer.DryRun() {
+		return
+	}
+
+	outputs, err := s.readOutputs()
+	if err != nil {
+		s.errorf("Warning: %s\n", err)
+		return
+	}
+	s.outputs = outputs
+}
+
+// refreshOutputs reads the outputs after a step was applied and prints
+// those that became known, changed or were removed. Outputs that refer to
+// the resource but are still unknown are listed as well.
+func (s *Session) refreshOutputs(resource *model.Resource) {
+	outputs, err := s.readOutputs()
+	if err != nil {
+		s.errorf("Warning: %s\n", err)
+		return
+	}
+	previous := s.outputs
+	s.outputs = outputs
+
+	names := make(map[string]bool)
+	for name := range previous {
+		names[name] = true
+	}
+	for name := range outputs {
+		names[name] = true
+	}
+	sorted := make([]string, 0, len(names))
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+
+	var b strings.Builder
+	for _, name := range sorted {
+		before, known := previous[name]
+		after, exists := outputs[name]
+		switch {
+		case exists && !known:
+			fmt.Fprintf(&b, "  + %s = %s (now known)\n", name, formatOutput(after))
+		case known && !exists:
+			fmt.Fprintf(&b, "  - %s (removed)\n", name)
+		case !reflect.DeepEqual(before, after):
+			fmt.Fprintf(&b, "  ~ %s = %s -> %s\n", name, formatOutput(before), formatOutput(after))
+		}
+	}
+	for _, name := range resource.Outputs {
+		if _, exists := outputs[name]; !exists {
+			fmt.Fprintf(&b, "  ? %s (not known yet)\n", name)
+		}
+	}
+
+	if b.Len() == 0 {
+		if len(resource.Outputs) > 0 {
+			s.printf("Outputs: no changes\n")
+		}
+		return
+	}
+	s.printf("Outputs:\n%s", b.String())
+}
+
+// readOutputs reads the outputs with a context that is cancelled on interrupt
+func (s *Session) readOutputs() (map[string]executor.OutputValue, error) {
+	ctx, cancel := s.stepContext()
+	defer cancel()
+
+	return s.executer.Outputs(ctx)
+}
+
+// formatOutput formats an output value, hiding sensitive values
+func formatOutput(output executor.OutputValue) string {
+	if output.Sensitive {
+		return "(sensitive value)"
+	}
+	return formatValue(output.Value)
+}
@@ -0,0 +1,49 @@
+package session
+
+import (
+	"github.com/marc-poljak/terraform-step-debug/internal/model"
+	"github.com/marc-poljak/terraform-step-debug/internal/ui"
+)
+
+// authorize reports whether the resource may be applied. Blocked resources
+// are refused, and deleting or replacing a protected resource requires the
+// user to type its full address, once per resource.
+func (s *Session) authorize(resource *model.Resource) (bool, error) {
+	if resource.Blocked != "" {
+		s.errorf("Error: %s cannot be applied with this tool: %s\n", resource.Address, resource.Blocked)
+		s.record(resource.Address, model.StepApply, "blocked")
+		return false, nil
+	}
+	if resource.Protected == "" || s.authorized[resource.Address] {
+		return true, nil
+	}
+
+	s.errorf("Warning: %s is protected (%s).\n", resource.Address, resource.Protected)
+	answer, err := s.decide(ui.Decision{
+		Kind:     ui.DecisionConfirmAddress,
+		Resource: resource,
+		Choices:  []model.StepAction{model.StepYes, model.StepNo},
+	})
+	if err != nil {
+		return false, err
+	}
+	if answer.Action != model.StepYes || answer.Argument != resource.Address {
+		s.printf("The address was not confirmed, %s is not applied.\n", resource.Address)
+		s.record(resource.Address, model.StepApply, "not confirmed")
+		return false, nil
+	}
+
+	s.authorized[resource.Address] = true
+	return true, nil
+}
+
+// authorizeAll authorizes resources applied together, and stops at the first
+// one that may not be applied
+func (s *Session) authorizeAll(resources []*model.Resource) (bool, error) {
+	for _, resource := range resources {
+		if allowed, err := s.authorize(resource); !allowed || err != nil {
+			return allowed, err
+		}
+	}
+	return true, nil
+}
@@ -0,0 +1,149 @@
+package session
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/marc-poljak/terraform-step-debug/internal/model"
+)
+
+// rollback steps through the inverse of the steps applied so far, latest
+// first, as a session of its own. Returns whether the rollback started, and
+// the error that ended it, if it did not finish, abort or fail normally.
+func (s *Session) rollback() (bool, error) {
+	if s.rollingBack {
+		return false, errors.New("a rollback cannot be rolled back")
+	}
+	if s.rollbacker == nil {
+		return false, errors.New("rollbacks are not available")
+	}
+
+	plan, graph, irreversible := s.rollbackPlan()
+	if len(plan.Resources) == 0 {
+		return false, errors.New("nothing was applied in this session, there is nothing to roll back")
+	}
+
+	rollback := New(Config{
+		Presenter:        s.presenter,
+		Executor:         s.rollbacker,
+		Planner:          s.planner,
+		Inputs:           s.inputs,
+		Protection:       s.protection,
+		Risk:             s.risk,
+		Snapshots:        s.snapshots,
+		SkipChecks:       s.skipChecks,
+		RollbackExecutor: s.rollbacker,
+		StepContext:      s.stepContext,
+	}, plan, graph)
+	rollback.rollingBack = true
+	for resource, reason := range irreversible {
+		resource.Blocked = reason
+	}
+
+	s.printf("Rolling back %d applied steps, latest first.\n", len(plan.Resources))
+	err := rollback.Run()
+	if err != nil && !errors.Is(err, ErrAborted) && !errors.Is(err, ErrFailed) {
+		return true, err
+	}
+
+	// Restored steps only rewrote the state, the objects keep their new values
+	counts := make(map[model.ResourceStatus]int)
+	restored := 0
+	for _, resource := range rollback.Executed() {
+		if resource.Status == model.StatusComplete && resource.Action == model.ActionRestore {
+			restored++
+			continue
+		}
+		counts[resource.Status]++
+	}
+	failed := len(rollback.Executed()) - counts[model.StatusComplete] - counts[model.StatusSkipped] - restored
+	s.printf("Rollback finished: %d undone, %d restored in state only, %d skipped, %d failed.\n",
+		counts[model.StatusComplete], restored, counts[model.StatusSkipped], failed)
+	return true, nil
+}
+
+// rollbackPlan builds the inverse operations of the steps applied so far in
+// reverse order, one per layer: created resources are destroyed, the state
+// recorded before an update or refresh is restored, imported objects are
+// forgotten and moved ones are moved back. Deleted and forgotten objects
+// cannot be brought back; their steps are returned with the reason, to be
+// blocked.
+func (s *Session) rollbackPlan() (*model.Plan, *model.ExecutionGraph, map[*model.Resource]string) {
+	plan := model.NewPlan("", s.plan.TerraformDir)
+	plan.Workspace = s.plan.Workspace
+	plan.Backend = s.plan.Backend
+	graph := &model.ExecutionGraph{}
+	irreversible := make(map[*model.Resource]string)
+
+	// Removing an imported object from the state also undoes the changes
+	// applied to it after the import
+	imported := make(map[string]bool)
+	for _, applied := range s.executed {
+		if applied.Action == model.ActionImport && applied.Status == model.StatusComplete {
+			imported[applied.Address] = true
+		}
+	}
+
+	for i := len(s.executed) - 1; i >= 0; i-- {
+		applied := s.executed[i]
+		if applied.Status != model.StatusComplete || (imported[applied.Address] && applied.Action != model.ActionImport) {
+			continue
+		}
+
+		step := &model.Resource{
+			Address:        applied.Address,
+			Type:           applied.Type,
+			Name:           applied.Name,
+			Before:         applied.After,
+			After:          applied.Before,
+			Status:         model.StatusPending,
+			PreventDestroy: applied.PreventDestroy,
+			PriorState:     applied.PriorState,
+			// Kept so that a created resource is not destroyed before its dependents are rolled back
+			Dependencies: applied.Dependencies,
+		}
+		switch applied.Action {
+		case model.ActionCreate:
+			step.Action = model.ActionDelete
+			step.After = nil
+			plan.Stats.Delete++
+		case model.ActionUpdate:
+			step.Action = model.ActionRestore
+			step.Warnings = []string{"Only the state is restored, the object keeps its new values until the previous configuration is applied"}
+			if applied.PriorState == nil {
+				irreversible[step] = "no state was recorded before the update"
+			}
+			plan.Stats.Update++
+		case model.ActionRefresh:
+			// A refresh only changed the state, restoring it undoes it all
+			step.Action = model.ActionRestore
+			if applied.PriorState == nil {
+				irreversible[step] = "no state was recorded before the refresh"
+			}
+			plan.Stats.Update++
+		case model.ActionDelete, model.ActionReplace:
+			step.Action = applied.Action
+			irreversible[step] = fmt.Sprintf("the %s deleted the object, which cannot be undone", applied.Action)
+		case model.ActionImport:
+			step.Action = model.ActionForget
+			step.Warnings = []string{"Only the state forgets the object, the imported object itself is kept"}
+			plan.Stats.Forget++
+		case model.ActionMove:
+			step.Action = model.ActionMove
+			step.Address, step.PreviousAddress = applied.PreviousAddress, applied.Address
+			plan.Stats.Move++
+		case model.ActionForget:
+			step.Action = applied.Action
+			irreversible[step] = "the object was removed from the state, import it again to undo this"
+		default:
+			continue
+		}
+
+		plan.Resources = append(plan.Resources, step)
+		plan.ResourcesMap[step.Address] = step
+		graph.Layers = append(graph.Layers, []*model.Resource{step})
+	}
+	plan.HasChanges = len(plan.Resources) > 0
+
+	return plan, graph, irreversible
+}
@@ -0,0 +1,832 @@
+// Package session implements the step-debugging loop. It walks the execution
+// graph, asks a presenter what to do with each resource and runs the chosen
+// actions, independently of how events are shown and decisions are made.
+package session
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/marc-poljak/terraform-step-debug/internal/executor"
+	"github.com/marc-poljak/terraform-step-debug/internal/hooks"
+	"github.com/marc-poljak/terraform-step-debug/internal/model"
+	"github.com/marc-poljak/terraform-step-debug/internal/parser"
+	"github.com/marc-poljak/terraform-step-debug/internal/protection"
+	"github.com/marc-poljak/terraform-step-debug/internal/risk"
+	"github.com/marc-poljak/terraform-step-debug/internal/snapshot"
+	"github.com/marc-poljak/terraform-step-debug/internal/ui"
+	"github.com/marc-poljak/terraform-step-debug/internal/util"
+)
+
+var (
+	// ErrAborted signals that the user aborted the execution
+	ErrAborted = errors.New("execution aborted")
+	// ErrFailed signals that the user stopped the execution after a failed step
+	ErrFailed = errors.New("execution aborted due to errors")
+)
+
+// Executor runs the steps of a session. It is implemented by
+// executor.TerraformExecutor.
+type Executor interface {
+	ExecuteStepAction(ctx context.Context, action model.StepAction, resource *model.Resource) error
+	CaptureBaseline(ctx context.Context, plan *model.Plan, configHashes map[string]string) (*executor.Baseline, error)
+	UpdateBaselineState(ctx context.Context, baseline *executor.Baseline) error
+	CheckStaleness(ctx context.Context, baseline *executor.Baseline) ([]string, error)
+	ResourceState(ctx context.Context, address string) (map[string]any, bool, error)
+	PullState(ctx context.Context) ([]byte, error)
+	PushState(ctx context.Context, data []byte) error
+	Evaluate(ctx context.Context, expression string) (string, error)
+	Outputs(ctx context.Context) (map[string]executor.OutputValue, error)
+	SetPlanFile(planFile string)
+	DryRun() bool
+}
+
+// Planner creates and parses the plans of a session. It is implemented by
+// parser.TerraformPlanParser.
+type Planner interface {
+	GeneratePlan(ctx context.Context, terraformDir, outFile string, inputs model.Inputs) error
+	ParsePlan(planFile, terraformDir string) (*model.Plan, error)
+	BuildExecutionGraph(plan *model.Plan) *model.ExecutionGraph
+	EvaluateChecks(ctx context.Context, terraformDir string, inputs model.Inputs) ([]*model.Check, error)
+}
+
+// Config holds what a session needs besides the plan
+type Config struct {
+	Presenter  ui.Presenter
+	Executor   Executor
+	Planner    Planner
+	Inputs     model.Inputs
+	TargetAddr string             // Only step through this resource, if set
+	Watches    []string           // Expressions re-evaluated after every applied step
+	Hooks      []*hooks.Hook      // Checks run before and after apply steps
+	Protection *protection.Policy // Marks protected and blocked resources, nil to only honor prevent_destroy
+	Risk       *risk.Model        // Scores the resources, nil for the default stateful types
+	RiskOrder  risk.Order         // How the resources of a layer are sorted by risk
+	Snapshots  *snapshot.Store    // Saves the state before every apply step, nil to not keep snapshots
+	SkipChecks bool               // Do not re-evaluate the checks after every applied step
+
+	// RollbackExecutor runs the steps of a rollback, destroying the
+	// resources created in this session. Nil disables rollbacks.
+	RollbackExecutor Executor
+
+	StaleMode executor.StaleCheckMode
+	Baseline  *executor.Baseline // The state the plan was made against, nil to skip stale checks
+
+	// StepContext returns the context for a step and a function that ends
+	// it. Defaults to a background context.
+	StepContext func() (context.Context, context.CancelFunc)
+}
+
+// stepResult describes how processing a resource ended
+type stepResult int
+
+const (
+	stepPending   stepResult = iota // The resource was not processed
+	stepProcessed                   // The resource was applied or skipped
+	stepReplanned                   // The remaining steps were re-planned
+	stepDeferred                    // The resource was postponed or another one was jumped to
+)
+
+// Session holds the state of a step-by-step run through a plan
+type Session struct {
+	presenter   ui.Presenter
+	executer    Executor
+	planner     Planner
+	inputs      model.Inputs
+	targetAddr  string
+	hooks       []*hooks.Hook
+	protection  *protection.Policy
+	risk        *risk.Model
+	riskOrder   risk.Order
+	rollbacker  Executor
+	rollingBack bool // Whether this session undoes the steps of another one
+	snapshots   *snapshot.Store
+	skipChecks  bool
+	stepContext func() (context.Context, context.CancelFunc)
+
+	plan      *model.Plan
+	graph     *model.ExecutionGraph
+	staleMode executor.StaleCheckMode
+	baseline  *executor.Baseline
+
+	executed   []*model.Resource // Resources applied or skipped, in order
+	processed  map[string]bool   // Addresses of the executed resources
+	tempFiles  []string          // Plan files generated while re-planning
+	continuing bool              // Whether resources are applied until the next breakpoint
+	jumpTo     *model.Resource   // Resource to decide on next, chosen with jump
+	history    []decisionRecord  // Decisions made in this session, in order
+	watches    []*watchExpression
+	outputs    map[string]executor.OutputValue // Output values after the last applied step
+	authorized map[string]bool                 // Protected resources whose address was typed to confirm
+}
+
+// New creates a session stepping through the plan's execution graph
+func New(config Config, plan *model.Plan, graph *model.ExecutionGraph) *Session {
+	stepContext := config.StepContext
+	if stepContext == nil {
+		stepContext = func() (context.Context, context.CancelFunc) {
+			return context.WithCancel(context.Background())
+		}
+	}
+
+	watches := make([]*watchExpression, 0, len(config.Watches))
+	for _, expression := range config.Watches {
+		watches = append(watches, &watchExpression{Expression: expression})
+	}
+
+	policy := config.Protection
+	if policy == nil {
+		policy = &protection.Policy{}
+	}
+	policy.Apply(plan)
+
+	riskModel := config.Risk
+	if riskModel == nil {
+		riskModel, _ = risk.NewModel(nil)
+	}
+	riskModel.Apply(plan)
+	risk.SortLayers(graph, config.RiskOrder)
+
+	return &Session{
+		presenter:   config.Presenter,
+		executer:    config.Executor,
+		planner:     config.Planner,
+		inputs:      config.Inputs,
+		targetAddr:  config.TargetAddr,
+		hooks:       config.Hooks,
+		protection:  policy,
+		risk:        riskModel,
+		riskOrder:   config.RiskOrder,
+		rollbacker:  config.RollbackExecutor,
+		snapshots:   config.Snapshots,
+		skipChecks:  config.SkipChecks,
+		stepContext: stepContext,
+		plan:        plan,
+		graph:       graph,
+		staleMode:   config.StaleMode,
+		baseline:    config.Baseline,
+		processed:   make(map[string]bool),
+		authorized:  make(map[string]bool),
+		watches:     watches,
+	}
+}
+
+// Executed returns the resources applied or skipped so far, in order
+func (s *Session) Executed() []*model.Resource {
+	return s.executed
+}
+
+// Run steps through the remaining resources of the execution graph
+// Returns ErrAborted if the user aborted the execution, or ErrFailed if
+// the user stopped after a failed step
+func (s *Session) Run() error {
+	s.presenter.PlanLoaded(s.plan, s.graph)
+	s.captureOutputs()
+
+	currentLayer := -1
+	for {
+		layerIndex, resource := s.nextResource()
+		if resource == nil {
+			return nil
+		}
+
+		if layerIndex != currentLayer {
+			s.printf("Executing layer %d of %d\n", layerIndex+1, len(s.graph.Layers))
+			currentLayer = layerIndex
+		}
+
+		// Display resource information
+		s.presenter.StepStarted(resource, len(s.executed)+1, s.totalSteps())
+
+		// Process the user's action for this resource
+		result, err := s.processResourceAction(resource)
+		switch result {
+		case stepProcessed:
+			s.executed = append(s.executed, resource)
+			s.finishGroup(resource)
+			if s.startFollowUp(resource) {
+				break
+			}
+			s.processed[resource.Address] = true
+		case stepReplanned, stepDeferred:
+			currentLayer = -1
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// Cleanup removes the plan files generated while re-planning
+func (s *Session) Cleanup() {
+	util.CleanupFiles(s.tempFiles...)
+}
+
+// nextResource returns the resource jumped to, or else the first resource
+// that still needs a decision, with its layer index
+func (s *Session) nextResource() (int, *model.Resource) {
+	jumpTo := s.jumpTo
+	s.jumpTo = nil
+
+	for layerIndex, layer := range s.graph.Layers {
+		for _, resource := range layer {
+			if jumpTo != nil && resource == jumpTo {
+				return layerIndex, resource
+			}
+		}
+	}
+
+	for layerIndex, layer := range s.graph.Layers {
+		for _, resource := range layer {
+			// Skip resources that are not targeted, if a target is specified
+			if !s.targeted(resource) {
+				continue
+			}
+			if !s.processed[resource.Address] {
+				return layerIndex, resource
+			}
+		}
+	}
+	return -1, nil
+}
+
+// totalSteps returns the number of executed resources plus those still pending
+func (s *Session) totalSteps() int {
+	total := len(s.executed)
+	for _, resource := range s.plan.Resources {
+		if !s.processed[resource.Address] {
+			total++
+		}
+		if resource.FollowUp != "" {
+			total++
+		}
+	}
+	return total
+}
+
+// startFollowUp turns a completed state-only step into the change planned
+// after it. The executed step is kept as a copy, and the resource leaves
+// the state layer to wait for its change at its place in the dependency
+// order. Returns false when there is no change to follow.
+func (s *Session) startFollowUp(resource *model.Resource) bool {
+	if resource.FollowUp == "" || resource.Status != model.StatusComplete {
+		return false
+	}
+
+	step := *resource
+	s.executed[len(s.executed)-1] = &step
+
+	resource.Action, resource.FollowUp = resource.FollowUp, ""
+	resource.Status = model.StatusPending
+	resource.Attempts = nil
+	resource.PriorState = nil
+	if len(s.graph.Layers) > 0 {
+		s.graph.Layers[0] = removeResource(s.graph.Layers[0], resource)
+	}
+
+	s.printf("The %s of %s is done, its %s follows in dependency order.\n", step.Action, resource.Address, resource.Action)
+	return true
+}
+
+// removeResource returns the resources of a layer without the given one
+func removeResource(layer []*model.Resource, resource *model.Resource) []*model.Resource {
+	remaining := make([]*model.Resource, 0, len(layer))
+	for _, item := range layer {
+		if item != resource {
+			remaining = append(remaining, item)
+		}
+	}
+	return remaining
+}
+
+// processResourceAction handles user actions for a resource
+func (s *Session) processResourceAction(resource *model.Resource) (stepResult, error) {
+	var pendingAction model.StepAction
+	for {
+		// Get the user action, unless a retry is pending or we continue to a breakpoint
+		action := pendingAction
+		pendingAction = ""
+		if action == "" {
+			action = s.continueAction(resource)
+		}
+		var argument string
+		if action == "" {
+			answer, err := s.decide(ui.Decision{
+				Kind:     ui.DecisionStep,
+				Resource: resource,
+				Choices:  s.stepChoices(),
+			})
+			if err != nil {
+				return stepPending, err
+			}
+			action, argument = answer.Action, answer.Argument
+		}
+
+		// Handle navigation, which does not change the resource
+		switch action {
+		case model.StepList:
+			s.listRemaining(resource)
+			continue
+		case model.StepSearch:
+			if err := s.search(argument); err != nil {
+				s.errorf("Error: %s\n", err)
+			}
+			continue
+		case model.StepHistory:
+			s.showHistory()
+			continue
+		case model.StepBreak:
+			if err := s.toggleBreakpoint(resource, argument); err != nil {
+				s.errorf("Error: %s\n", err)
+			}
+			continue
+		case model.StepEval:
+			s.eval(argument)
+			continue
+		case model.StepWatch:
+			if argument == "" {
+				s.refreshWatches(s.watches)
+			} else {
+				s.addWatch(argument)
+			}
+			continue
+		case model.StepUnwatch:
+			s.removeWatch(argument)
+			continue
+		case model.StepSnapshots:
+			if err := s.manageSnapshots(resource, argument); err != nil {
+				s.errorf("Error: %s\n", err)
+			}
+			continue
+		case model.StepInspect, model.StepImpact:
+			target := resource
+			if argument != "" {
+				var err error
+				if target, err = s.findResource(argument); err != nil {
+					s.errorf("Error: %s\n", err)
+					continue
+				}
+			}
+			if action == model.StepImpact {
+				s.showImpact(target)
+			} else if err := s.inspect(target); err != nil {
+				s.errorf("Error: %s\n", err)
+			}
+			continue
+		case model.StepPostpone:
+			if !s.postpone(resource) {
+				s.printf("Nothing else is pending in the layer of %s.\n", resource.Address)
+				continue
+			}
+			s.printf("Postponed %s to the end of its layer.\n", resource.Address)
+			s.record(resource.Address, action, "postponed")
+			return stepDeferred, nil
+		case model.StepJump:
+			target, err := s.jump(argument)
+			if err != nil {
+				s.errorf("Error: %s\n", err)
+				continue
+			}
+			if target == resource {
+				continue
+			}
+			s.record(resource.Address, action, "to "+target.Address)
+			return stepDeferred, nil
+		case model.StepTeardown:
+			target, err := s.selectTeardown(resource, argument)
+			if err != nil {
+				s.errorf("Error: %s\n", err)
+				continue
+			}
+			if target == resource {
+				continue
+			}
+			s.record(resource.Address, action, "to "+target.Address)
+			return stepDeferred, nil
+		}
+
+		// Handle abort action
+		if action == model.StepAbort {
+			confirmed, err := s.confirm(ui.DecisionConfirmAbort, resource)
+			if err != nil {
+				return stepPending, err
+			}
+			if confirmed {
+				return stepPending, ErrAborted
+			}
+			continue
+		}
+
+		// Handle continue action, which applies resources until the next breakpoint
+		if action == model.StepContinue {
+			s.continuing = true
+			action = model.StepApply
+		}
+
+		// Handle rollback action, which undoes the applied steps and ends the session
+		if action == model.StepRollback {
+			started, err := s.rollback()
+			if !started {
+				s.errorf("Error: %s\n", err)
+				continue
+			}
+			if err != nil {
+				return stepPending, err
+			}
+			return stepPending, ErrAborted
+		}
+
+		// Handle replan action
+		if action == model.StepReplan {
+			if s.rollingBack {
+				s.errorf("Error: a rollback cannot be re-planned\n")
+				continue
+			}
+			if err := s.replan(); err != nil {
+				s.errorf("Error: %s\n", err)
+				continue
+			}
+			return stepReplanned, nil
+		}
+
+		// Handle detail action, showing the diff and the blast radius
+		if action == model.StepDetail {
+			if err := s.runStep(action, resource); err != nil {
+				s.errorf("Error: %s\n", err)
+			}
+			s.showImpact(resource)
+			continue
+		}
+
+		// Check that the resource may be applied before applying it
+		if action == model.StepApply || action == model.StepRetry {
+			// Terraform destroys the dependents of a destroyed resource too, so they go first
+			if err := s.checkDestroy(resource); err != nil {
+				s.errorf("Error: %s\n", err)
+				s.continuing = false
+				s.record(resource.Address, action, "refused")
+				continue
+			}
+
+			// Blocked resources are never applied, and protected ones need their address typed,
+			// including those torn down with the resource
+			if allowed, err := s.authorizeAll(append([]*model.Resource{resource}, s.groupMembers(resource)...)); !allowed || err != nil {
+				if err != nil {
+					return stepPending, err
+				}
+				s.continuing = false
+				continue
+			}
+
+			// Make sure the plan still matches the state and configuration
+			if result, err := s.checkStaleness(resource); result != stepProcessed || err != nil {
+				return result, err
+			}
+
+			// A failing pre-hook blocks the apply, and the user decides again
+			if err := s.runHooks(hooks.PhasePre, resource); err != nil {
+				s.errorf("Error: %s\nThe apply of %s was blocked.\n", err, resource.Address)
+				s.continuing = false
+				s.record(resource.Address, action, "blocked by hook")
+				continue
+			}
+		}
+
+		// Record the state before the apply, so that the step can be rolled back
+		if action == model.StepApply || action == model.StepRetry {
+			s.snapshotState(resource)
+		}
+
+		// Execute the action
+		startTime := time.Now()
+		err := s.runStep(action, resource)
+		elapsed := time.Since(startTime)
+
+		// A failing post-hook marks the applied resource failed
+		if err == nil && (action == model.StepApply || action == model.StepRetry) {
+			if hookErr := s.runHooks(hooks.PhasePost, resource); hookErr != nil {
+				resource.Status = model.StatusFailed
+				err = hookErr
+			}
+		}
+
+		if action == model.StepApply || action == model.StepRetry {
+			s.updateBaseline()
+		}
+
+		// Display the result
+		s.presenter.StepFinished(resource, err, elapsed)
+		s.record(resource.Address, action, string(resource.Status))
+
+		// Show how the applied step changed the checks, watched expressions and outputs
+		if err == nil && (action == model.StepApply || action == model.StepRetry) && !s.executer.DryRun() {
+			if len(s.plan.Checks) > 0 && !s.skipChecks {
+				s.refreshChecks(resource)
+			}
+			if len(s.watches) > 0 {
+				s.refreshWatches(s.watches)
+			}
+			if len(s.plan.Outputs) > 0 {
+				s.refreshOutputs(resource)
+			}
+		}
+
+		// Stop continuing to the next breakpoint when a step fails
+		if err != nil {
+			s.continuing = false
+		}
+
+		// If the step was interrupted, offer to retry, skip or abort
+		if executor.IsInterrupted(err) {
+			s.errorf("Error: %s\n", err)
+			next, err := s.handleInterruptedStep(resource)
+			if next == model.StepRetry {
+				pendingAction = next
+				continue
+			}
+			return stepProcessed, err
+		}
+
+		// If there was an error, ask if the user wants to continue
+		if err != nil {
+			s.errorf("Error: %s\n", err)
+			confirmed, err := s.confirm(ui.DecisionContinue, resource)
+			if err != nil {
+				return stepProcessed, err
+			}
+			if !confirmed {
+				return stepProcessed, ErrFailed
+			}
+		}
+
+		return stepProcessed, nil
+	}
+}
+
+// stepChoices returns the actions offered for the current resource. A
+// rollback can neither be re-planned nor rolled back itself, and subtrees are
+// only torn down in destroy plans.
+func (s *Session) stepChoices() []model.StepAction {
+	choices := []model.StepAction{model.StepApply, model.StepSkip, model.StepDetail, model.StepInspect, model.StepImpact,
+		model.StepEval, model.StepWatch, model.StepUnwatch, model.StepPostpone, model.StepJump, model.StepList, model.StepSearch, model.StepHistory,
+		model.StepSnapshots, model.StepBreak}
+	if !s.rollingBack {
+		choices = append(choices, model.StepReplan, model.StepRollback)
+		if s.plan.Mode == model.ModeDestroy {
+			choices = append(choices, model.StepTeardown)
+		}
+	}
+	return append(choices, model.StepContinue, model.StepAbort)
+}
+
+// continueAction returns the apply action while continuing to a breakpoint,
+// or an empty action when the user has to decide
+func (s *Session) continueAction(resource *model.Resource) model.StepAction {
+	if !s.continuing {
+		return ""
+	}
+	if resource.Breakpoint {
+		s.printf("Breakpoint reached at %s\n", resource.Address)
+		s.continuing = false
+		return ""
+	}
+	return model.StepApply
+}
+
+// runStep executes a step action with a context that is cancelled on interrupt
+func (s *Session) runStep(action model.StepAction, resource *model.Resource) error {
+	ctx, cancel := s.stepContext()
+	defer cancel()
+
+	return s.executer.ExecuteStepAction(ctx, action, resource)
+}
+
+// handleInterruptedStep asks the user how to proceed after a cancelled or timed out step.
+// A skipped step keeps its interrupted status so it shows up in the summary.
+func (s *Session) handleInterruptedStep(resource *model.Resource) (model.StepAction, error) {
+	for {
+		answer, err := s.decide(ui.Decision{
+			Kind:     ui.DecisionInterrupted,
+			Resource: resource,
+			Choices:  []model.StepAction{model.StepRetry, model.StepSkip, model.StepAbort},
+		})
+		if err != nil {
+			return model.StepAbort, err
+		}
+
+		switch action := answer.Action; action {
+		case model.StepRetry:
+			return action, nil
+		case model.StepSkip:
+			s.printf("Skipping resource: %s\n", resource.Address)
+			return action, nil
+		case model.StepAbort:
+			confirmed, err := s.confirm(ui.DecisionConfirmAbort, resource)
+			if err != nil {
+				return action, err
+			}
+			if confirmed {
+				return action, ErrAborted
+			}
+		}
+	}
+}
+
+// checkStaleness compares the state and configuration with the plan's baseline.
+// Returns stepProcessed when the step may go ahead.
+func (s *Session) checkStaleness(resource *model.Resource) (stepResult, error) {
+	if s.baseline == nil {
+		return stepProcessed, nil
+	}
+
+	ctx, cancel := s.stepContext()
+	reasons, err := s.executer.CheckStaleness(ctx, s.baseline)
+	cancel()
+	if err != nil {
+		s.errorf("Warning: could not check whether the plan is stale: %s\n", err)
+		return stepProcessed, nil
+	}
+	if len(reasons) == 0 {
+		return stepProcessed, nil
+	}
+
+	choices := []model.StepAction{model.StepReplan, model.StepAbort}
+	if s.staleMode == executor.StaleCheckWarn {
+		choices = append([]model.StepAction{model.StepContinue}, choices...)
+	}
+
+	for {
+		answer, err := s.decide(ui.Decision{
+			Kind:     ui.DecisionStale,
+			Resource: resource,
+			Choices:  choices,
+			Reasons:  reasons,
+		})
+		if err != nil {
+			return stepPending, err
+		}
+
+		switch answer.Action {
+		case model.StepContinue:
+			// Accept the changes so the same reasons are not reported again
+			s.acceptBaseline()
+			return stepProcessed, nil
+		case model.StepReplan:
+			if err := s.replan(); err != nil {
+				s.errorf("Error: %s\n", err)
+				continue
+			}
+			return stepReplanned, nil
+		case model.StepAbort:
+			confirmed, err := s.confirm(ui.DecisionConfirmAbort, resource)
+			if err != nil {
+				return stepPending, err
+			}
+			if confirmed {
+				return stepPending, ErrAborted
+			}
+		}
+	}
+}
+
+// updateBaseline records the state written by a step of this session
+func (s *Session) updateBaseline() {
+	if s.baseline == nil || s.executer.DryRun() {
+		return
+	}
+
+	ctx, cancel := s.stepContext()
+	defer cancel()
+	if err := s.executer.UpdateBaselineState(ctx, s.baseline); err != nil {
+		s.errorf("Warning: could not record the state after the step: %s\n", err)
+	}
+}
+
+// acceptBaseline takes the current state and configuration as the new baseline
+func (s *Session) acceptBaseline() {
+	hashes, err := util.HashConfigFiles(s.plan.TerraformDir, s.inputs.VarFiles)
+	if err != nil {
+		s.errorf("Warning: %s\n", err)
+		return
+	}
+	s.baseline.ConfigHashes = hashes
+	s.updateBaseline()
+}
+
+// replan generates a fresh plan with the same inputs and replaces the
+// remaining steps with the changes it contains. Resources that were already
+// applied or skipped in this session are not stepped through again, failed
+// ones are.
+func (s *Session) replan() error {
+	planFile, err := util.CreateTempPlanFile()
+	if err != nil {
+		return err
+	}
+	s.tempFiles = append(s.tempFiles, planFile)
+
+	hashes, err := util.HashConfigFiles(s.plan.TerraformDir, s.inputs.VarFiles)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := s.stepContext()
+	defer cancel()
+
+	s.printf("Generating a new Terraform plan to %s...\n", planFile)
+	if err := s.planner.GeneratePlan(ctx, s.plan.TerraformDir, planFile, s.inputs); err != nil {
+		return fmt.Errorf("error generating plan: %w", err)
+	}
+
+	plan, err := s.planner.ParsePlan(planFile, s.plan.TerraformDir)
+	if err != nil {
+		return fmt.Errorf("error parsing plan: %w", err)
+	}
+	plan.Workspace = s.plan.Workspace
+	plan.Backend = s.plan.Backend
+	s.protection.Apply(plan)
+	s.risk.Apply(plan)
+	diff := parser.RemapResources(s.plan, plan, s.decided())
+
+	// Steps that failed or were interrupted can be tried again, as long as
+	// the fresh plan still contains their changes
+	var reopened []string
+	for address := range s.processed {
+		previous, ok := s.plan.ResourcesMap[address]
+		if _, planned := plan.ResourcesMap[address]; ok && planned && !decidedStatus(previous) {
+			s.reopen(previous)
+			reopened = append(reopened, address)
+		}
+	}
+	sort.Strings(reopened)
+
+	if s.baseline != nil {
+		baseline, err := s.executer.CaptureBaseline(ctx, plan, hashes)
+		if err != nil {
+			return err
+		}
+		s.baseline = baseline
+	}
+
+	s.plan = plan
+	s.graph = s.planner.BuildExecutionGraph(plan)
+	risk.SortLayers(s.graph, s.riskOrder)
+	s.executer.SetPlanFile(planFile)
+
+	s.presenter.PlanReplanned(s.plan, s.graph, diff)
+	if len(reopened) > 0 {
+		s.printf("Steps that did not complete are pending again: %s\n", strings.Join(reopened, ", "))
+	}
+	_, err = s.decide(ui.Decision{Kind: ui.DecisionAcknowledge, Choices: []model.StepAction{model.StepYes}})
+	return err
+}
+
+// decided returns the addresses of the resources that were applied or
+// skipped in this session, which keep their decision after re-planning
+func (s *Session) decided() map[string]bool {
+	decided := make(map[string]bool, len(s.processed))
+	for address := range s.processed {
+		if resource, ok := s.plan.ResourcesMap[address]; ok && decidedStatus(resource) {
+			decided[address] = true
+		}
+	}
+	return decided
+}
+
+// decidedStatus reports whether the resource was applied or skipped, rather
+// than failing or being interrupted
+func decidedStatus(resource *model.Resource) bool {
+	return resource.Status == model.StatusComplete || resource.Status == model.StatusSkipped
+}
+
+// decide asks the presenter for a decision
+func (s *Session) decide(decision ui.Decision) (ui.Answer, error) {
+	answer, err := s.presenter.RequestDecision(decision)
+	if err != nil {
+		return ui.Answer{}, fmt.Errorf("no answer to the %s decision: %w", decision.Kind, err)
+	}
+	return answer, nil
+}
+
+// confirm asks the presenter a yes or no question about the resource
+func (s *Session) confirm(kind ui.DecisionKind, resource *model.Resource) (bool, error) {
+	answer, err := s.decide(ui.Decision{
+		Kind:     kind,
+		Resource: resource,
+		Choices:  []model.StepAction{model.StepYes, model.StepNo},
+	})
+	return answer.Action == model.StepYes, err
+}
+
+// printf passes a progress message to the presenter
+func (s *Session) printf(format string, args ...any) {
+	s.presenter.Output(ui.StreamOutput, fmt.Sprintf(format, args...))
+}
+
+// errorf passes an error or warning message to the presenter
+func (s *Session) errorf(format string, args ...any) {
+	s.presenter.Output(ui.StreamError, fmt.Sprintf(format, args...))
+}
@@ -0,0 +1,627 @@
+package session
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/marc-poljak/terraform-step-debug/internal/executor"
+	"github.com/marc-poljak/terraform-step-debug/internal/model"
+	"github.com/marc-poljak/terraform-step-debug/internal/parser"
+	"github.com/marc-poljak/terraform-step-debug/internal/snapshot"
+	"github.com/marc-poljak/terraform-step-debug/internal/ui"
+)
+
+// fakeExecutor applies steps without Terraform, and records what it applied
+type fakeExecutor struct {
+	applied  []string       // Applied addresses, with the addresses torn down together
+	failures map[string]int // Number of times the apply of an address fails
+	cancels  map[string]int // Number of times the apply of an address is interrupted
+	state    []byte         // Current state, nil for a fixed empty state
+	lineage  string         // Lineage the state gets on the next apply, if set
+	pushed   int            // Number of states pushed
+}
+
+func (e *fakeExecutor) ExecuteStepAction(ctx context.Context, action model.StepAction, resource *model.Resource) error {
+	switch action {
+	case model.StepApply, model.StepRetry:
+		if e.cancels[resource.Address] > 0 {
+			e.cancels[resource.Address]--
+			resource.Status = model.StatusCanceled
+			return fmt.Errorf("apply of resource %s was interrupted: %w", resource.Address, context.Canceled)
+		}
+		if e.failures[resource.Address] > 0 {
+			e.failures[resource.Address]--
+			resource.Status = model.StatusFailed
+			return fmt.Errorf("failed to apply resource %s", resource.Address)
+		}
+		e.applied = append(e.applied, strings.Join(append([]string{resource.Address}, resource.Group...), "+"))
+		resource.Status = model.StatusComplete
+		if e.state != nil {
+			e.state = stateWith(e.state, resource.Address, e.lineage)
+		}
+	case model.StepSkip:
+		resource.Status = model.StatusSkipped
+	}
+	return nil
+}
+
+func (e *fakeExecutor) CaptureBaseline(context.Context, *model.Plan, map[string]string) (*executor.Baseline, error) {
+	return &executor.Baseline{}, nil
+}
+
+func (e *fakeExecutor) UpdateBaselineState(context.Context, *executor.Baseline) error { return nil }
+
+func (e *fakeExecutor) CheckStaleness(context.Context, *executor.Baseline) ([]string, error) {
+	return nil, nil
+}
+
+func (e *fakeExecutor) ResourceState(context.Context, string) (map[string]any, bool, error) {
+	return nil, false, nil
+}
+
+func (e *fakeExecutor) PullState(context.Context) ([]byte, error) {
+	if e.state != nil {
+		return e.state, nil
+	}
+	return []byte(`{"version": 4, "serial": 1, "lineage": "test"}`), nil
+}
+
+func (e *fakeExecutor) PushState(_ context.Context, data []byte) error {
+	e.state = data
+	e.pushed++
+	return nil
+}
+
+// stateWith returns the state with the resource added and the next serial,
+// and with a new lineage if one is given
+func stateWith(data []byte, address, lineage string) []byte {
+	var state map[string]any
+	if err := json.Unmarshal(data, &state); err != nil {
+		panic(err)
+	}
+	resourceType, name, _ := strings.Cut(address, ".")
+	resources, _ := state["resources"].([]any)
+	state["resources"] = append(resources, map[string]any{
+		"mode":      "managed",
+		"type":      resourceType,
+		"name":      name,
+		"instances": []any{map[string]any{"attributes": map[string]any{"id": address}}},
+	})
+	state["serial"] = state["serial"].(float64) + 1
+	if lineage != "" {
+		state["lineage"] = lineage
+	}
+	data, err := json.Marshal(state)
+	if err != nil {
+		panic(err)
+	}
+	return data
+}
+
+func (e *fakeExecutor) Evaluate(_ context.Context, expression string) (string, error) {
+	return expression, nil
+}
+
+func (e *fakeExecutor) Outputs(context.Context) (map[string]executor.OutputValue, error) {
+	return nil, nil
+}
+
+func (e *fakeExecutor) SetPlanFile(string) {}
+
+func (e *fakeExecutor) DryRun() bool { return false }
+
+// fakePlanner returns a fresh plan from a function when re-planning, and
+// builds execution graphs like the Terraform plan parser
+type fakePlanner struct {
+	*parser.TerraformPlanParser
+	next        func() *model.Plan
+	checks      []*model.Check // Results of every check evaluation
+	evaluations int            // Number of check evaluations
+}
+
+func (p *fakePlanner) GeneratePlan(context.Context, string, string, model.Inputs) error {
+	return nil
+}
+
+func (p *fakePlanner) ParsePlan(string, string) (*model.Plan, error) {
+	return p.next(), nil
+}
+
+func (p *fakePlanner) EvaluateChecks(context.Context, string, model.Inputs) ([]*model.Check, error) {
+	p.evaluations++
+	return p.checks, nil
+}
+
+// testPlan returns a plan of resources given as "action address" with the
+// addresses they depend on
+func testPlan(t *testing.T, mode model.PlanMode, resources ...[]string) *model.Plan {
+	t.Helper()
+	plan := model.NewPlan("", t.TempDir())
+	plan.Mode = mode
+	for _, spec := range resources {
+		action, address, _ := strings.Cut(spec[0], " ")
+		resourceType, name, _ := strings.Cut(address, ".")
+		resource := &model.Resource{
+			Address:      address,
+			Type:         resourceType,
+			Name:         name,
+			Action:       model.Action(action),
+			Dependencies: spec[1:],
+			Status:       model.StatusPending,
+		}
+		plan.Resources = append(plan.Resources, resource)
+		plan.ResourcesMap[address] = resource
+	}
+	plan.HasChanges = len(plan.Resources) > 0
+	return plan
+}
+
+// chainPlan returns a plan of three resources, each depending on the one
+// before, so the steps come in a fixed order
+func chainPlan(t *testing.T, mode model.PlanMode, action model.Action) *model.Plan {
+	return testPlan(t, mode,
+		[]string{string(action) + " null_resource.a"},
+		[]string{string(action) + " null_resource.b", "null_resource.a"},
+		[]string{string(action) + " null_resource.c", "null_resource.b"},
+	)
+}
+
+// runTest sets up a session through the plan, answered by the script
+func runTest(t *testing.T, plan *model.Plan, next func() *model.Plan, answers ...string) (*Session, *fakeExecutor, *ui.ScriptedPresenter) {
+	t.Helper()
+	planner := &fakePlanner{TerraformPlanParser: parser.NewTerraformPlanParser(""), next: next}
+	exec := &fakeExecutor{failures: make(map[string]int), cancels: make(map[string]int)}
+	presenter := ui.NewScriptedPresenter(answers, nil)
+
+	s := New(Config{
+		Presenter:        presenter,
+		Executor:         exec,
+		Planner:          planner,
+		RollbackExecutor: exec,
+	}, plan, planner.BuildExecutionGraph(plan))
+	return s, exec, presenter
+}
+
+// outputText returns the progress messages and errors of a session
+func outputText(presenter *ui.ScriptedPresenter) string {
+	var b strings.Builder
+	for _, event := range presenter.Events() {
+		if event.Type == "output" {
+			b.WriteString(event.Text)
+		}
+	}
+	return b.String()
+}
+
+// statuses returns the status of every resource of the plan by address
+func statuses(plan *model.Plan) map[string]model.ResourceStatus {
+	result := make(map[string]model.ResourceStatus)
+	for _, resource := range plan.Resources {
+		result[resource.Address] = resource.Status
+	}
+	return result
+}
+
+func TestRun(t *testing.T) {
+	tests := []struct {
+		name     string
+		answers  []string
+		failures map[string]int
+		cancels  map[string]int
+		wantErr  error
+		applied  []string
+		statuses map[string]model.ResourceStatus
+	}{
+		{
+			name:     "apply and skip",
+			answers:  []string{"apply", "skip", "apply"},
+			applied:  []string{"null_resource.a", "null_resource.c"},
+			statuses: map[string]model.ResourceStatus{"null_resource.a": "complete", "null_resource.b": "skipped", "null_resource.c": "complete"},
+		},
+		{
+			name:     "continue after a failure",
+			answers:  []string{"apply", "yes", "apply", "apply"},
+			failures: map[string]int{"null_resource.a": 1},
+			applied:  []string{"null_resource.b", "null_resource.c"},
+			statuses: map[string]model.ResourceStatus{"null_resource.a": "failed", "null_resource.b": "complete", "null_resource.c": "complete"},
+		},
+		{
+			name:     "stop after a failure",
+			answers:  []string{"apply", "apply", "no"},
+			failures: map[string]int{"null_resource.b": 1},
+			wantErr:  ErrFailed,
+			applied:  []string{"null_resource.a"},
+			statuses: map[string]model.ResourceStatus{"null_resource.a": "complete", "null_resource.b": "failed", "null_resource.c": "pending"},
+		},
+		{
+			name:     "abort",
+			answers:  []string{"apply", "abort", "yes"},
+			wantErr:  ErrAborted,
+			applied:  []string{"null_resource.a"},
+			statuses: map[string]model.ResourceStatus{"null_resource.a": "complete", "null_resource.b": "pending", "null_resource.c": "pending"},
+		},
+		{
+			name:     "continue to a breakpoint",
+			answers:  []string{"break null_resource.c", "continue", "skip"},
+			applied:  []string{"null_resource.a", "null_resource.b"},
+			statuses: map[string]model.ResourceStatus{"null_resource.a": "complete", "null_resource.b": "complete", "null_resource.c": "skipped"},
+		},
+		{
+			name:     "retry after an interruption",
+			answers:  []string{"apply", "retry", "apply", "apply"},
+			cancels:  map[string]int{"null_resource.a": 1},
+			applied:  []string{"null_resource.a", "null_resource.b", "null_resource.c"},
+			statuses: map[string]model.ResourceStatus{"null_resource.a": "complete", "null_resource.b": "complete", "null_resource.c": "complete"},
+		},
+		{
+			name:     "abort after an interruption",
+			answers:  []string{"apply", "apply", "abort", "yes"},
+			cancels:  map[string]int{"null_resource.b": 1},
+			wantErr:  ErrAborted,
+			applied:  []string{"null_resource.a"},
+			statuses: map[string]model.ResourceStatus{"null_resource.a": "complete", "null_resource.b": "canceled", "null_resource.c": "pending"},
+		},
+		{
+			name:     "continue to the end",
+			answers:  []string{"continue"},
+			applied:  []string{"null_resource.a", "null_resource.b", "null_resource.c"},
+			statuses: map[string]model.ResourceStatus{"null_resource.a": "complete", "null_resource.b": "complete", "null_resource.c": "complete"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plan := chainPlan(t, model.ModeNormal, model.ActionCreate)
+			s, exec, _ := runTest(t, plan, nil, tt.answers...)
+			for address, count := range tt.failures {
+				exec.failures[address] = count
+			}
+			for address, count := range tt.cancels {
+				exec.cancels[address] = count
+			}
+
+			if err := s.Run(); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Run() = %v, want %v", err, tt.wantErr)
+			}
+			if strings.Join(exec.applied, ",") != strings.Join(tt.applied, ",") {
+				t.Errorf("applied %v, want %v", exec.applied, tt.applied)
+			}
+			for address, want := range tt.statuses {
+				if got := statuses(plan)[address]; got != want {
+					t.Errorf("%s is %s, want %s", address, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestReplan(t *testing.T) {
+	tests := []struct {
+		name     string
+		answers  []string
+		failures map[string]int
+		applied  []string
+	}{
+		{
+			name:    "applied steps keep their decision",
+			answers: []string{"apply", "replan", "apply", "apply"},
+			applied: []string{"null_resource.a", "null_resource.b", "null_resource.c"},
+		},
+		{
+			name:    "skipped steps keep their decision",
+			answers: []string{"skip", "replan", "apply", "apply"},
+			applied: []string{"null_resource.b", "null_resource.c"},
+		},
+		{
+			name:     "failed steps are pending again",
+			answers:  []string{"apply", "yes", "replan", "apply", "apply", "apply"},
+			failures: map[string]int{"null_resource.a": 1},
+			applied:  []string{"null_resource.a", "null_resource.b", "null_resource.c"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plan := chainPlan(t, model.ModeNormal, model.ActionCreate)
+			next := func() *model.Plan {
+				fresh := chainPlan(t, model.ModeNormal, model.ActionCreate)
+				fresh.TerraformDir = plan.TerraformDir
+				return fresh
+			}
+			s, exec, presenter := runTest(t, plan, next, tt.answers...)
+			defer s.Cleanup()
+			for address, count := range tt.failures {
+				exec.failures[address] = count
+			}
+
+			if err := s.Run(); err != nil {
+				t.Fatalf("Run() = %v\n%s", err, outputText(presenter))
+			}
+			if strings.Join(exec.applied, ",") != strings.Join(tt.applied, ",") {
+				t.Errorf("applied %v, want %v", exec.applied, tt.applied)
+			}
+		})
+	}
+}
+
+func TestJump(t *testing.T) {
+	tests := []struct {
+		name    string
+		answers []string
+		applied []string
+		output  string
+	}{
+		{
+			name:    "refused while dependencies are pending",
+			answers: []string{"jump null_resource.c", "apply", "apply", "apply"},
+			applied: []string{"null_resource.a", "null_resource.b", "null_resource.c"},
+			output:  "null_resource.c depends on pending resources: null_resource.b",
+		},
+		{
+			name:    "revisits a skipped resource",
+			answers: []string{"skip", "jump null_resource.a", "apply", "apply", "apply"},
+			applied: []string{"null_resource.a", "null_resource.b", "null_resource.c"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plan := chainPlan(t, model.ModeNormal, model.ActionCreate)
+			s, exec, presenter := runTest(t, plan, nil, tt.answers...)
+
+			if err := s.Run(); err != nil {
+				t.Fatalf("Run() = %v\n%s", err, outputText(presenter))
+			}
+			if strings.Join(exec.applied, ",") != strings.Join(tt.applied, ",") {
+				t.Errorf("applied %v, want %v", exec.applied, tt.applied)
+			}
+			if !strings.Contains(outputText(presenter), tt.output) {
+				t.Errorf("output does not contain %q:\n%s", tt.output, outputText(presenter))
+			}
+		})
+	}
+}
+
+func TestTeardown(t *testing.T) {
+	tests := []struct {
+		name     string
+		answers  []string
+		applied  []string
+		output   string
+		statuses map[string]model.ResourceStatus
+	}{
+		{
+			name:     "leaves first",
+			answers:  []string{"apply", "apply", "apply"},
+			applied:  []string{"null_resource.c", "null_resource.b", "null_resource.a"},
+			statuses: map[string]model.ResourceStatus{"null_resource.a": "complete", "null_resource.b": "complete", "null_resource.c": "complete"},
+		},
+		{
+			name:     "destroy refused while a dependent is left",
+			answers:  []string{"skip", "apply", "skip", "skip"},
+			output:   "destroying null_resource.b would also destroy what depends on it and was not destroyed: null_resource.c",
+			statuses: map[string]model.ResourceStatus{"null_resource.a": "skipped", "null_resource.b": "skipped", "null_resource.c": "skipped"},
+		},
+		{
+			name:     "subtree torn down together",
+			answers:  []string{"skip", "teardown", "apply", "apply"},
+			applied:  []string{"null_resource.b+null_resource.c", "null_resource.a"},
+			statuses: map[string]model.ResourceStatus{"null_resource.a": "complete", "null_resource.b": "complete", "null_resource.c": "complete"},
+		},
+		{
+			name:     "teardown of another resource",
+			answers:  []string{"teardown null_resource.a", "apply"},
+			applied:  []string{"null_resource.a+null_resource.b+null_resource.c"},
+			statuses: map[string]model.ResourceStatus{"null_resource.a": "complete", "null_resource.b": "complete", "null_resource.c": "complete"},
+		},
+		{
+			name:     "jump refused while dependents are pending",
+			answers:  []string{"jump null_resource.a", "apply", "apply", "apply"},
+			applied:  []string{"null_resource.c", "null_resource.b", "null_resource.a"},
+			output:   "use teardown to destroy them together",
+			statuses: map[string]model.ResourceStatus{"null_resource.a": "complete", "null_resource.b": "complete", "null_resource.c": "complete"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plan := chainPlan(t, model.ModeDestroy, model.ActionDelete)
+			s, exec, presenter := runTest(t, plan, nil, tt.answers...)
+
+			if err := s.Run(); err != nil {
+				t.Fatalf("Run() = %v\n%s", err, outputText(presenter))
+			}
+			if strings.Join(exec.applied, ",") != strings.Join(tt.applied, ",") {
+				t.Errorf("applied %v, want %v", exec.applied, tt.applied)
+			}
+			if !strings.Contains(outputText(presenter), tt.output) {
+				t.Errorf("output does not contain %q:\n%s", tt.output, outputText(presenter))
+			}
+			for address, want := range tt.statuses {
+				if got := statuses(plan)[address]; got != want {
+					t.Errorf("%s is %s, want %s", address, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestRollback(t *testing.T) {
+	tests := []struct {
+		name    string
+		answers []string
+		applied []string
+		output  string
+	}{
+		{
+			name:    "latest first",
+			answers: []string{"apply", "apply", "rollback", "apply", "apply"},
+			applied: []string{"null_resource.a", "null_resource.b", "null_resource.b", "null_resource.a"},
+			output:  "Rollback finished: 2 undone, 0 restored in state only, 0 skipped, 0 failed.",
+		},
+		{
+			name:    "dependents that were not rolled back are kept",
+			answers: []string{"apply", "apply", "rollback", "skip", "apply", "skip"},
+			applied: []string{"null_resource.a", "null_resource.b"},
+			output:  "rolling back null_resource.a would also destroy what depends on it and was not rolled back: null_resource.b",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plan := chainPlan(t, model.ModeNormal, model.ActionCreate)
+			s, exec, presenter := runTest(t, plan, nil, tt.answers...)
+
+			if err := s.Run(); !errors.Is(err, ErrAborted) {
+				t.Fatalf("Run() = %v, want %v\n%s", err, ErrAborted, outputText(presenter))
+			}
+			if strings.Join(exec.applied, ",") != strings.Join(tt.applied, ",") {
+				t.Errorf("applied %v, want %v", exec.applied, tt.applied)
+			}
+			if !strings.Contains(outputText(presenter), tt.output) {
+				t.Errorf("output does not contain %q:\n%s", tt.output, outputText(presenter))
+			}
+		})
+	}
+}
+
+func TestRecheck(t *testing.T) {
+	tests := []struct {
+		name        string
+		skipChecks  bool
+		evaluations int
+	}{
+		{name: "after every applied step", evaluations: 2},
+		{name: "turned off", skipChecks: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plan := chainPlan(t, model.ModeNormal, model.ActionCreate)
+			check := &model.Check{Address: "null_resource.a", Kind: "resource", Status: model.CheckUnknown}
+			plan.Checks = []*model.Check{check}
+			plan.ResourcesMap["null_resource.a"].Checks = []*model.Check{check}
+
+			s, _, presenter := runTest(t, plan, nil, "apply", "skip", "apply")
+			s.skipChecks = tt.skipChecks
+			planner := s.planner.(*fakePlanner)
+			planner.checks = []*model.Check{{Address: "null_resource.a", Kind: "resource", Status: model.CheckPass}}
+			if err := s.Run(); err != nil {
+				t.Fatalf("Run: %v", err)
+			}
+
+			if planner.evaluations != tt.evaluations {
+				t.Errorf("evaluations = %d, want %d", planner.evaluations, tt.evaluations)
+			}
+
+			// The check results follow the result of the step they belong to
+			var events []string
+			for _, event := range presenter.Events() {
+				switch {
+				case event.Type == "step_finished" && event.Address == "null_resource.a":
+					events = append(events, "finished")
+				case event.Type == "output" && strings.Contains(event.Text, "[pass] null_resource.a (was unknown)"):
+					events = append(events, "checks")
+				}
+			}
+			want := "finished checks"
+			if tt.skipChecks {
+				want = "finished"
+			}
+			if got := strings.Join(events, " "); got != want {
+				t.Errorf("events = %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestRestoreSnapshot(t *testing.T) {
+	tests := []struct {
+		name     string
+		answers  []string
+		failures map[string]int
+		lineage  string // Lineage of the state after an apply, if it changes
+		pushed   int
+		state    []string // Resources in the state at the end
+		output   string
+	}{
+		{
+			name:    "confirmed",
+			answers: []string{"apply", "apply", "snapshots restore 1", "yes", "skip"},
+			pushed:  1,
+			output:  "Restored snapshot 1. The previous state was saved as snapshot 3.",
+		},
+		{
+			name:    "declined",
+			answers: []string{"apply", "apply", "snapshots restore 1", "no", "skip"},
+			state:   []string{"null_resource.a", "null_resource.b"},
+			output:  "The state was not changed.",
+		},
+		{
+			name:     "already the current state",
+			answers:  []string{"apply", "yes", "snapshots restore 1", "skip", "skip"},
+			failures: map[string]int{"null_resource.a": 1},
+			output:   "The resources in the current state already match snapshot 1.",
+		},
+		{
+			name:    "other lineage",
+			answers: []string{"apply", "apply", "snapshots restore 1", "skip"},
+			lineage: "other",
+			state:   []string{"null_resource.a", "null_resource.b"},
+			output:  "snapshot 1 cannot be restored: the state lineage differs from the current state",
+		},
+		{
+			name:    "unknown snapshot",
+			answers: []string{"apply", "apply", "snapshots restore 5", "skip"},
+			state:   []string{"null_resource.a", "null_resource.b"},
+			output:  "no snapshot 5 (there are 2)",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plan := chainPlan(t, model.ModeNormal, model.ActionCreate)
+			s, exec, presenter := runTest(t, plan, nil, tt.answers...)
+			exec.state = []byte(`{"version": 4, "serial": 1, "lineage": "test", "resources": []}`)
+			exec.lineage = tt.lineage
+			for address, count := range tt.failures {
+				exec.failures[address] = count
+			}
+			store, err := snapshot.NewStore(t.TempDir())
+			if err != nil {
+				t.Fatal(err)
+			}
+			s.snapshots = store
+
+			if err := s.Run(); err != nil {
+				t.Fatalf("Run: %v\n%s", err, outputText(presenter))
+			}
+			if !strings.Contains(outputText(presenter), tt.output) {
+				t.Errorf("output does not contain %q:\n%s", tt.output, outputText(presenter))
+			}
+			if exec.pushed != tt.pushed {
+				t.Errorf("pushed %d states, want %d", exec.pushed, tt.pushed)
+			}
+
+			instances, err := executor.StateInstances(exec.state)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var state []string
+			for address := range instances {
+				state = append(state, address)
+			}
+			sort.Strings(state)
+			if strings.Join(state, ",") != strings.Join(tt.state, ",") {
+				t.Errorf("state has %v, want %v", state, tt.state)
+			}
+
+			// A restore pushes the next serial, and keeps what it replaced
+			info, err := executor.ParseStateInfo(exec.state)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.pushed > 0 && (info.Serial != 4 || len(store.List()) != 3 || store.List()[2].Serial != 3) {
+				t.Errorf("serial %d with %d snapshots, want serial 4 with the replaced serial 3 saved", info.Serial, len(store.List()))
+			}
+		})
+	}
+}
@@ -0,0 +1,224 @@
+package session
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/marc-poljak/terraform-step-debug/internal/executor"
+	"github.com/marc-poljak/terraform-step-debug/internal/model"
+	"github.com/marc-poljak/terraform-step-debug/internal/snapshot"
+	"github.com/marc-poljak/terraform-step-debug/internal/ui"
+)
+
+// snapshotState pulls the state before a resource is applied. It is saved
+// as a snapshot of the session, and kept with the resource so that a
+// rollback can restore it. A retry keeps the state recorded before the
+// first attempt, and gets a snapshot of its own.
+func (s *Session) snapshotState(resource *model.Resource) {
+	keepPrior := s.rollbacker != nil && !s.rollingBack && resource.PriorState == nil
+	if s.executer.DryRun() || (s.snapshots == nil && !keepPrior) {
+		return
+	}
+
+	ctx, cancel := s.stepContext()
+	defer cancel()
+	state, err := s.executer.PullState(ctx)
+	if err != nil {
+		s.errorf("Warning: could not record the state before the step, it cannot be restored: %s\n", err)
+		return
+	}
+	if keepPrior {
+		resource.PriorState = state
+	}
+
+	if s.snapshots != nil {
+		saved, err := s.snapshots.Save(resource.Address, state)
+		if err != nil {
+			s.errorf("Warning: %s\n", err)
+			return
+		}
+		s.printf("Saved state snapshot %d (serial %d).\n", saved.Number, saved.Serial)
+	}
+}
+
+// manageSnapshots runs a snapshot command: an empty argument or "list"
+// lists the snapshots, "diff <a> [b]" compares two snapshots or a snapshot
+// with the current state, and "restore <n>" pushes a snapshot as the state
+func (s *Session) manageSnapshots(resource *model.Resource, argument string) error {
+	if s.snapshots == nil {
+		return errors.New("state snapshots are turned off")
+	}
+
+	fields := strings.Fields(argument)
+	command := "list"
+	if len(fields) > 0 {
+		command = fields[0]
+	}
+
+	switch {
+	case command == "list" && len(fields) <= 1:
+		s.listSnapshots()
+		return nil
+	case command == "diff" && (len(fields) == 2 || len(fields) == 3):
+		to := "current"
+		if len(fields) == 3 {
+			to = fields[2]
+		}
+		return s.diffSnapshots(fields[1], to)
+	case command == "restore" && len(fields) == 2:
+		return s.restoreSnapshot(resource, fields[1])
+	default:
+		return fmt.Errorf("unknown snapshot command %q (use list, diff <a> [b] or restore <n>)", argument)
+	}
+}
+
+// listSnapshots prints the snapshots taken in this session
+func (s *Session) listSnapshots() {
+	snapshots := s.snapshots.List()
+	if len(snapshots) == 0 {
+		s.printf("No snapshots taken yet. They are saved to %s before every apply step.\n", s.snapshots.Dir())
+		return
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "State snapshots in %s:\n", s.snapshots.Dir())
+	for _, item := range snapshots {
+		fmt.Fprintf(&b, "  %3d. %s  serial %-5d before %s  (%s, sha256 %s)\n", item.Number, item.Time.Format("15:04:05"),
+			item.Serial, item.Address, item.File, item.Checksum[:12])
+	}
+	s.printf("%s", b.String())
+}
+
+// diffSnapshots prints how the resources differ between two snapshots,
+// either of which may be the current state
+func (s *Session) diffSnapshots(from, to string) error {
+	before, err := s.readSnapshot(from)
+	if err != nil {
+		return err
+	}
+	after, err := s.readSnapshot(to)
+	if err != nil {
+		return err
+	}
+	changes, err := snapshot.Diff(before, after)
+	if err != nil {
+		return err
+	}
+
+	s.printf("Differences from %s to %s:\n%s", snapshotName(from), snapshotName(to), formatChanges(changes))
+	return nil
+}
+
+// restoreSnapshot pushes a snapshot as the current state, after showing
+// what changes and asking for confirmation. The current state is saved as
+// a snapshot first, so that the restore can be undone.
+func (s *Session) restoreSnapshot(resource *model.Resource, number string) error {
+	if s.executer.DryRun() {
+		return errors.New("snapshots cannot be restored in dry-run mode")
+	}
+	if number == "current" {
+		return errors.New("choose a snapshot number to restore")
+	}
+	data, err := s.readSnapshot(number)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := s.stepContext()
+	current, err := s.executer.PullState(ctx)
+	cancel()
+	if err != nil {
+		return err
+	}
+	restored, err := executor.ReplaceState(current, data)
+	if err != nil {
+		return fmt.Errorf("snapshot %s cannot be restored: %w", number, err)
+	}
+	changes, err := snapshot.Diff(current, data)
+	if err != nil {
+		return err
+	}
+	if len(changes) == 0 {
+		s.printf("The resources in the current state already match snapshot %s.\n", number)
+		return nil
+	}
+
+	s.printf("Restoring snapshot %s changes the current state:\n%s", number, formatChanges(changes))
+	answer, err := s.decide(ui.Decision{
+		Kind:     ui.DecisionConfirmRestore,
+		Resource: resource,
+		Choices:  []model.StepAction{model.StepYes, model.StepNo},
+	})
+	if err != nil {
+		return err
+	}
+	if answer.Action != model.StepYes {
+		s.printf("The state was not changed.\n")
+		return nil
+	}
+
+	saved, err := s.snapshots.Save("restore of snapshot "+number, current)
+	if err != nil {
+		return err
+	}
+	ctx, cancel = s.stepContext()
+	err = s.executer.PushState(ctx, restored)
+	cancel()
+	if err != nil {
+		return err
+	}
+
+	s.record(resource.Address, model.StepSnapshots, "restored snapshot "+number)
+	s.updateBaseline()
+	s.printf("Restored snapshot %s. The previous state was saved as snapshot %d.\n", number, saved.Number)
+	s.printf("The remaining steps were planned against another state, use replan to plan them again.\n")
+	return nil
+}
+
+// readSnapshot returns the state of a snapshot given by number, or the
+// current state for "current"
+func (s *Session) readSnapshot(name string) ([]byte, error) {
+	if name == "current" {
+		ctx, cancel := s.stepContext()
+		defer cancel()
+		return s.executer.PullState(ctx)
+	}
+
+	number, err := strconv.Atoi(name)
+	if err != nil {
+		return nil, fmt.Errorf("invalid snapshot %q (use a number or current)", name)
+	}
+	item, err := s.snapshots.Get(number)
+	if err != nil {
+		return nil, err
+	}
+	return s.snapshots.Read(item)
+}
+
+// snapshotName describes a snapshot argument in messages
+func snapshotName(name string) string {
+	if name == "current" {
+		return "the current state"
+	}
+	return "snapshot " + name
+}
+
+// formatChanges lists resource-level state changes, one per line
+func formatChanges(changes []snapshot.Change) string {
+	if len(changes) == 0 {
+		return "  No resources differ.\n"
+	}
+
+	var b strings.Builder
+	symbols := map[string]string{"added": "+", "removed": "-", "changed": "~"}
+	for _, change := range changes {
+		fmt.Fprintf(&b, "  %s %s", symbols[change.Kind], change.Address)
+		if len(change.Attributes) > 0 {
+			fmt.Fprintf(&b, " (%s)", strings.Join(change.Attributes, ", "))
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
@@ -0,0 +1,136 @@
+package session
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/marc-poljak/terraform-step-debug/internal/model"
+)
+
+// selectTeardown makes the resource given by address, or the current one,
+// the root of a subtree that is torn down together: its dependents that
+// were not destroyed yet go with it in a single apply. The root becomes the
+// next step, even while its dependents are pending.
+func (s *Session) selectTeardown(current *model.Resource, query string) (*model.Resource, error) {
+	if s.plan.Mode != model.ModeDestroy {
+		return nil, errors.New("subtrees can only be torn down in destroy mode")
+	}
+
+	root := current
+	if query != "" {
+		var err error
+		if root, err = s.findResource(query); err != nil {
+			return nil, err
+		}
+	}
+	if !s.targeted(root) {
+		return nil, fmt.Errorf("%s is not the targeted resource", root.Address)
+	}
+	if s.processed[root.Address] && root.Status == model.StatusComplete {
+		return nil, fmt.Errorf("%s was already destroyed", root.Address)
+	}
+
+	var group []string
+	var warnings []string
+	for _, dependent := range s.plan.Dependents(root) {
+		if dependent.Status != model.StatusComplete {
+			group = append(group, dependent.Address)
+			warnings = append(warnings, dependent.Warnings...)
+		}
+	}
+	if len(group) == 0 {
+		return nil, fmt.Errorf("nothing that depends on %s is left, apply it to destroy it alone", root.Address)
+	}
+
+	root.Group = group
+	s.printf("Applying %s destroys it together with what depends on it:\n  %s\n", root.Address, strings.Join(group, "\n  "))
+	// The warnings of the dependents, such as lost data, apply to the teardown
+	for _, warning := range warnings {
+		s.errorf("Warning: %s\n", warning)
+	}
+	if root != current {
+		if s.processed[root.Address] {
+			s.reopen(root)
+		}
+		s.jumpTo = root
+	}
+	return root, nil
+}
+
+// groupMembers returns the resources torn down together with the resource
+func (s *Session) groupMembers(resource *model.Resource) []*model.Resource {
+	members := make([]*model.Resource, 0, len(resource.Group))
+	for _, address := range resource.Group {
+		if member, ok := s.plan.ResourcesMap[address]; ok {
+			members = append(members, member)
+		}
+	}
+	return members
+}
+
+// finishGroup gives the resources torn down with a decided resource its
+// result. A skipped teardown leaves them to be decided on one by one.
+func (s *Session) finishGroup(resource *model.Resource) {
+	members := s.groupMembers(resource)
+	if resource.Status == model.StatusSkipped {
+		resource.Group = nil
+		return
+	}
+
+	for _, member := range members {
+		member.Status = resource.Status
+		if !s.processed[member.Address] {
+			s.executed = append(s.executed, member)
+			s.processed[member.Address] = true
+		}
+		s.record(member.Address, model.StepTeardown, fmt.Sprintf("%s with %s", member.Status, resource.Address))
+	}
+}
+
+// checkDestroy refuses to destroy a resource while something that depends on
+// it is left, since Terraform destroys the dependents of a destroy target as
+// well. This applies to destroy plans and to rolling back created resources.
+// Dependents torn down together with the resource are expected.
+func (s *Session) checkDestroy(resource *model.Resource) error {
+	if s.plan.Mode != model.ModeDestroy && !(s.rollingBack && resource.Action == model.ActionDelete) {
+		return nil
+	}
+
+	grouped := make(map[string]bool, len(resource.Group))
+	for _, address := range resource.Group {
+		grouped[address] = true
+	}
+	var left []string
+	for _, dependent := range s.plan.Dependents(resource) {
+		if dependent.Status != model.StatusComplete && !grouped[dependent.Address] {
+			left = append(left, dependent.Address)
+		}
+	}
+	if len(left) == 0 {
+		return nil
+	}
+
+	if s.rollingBack {
+		return fmt.Errorf("rolling back %s would also destroy what depends on it and was not rolled back: %s",
+			resource.Address, strings.Join(left, ", "))
+	}
+	return fmt.Errorf("destroying %s would also destroy what depends on it and was not destroyed: %s (use teardown to destroy them together)",
+		resource.Address, strings.Join(left, ", "))
+}
+
+// prerequisites returns the resources to decide on before the resource:
+// those it depends on, or in a destroy plan all those that depend on it
+func (s *Session) prerequisites(resource *model.Resource) []*model.Resource {
+	if s.plan.Mode == model.ModeDestroy {
+		return s.plan.Dependents(resource)
+	}
+
+	var resources []*model.Resource
+	for _, dep := range resource.Dependencies {
+		if other, ok := s.plan.ResourcesMap[dep]; ok && other != resource {
+			resources = append(resources, other)
+		}
+	}
+	return resources
+}
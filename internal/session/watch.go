@@ -0,0 +1,98 @@
+package session
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// watchExpression is an expression re-evaluated after every applied step
+type watchExpression struct {
+	Expression string
+	Value      string // Last result, or the error message
+	Evaluated  bool   // Whether Value holds a result yet
+}
+
+// eval evaluates an expression and prints the result
+func (s *Session) eval(expression string) {
+	value, err := s.evaluate(expression)
+	if err != nil {
+		s.errorf("Error: %s\n", err)
+		return
+	}
+	s.printf("%s = %s\n", expression, value)
+}
+
+// evaluate evaluates an expression with a context that is cancelled on interrupt
+func (s *Session) evaluate(expression string) (string, error) {
+	ctx, cancel := s.stepContext()
+	defer cancel()
+
+	return s.executer.Evaluate(ctx, expression)
+}
+
+// addWatch adds an expression to the watch list and shows its current value
+func (s *Session) addWatch(expression string) {
+	for _, watch := range s.watches {
+		if watch.Expression == expression {
+			s.printf("%s is already watched.\n", expression)
+			return
+		}
+	}
+
+	s.watches = append(s.watches, &watchExpression{Expression: expression})
+	s.refreshWatches(s.watches[len(s.watches)-1:])
+}
+
+// removeWatch removes an expression from the watch list, given by its
+// number in the list or by the expression itself
+func (s *Session) removeWatch(argument string) {
+	for i, watch := range s.watches {
+		if number, err := strconv.Atoi(argument); (err == nil && number == i+1) || watch.Expression == argument {
+			s.watches = append(s.watches[:i:i], s.watches[i+1:]...)
+			s.printf("Stopped watching %s.\n", watch.Expression)
+			return
+		}
+	}
+	s.errorf("Error: %q is not on the watch list\n", argument)
+}
+
+// refreshWatches re-evaluates the watch expressions and prints their
+// values, pointing out those that changed since the last evaluation
+func (s *Session) refreshWatches(watches []*watchExpression) {
+	if len(watches) == 0 {
+		s.printf("The watch list is empty.\n")
+		return
+	}
+
+	var b strings.Builder
+	b.WriteString("Watch:\n")
+	for _, watch := range watches {
+		value, err := s.evaluate(watch.Expression)
+		if err != nil {
+			value = "error: " + strings.ReplaceAll(strings.TrimPrefix(err.Error(),
+				fmt.Sprintf("failed to evaluate %q: ", watch.Expression)), "\n", " ")
+		}
+
+		marker := " "
+		if watch.Evaluated && watch.Value != value {
+			marker = "*"
+		}
+		watch.Value = value
+		watch.Evaluated = true
+
+		fmt.Fprintf(&b, "  %d.%s %s = %s\n", s.watchNumber(watch), marker, watch.Expression,
+			strings.ReplaceAll(value, "\n", "\n      "))
+	}
+	s.printf("%s", b.String())
+}
+
+// watchNumber returns the position of a watch expression in the list, starting at 1
+func (s *Session) watchNumber(watch *watchExpression) int {
+	for i, item := range s.watches {
+		if item == watch {
+			return i + 1
+		}
+	}
+	return 0
+}
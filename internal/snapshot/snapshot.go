@@ -0,0 +1,209 @@
+// Package snapshot keeps copies of the Terraform state taken before every
+// apply step of a session, so that they can be compared and restored.
+package snapshot
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/marc-poljak/terraform-step-debug/internal/executor"
+)
+
+// indexFile lists the snapshots of a session directory
+const indexFile = "snapshots.json"
+
+// Snapshot describes a saved copy of the state
+type Snapshot struct {
+	Number   int       `json:"number"`   // Position in the session, starting at 1
+	Address  string    `json:"address"`  // Resource about to be applied
+	Time     time.Time `json:"time"`     // When the state was pulled
+	Serial   int64     `json:"serial"`   // Serial of the state
+	Lineage  string    `json:"lineage"`  // Lineage of the state
+	Checksum string    `json:"checksum"` // SHA-256 of the state file
+	File     string    `json:"file"`     // File name in the session directory
+}
+
+// Store saves the snapshots of a session in a directory
+type Store struct {
+	dir       string
+	snapshots []*Snapshot
+}
+
+// NewStore creates a store in a new directory for this session, below the
+// given directory. The directories are only readable by the user, and are
+// ignored by git, since state files may contain secrets.
+func NewStore(baseDir string) (*Store, error) {
+	if err := os.MkdirAll(baseDir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create snapshot directory: %w", err)
+	}
+	if err := ignoreDir(baseDir); err != nil {
+		return nil, err
+	}
+
+	// Sessions started in the same second get their own directory
+	stamp := time.Now().Format("20060102-150405")
+	dir := filepath.Join(baseDir, stamp)
+	for i := 2; ; i++ {
+		err := os.Mkdir(dir, 0o700)
+		if err == nil {
+			return &Store{dir: dir}, nil
+		}
+		if !os.IsExist(err) {
+			return nil, fmt.Errorf("failed to create snapshot directory: %w", err)
+		}
+		dir = filepath.Join(baseDir, fmt.Sprintf("%s-%d", stamp, i))
+	}
+}
+
+// ignoreDir writes a .gitignore that keeps the directory out of git, as the
+// snapshot directory defaults to a place inside the Terraform directory.
+// An existing .gitignore is left as it is.
+func ignoreDir(dir string) error {
+	path := filepath.Join(dir, ".gitignore")
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if os.IsExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if _, err := file.WriteString("# State snapshots may contain secrets\n*\n"); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return file.Close()
+}
+
+// Dir returns the session directory of the store
+func (s *Store) Dir() string {
+	return s.dir
+}
+
+// Save writes a pulled state as the snapshot taken before the resource is applied
+func (s *Store) Save(address string, data []byte) (*Snapshot, error) {
+	info, err := executor.ParseStateInfo(data)
+	if err != nil {
+		return nil, err
+	}
+
+	sum := sha256.Sum256(data)
+	snapshot := &Snapshot{
+		Number:   len(s.snapshots) + 1,
+		Address:  address,
+		Time:     time.Now(),
+		Serial:   info.Serial,
+		Lineage:  info.Lineage,
+		Checksum: hex.EncodeToString(sum[:]),
+	}
+	snapshot.File = fmt.Sprintf("%03d-serial-%d.tfstate", snapshot.Number, snapshot.Serial)
+
+	if err := os.WriteFile(filepath.Join(s.dir, snapshot.File), data, 0o600); err != nil {
+		return nil, fmt.Errorf("failed to save snapshot: %w", err)
+	}
+	s.snapshots = append(s.snapshots, snapshot)
+	if err := s.writeIndex(); err != nil {
+		return nil, err
+	}
+	return snapshot, nil
+}
+
+// writeIndex records the snapshots of the session next to the state files
+func (s *Store) writeIndex() error {
+	data, err := json.MarshalIndent(s.snapshots, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(s.dir, indexFile), data, 0o600); err != nil {
+		return fmt.Errorf("failed to write snapshot index: %w", err)
+	}
+	return nil
+}
+
+// List returns the snapshots of the session, oldest first
+func (s *Store) List() []*Snapshot {
+	return s.snapshots
+}
+
+// Get returns the snapshot with the given number
+func (s *Store) Get(number int) (*Snapshot, error) {
+	if number < 1 || number > len(s.snapshots) {
+		return nil, fmt.Errorf("no snapshot %d (there are %d)", number, len(s.snapshots))
+	}
+	return s.snapshots[number-1], nil
+}
+
+// Read returns the state saved in a snapshot, after verifying its checksum
+func (s *Store) Read(snapshot *Snapshot) ([]byte, error) {
+	data, err := os.ReadFile(filepath.Join(s.dir, snapshot.File))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read snapshot %d: %w", snapshot.Number, err)
+	}
+	sum := sha256.Sum256(data)
+	if hex.EncodeToString(sum[:]) != snapshot.Checksum {
+		return nil, fmt.Errorf("snapshot %d was modified, its checksum does not match", snapshot.Number)
+	}
+	return data, nil
+}
+
+// Change is how a resource instance differs between two states
+type Change struct {
+	Address    string
+	Kind       string   // "added", "removed" or "changed"
+	Attributes []string // Top-level attributes that differ, for changed instances
+}
+
+// Diff compares two states at the resource level
+func Diff(from, to []byte) ([]Change, error) {
+	before, err := executor.StateInstances(from)
+	if err != nil {
+		return nil, err
+	}
+	after, err := executor.StateInstances(to)
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []Change
+	for address, attributes := range after {
+		previous, ok := before[address]
+		if !ok {
+			changes = append(changes, Change{Address: address, Kind: "added"})
+			continue
+		}
+		if differing := differingAttributes(previous, attributes); len(differing) > 0 {
+			changes = append(changes, Change{Address: address, Kind: "changed", Attributes: differing})
+		}
+	}
+	for address := range before {
+		if _, ok := after[address]; !ok {
+			changes = append(changes, Change{Address: address, Kind: "removed"})
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Address < changes[j].Address })
+	return changes, nil
+}
+
+// differingAttributes returns the sorted names of the attributes that differ
+func differingAttributes(before, after map[string]any) []string {
+	var names []string
+	for name, value := range after {
+		if previous, ok := before[name]; !ok || !reflect.DeepEqual(previous, value) {
+			names = append(names, name)
+		}
+	}
+	for name := range before {
+		if _, ok := after[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
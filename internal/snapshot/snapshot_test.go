@@ -0,0 +1,176 @@
+package snapshot
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestNewStoreIgnoredByGit(t *testing.T) {
+	tests := []struct {
+		name     string
+		existing string // Content of a .gitignore that exists already
+		want     string
+	}{
+		{name: "new directory", want: "\n*\n"},
+		{name: "existing .gitignore", existing: "*.json\n", want: "*.json\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			baseDir := filepath.Join(t.TempDir(), ".terraform-step-debug", "snapshots")
+			if tt.existing != "" {
+				if err := os.MkdirAll(baseDir, 0o700); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(filepath.Join(baseDir, ".gitignore"), []byte(tt.existing), 0o600); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			store, err := NewStore(baseDir)
+			if err != nil {
+				t.Fatalf("NewStore: %v", err)
+			}
+			if filepath.Dir(store.Dir()) != baseDir {
+				t.Errorf("session directory %s is not below %s", store.Dir(), baseDir)
+			}
+			content, err := os.ReadFile(filepath.Join(baseDir, ".gitignore"))
+			if err != nil {
+				t.Fatalf("reading .gitignore: %v", err)
+			}
+			if !strings.HasSuffix(string(content), tt.want) {
+				t.Errorf(".gitignore = %q, want it to end with %q", content, tt.want)
+			}
+		})
+	}
+}
+
+func TestSaveRead(t *testing.T) {
+	store, err := NewStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	states := []struct {
+		address string
+		state   string
+		serial  int64
+	}{
+		{"aws_vpc.main", `{"version": 4, "serial": 3, "lineage": "abc"}`, 3},
+		{"aws_subnet.a", `{"version": 4, "serial": 4, "lineage": "abc"}`, 4},
+		{"aws_subnet.b", "", 0}, // No state yet
+	}
+	for i, tt := range states {
+		saved, err := store.Save(tt.address, []byte(tt.state))
+		if err != nil {
+			t.Fatalf("Save %s: %v", tt.address, err)
+		}
+		if saved.Number != i+1 || saved.Serial != tt.serial || saved.Address != tt.address {
+			t.Errorf("snapshot = %d %d %s, want %d %d %s", saved.Number, saved.Serial, saved.Address, i+1, tt.serial, tt.address)
+		}
+	}
+
+	// The index records the serial and checksum of every snapshot
+	data, err := os.ReadFile(filepath.Join(store.Dir(), indexFile))
+	if err != nil {
+		t.Fatalf("reading the index: %v", err)
+	}
+	var index []*Snapshot
+	if err := json.Unmarshal(data, &index); err != nil {
+		t.Fatalf("parsing the index: %v", err)
+	}
+	if len(index) != len(states) || index[1].Serial != 4 || index[1].Lineage != "abc" || index[1].Checksum == "" {
+		t.Errorf("index = %s", data)
+	}
+
+	tests := []struct {
+		name    string
+		number  int
+		modify  string // New content of the state file
+		want    string
+		wantErr string
+	}{
+		{name: "first snapshot", number: 1, want: states[0].state},
+		{name: "empty state", number: 3, want: ""},
+		{name: "modified file", number: 2, modify: `{"version": 4, "serial": 9, "lineage": "abc"}`, wantErr: "checksum does not match"},
+		{name: "unknown number", number: 4, wantErr: "no snapshot 4 (there are 3)"},
+		{name: "zero", number: 0, wantErr: "no snapshot 0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			snapshot, err := store.Get(tt.number)
+			if err == nil {
+				if tt.modify != "" {
+					if err := os.WriteFile(filepath.Join(store.Dir(), snapshot.File), []byte(tt.modify), 0o600); err != nil {
+						t.Fatal(err)
+					}
+				}
+				var data []byte
+				data, err = store.Read(snapshot)
+				if err == nil && string(data) != tt.want {
+					t.Errorf("Read = %s, want %s", data, tt.want)
+				}
+			}
+			if tt.wantErr == "" && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDiff(t *testing.T) {
+	state := func(resources string) []byte {
+		return []byte(`{"version": 4, "serial": 1, "lineage": "abc", "resources": [` + resources + `]}`)
+	}
+	const (
+		vpc    = `{"mode": "managed", "type": "aws_vpc", "name": "main", "instances": [{"attributes": {"id": "vpc-1", "cidr_block": "10.0.0.0/16", "tags": {"env": "dev"}}}]}`
+		subnet = `{"mode": "managed", "type": "aws_subnet", "name": "a", "instances": [{"index_key": 0, "attributes": {"id": "subnet-0"}}, {"index_key": 1, "attributes": {"id": "subnet-1"}}]}`
+	)
+
+	tests := []struct {
+		name string
+		from []byte
+		to   []byte
+		want []Change
+	}{
+		{name: "same state", from: state(vpc), to: state(vpc)},
+		{
+			name: "added and removed instances",
+			from: state(vpc),
+			to:   state(subnet),
+			want: []Change{
+				{Address: "aws_subnet.a[0]", Kind: "added"},
+				{Address: "aws_subnet.a[1]", Kind: "added"},
+				{Address: "aws_vpc.main", Kind: "removed"},
+			},
+		},
+		{
+			name: "changed attributes",
+			from: state(vpc),
+			to:   state(strings.NewReplacer(`"10.0.0.0/16"`, `"10.1.0.0/16"`, `"dev"`, `"prod"`, `"id": "vpc-1", `, `"arn": "arn:vpc", "id": "vpc-1", `).Replace(vpc)),
+			want: []Change{{Address: "aws_vpc.main", Kind: "changed", Attributes: []string{"arn", "cidr_block", "tags"}}},
+		},
+		{
+			name: "no state before",
+			to:   state(vpc),
+			want: []Change{{Address: "aws_vpc.main", Kind: "added"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			changes, err := Diff(tt.from, tt.to)
+			if err != nil {
+				t.Fatalf("Diff: %v", err)
+			}
+			if !reflect.DeepEqual(changes, tt.want) {
+				t.Errorf("Diff = %+v, want %+v", changes, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,330 @@
+package ui
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/marc-poljak/terraform-step-debug/internal/model"
+)
+
+// JSONPresenter writes every session event as a line of JSON and reads the
+// answers to decisions as lines of input, so that other programs can drive
+// a step-debugging session. An answer is either the name of an action with
+// an optional argument, such as "apply" or "jump aws_s3_bucket.logs", or an
+// object like {"action": "jump", "argument": "aws_s3_bucket.logs"}.
+type JSONPresenter struct {
+	mu      sync.Mutex
+	encoder *json.Encoder
+	reader  *bufio.Reader
+}
+
+// jsonEvent is a single line of the event stream
+type jsonEvent struct {
+	Event     string             `json:"event"`
+	Time      time.Time          `json:"time"`
+	Workspace string             `json:"workspace,omitempty"`
+	Backend   string             `json:"backend,omitempty"`
+	Mode      model.PlanMode     `json:"mode,omitempty"`
+	Stats     *jsonStats         `json:"stats,omitempty"`
+	Layers    [][]string         `json:"layers,omitempty"`
+	Resource  *jsonResource      `json:"resource,omitempty"`
+	Resources []jsonResource     `json:"resources,omitempty"`
+	Index     int                `json:"index,omitempty"`
+	Total     int                `json:"total,omitempty"`
+	Kind      DecisionKind       `json:"kind,omitempty"`
+	Choices   []model.StepAction `json:"choices,omitempty"`
+	Reasons   []string           `json:"reasons,omitempty"`
+	Stream    Stream             `json:"stream,omitempty"`
+	Text      string             `json:"text,omitempty"`
+	Error     string             `json:"error,omitempty"`
+	Elapsed   float64            `json:"elapsed_seconds,omitempty"`
+	Added     []string           `json:"added,omitempty"`
+	Removed   []string           `json:"removed,omitempty"`
+	Changed   []string           `json:"changed,omitempty"`
+	Deferred  []jsonDeferred     `json:"deferred,omitempty"`
+	Drift     []*jsonDrift       `json:"drift,omitempty"`
+}
+
+// jsonDrift describes a resource changed outside Terraform
+type jsonDrift struct {
+	Address    string       `json:"address"`
+	Action     model.Action `json:"action"`
+	Attributes []string     `json:"attributes,omitempty"`
+}
+
+// jsonDeferred describes a change that Terraform deferred to a later plan
+type jsonDeferred struct {
+	Address string       `json:"address"`
+	Action  model.Action `json:"action"`
+	Reason  string       `json:"reason"`
+}
+
+// jsonResource describes a resource in the event stream
+type jsonResource struct {
+	Address      string               `json:"address"`
+	Type         string               `json:"type"`
+	Action       model.Action         `json:"action"`
+	ImportID     string               `json:"import_id,omitempty"`
+	PreviousAddr string               `json:"previous_address,omitempty"`
+	FollowUp     model.Action         `json:"follow_up,omitempty"`
+	ReadReason   string               `json:"read_reason,omitempty"`
+	Unknown      []string             `json:"unknown_inputs,omitempty"`
+	Triggers     []string             `json:"read_triggers,omitempty"`
+	Drift        *jsonDrift           `json:"drift,omitempty"`
+	DriftCaused  bool                 `json:"drift_caused,omitempty"`
+	Group        []string             `json:"group,omitempty"`
+	Status       model.ResourceStatus `json:"status"`
+	Dependencies []string             `json:"dependencies,omitempty"`
+	Outputs      []string             `json:"outputs,omitempty"`
+	Checks       []jsonCheck          `json:"checks,omitempty"`
+	Protected    string               `json:"protected,omitempty"`
+	Blocked      string               `json:"blocked,omitempty"`
+	Risk         int                  `json:"risk"`
+	RiskReasons  []string             `json:"risk_reasons,omitempty"`
+	Attempts     int                  `json:"attempts,omitempty"`
+}
+
+// jsonCheck describes the latest result of a check
+type jsonCheck struct {
+	Address  string            `json:"address"`
+	Status   model.CheckStatus `json:"status"`
+	Problems []string          `json:"problems,omitempty"`
+}
+
+// jsonStats counts the changes in a plan
+type jsonStats struct {
+	Create  int `json:"create"`
+	Update  int `json:"update"`
+	Delete  int `json:"delete"`
+	Replace int `json:"replace"`
+	Noop    int `json:"noop"`
+	Import  int `json:"import,omitempty"`
+	Move    int `json:"move,omitempty"`
+	Forget  int `json:"forget,omitempty"`
+	Read    int `json:"read,omitempty"`
+	Refresh int `json:"refresh,omitempty"`
+}
+
+// jsonAnswer is the object form of an answer to a decision
+type jsonAnswer struct {
+	Action   model.StepAction `json:"action"`
+	Argument string           `json:"argument,omitempty"`
+}
+
+// NewJSONPresenter creates a JSONPresenter writing events to out and
+// reading answers from in
+func NewJSONPresenter(in io.Reader, out io.Writer) *JSONPresenter {
+	return &JSONPresenter{
+		encoder: json.NewEncoder(out),
+		reader:  bufio.NewReader(in),
+	}
+}
+
+// PlanLoaded emits the plan statistics and the execution layers
+func (p *JSONPresenter) PlanLoaded(plan *model.Plan, graph *model.ExecutionGraph) {
+	p.emit(jsonEvent{
+		Event:     "plan_loaded",
+		Workspace: plan.Workspace,
+		Backend:   plan.Backend,
+		Mode:      plan.Mode,
+		Stats:     newJSONStats(plan.Stats),
+		Layers:    layerAddresses(graph),
+		Deferred:  newJSONDeferred(plan.Deferred),
+		Drift:     newJSONDrifts(plan.Drift),
+	})
+}
+
+// PlanReplanned emits the new execution layers and how the pending steps changed
+func (p *JSONPresenter) PlanReplanned(plan *model.Plan, graph *model.ExecutionGraph, diff *model.PlanDiff) {
+	event := jsonEvent{
+		Event:    "plan_replanned",
+		Stats:    newJSONStats(plan.Stats),
+		Layers:   layerAddresses(graph),
+		Deferred: newJSONDeferred(plan.Deferred),
+		Drift:    newJSONDrifts(plan.Drift),
+	}
+	for _, resource := range diff.Added {
+		event.Added = append(event.Added, resource.Address)
+	}
+	for _, resource := range diff.Removed {
+		event.Removed = append(event.Removed, resource.Address)
+	}
+	for _, change := range diff.Changed {
+		event.Changed = append(event.Changed, change.Current.Address)
+	}
+	p.emit(event)
+}
+
+// StepStarted emits the resource waiting for a decision
+func (p *JSONPresenter) StepStarted(resource *model.Resource, index, total int) {
+	p.emit(jsonEvent{Event: "step_started", Resource: newJSONResource(resource), Index: index, Total: total})
+}
+
+// RequestDecision emits the decision and reads answers until a valid one
+// arrives. Acknowledgements are answered without reading input.
+func (p *JSONPresenter) RequestDecision(decision Decision) (Answer, error) {
+	event := jsonEvent{
+		Event:   "decision_requested",
+		Kind:    decision.Kind,
+		Choices: decision.Choices,
+		Reasons: decision.Reasons,
+	}
+	if decision.Resource != nil {
+		event.Resource = newJSONResource(decision.Resource)
+	}
+	p.emit(event)
+
+	if decision.Kind == DecisionAcknowledge {
+		return Answer{Action: model.StepYes}, nil
+	}
+
+	for {
+		line, err := p.reader.ReadString('\n')
+		if strings.TrimSpace(line) == "" && err != nil {
+			return Answer{}, fmt.Errorf("failed to read input: %w", err)
+		}
+
+		answer, parseErr := parseJSONAnswer(line)
+		switch {
+		case parseErr != nil:
+			p.emit(jsonEvent{Event: "invalid_answer", Error: parseErr.Error()})
+		case !decision.Allows(answer.Action):
+			p.emit(jsonEvent{Event: "invalid_answer", Error: fmt.Sprintf("%q is not a valid answer", answer.Action)})
+		default:
+			return answer, nil
+		}
+	}
+}
+
+// Output emits a chunk of Terraform output or a progress message
+func (p *JSONPresenter) Output(stream Stream, text string) {
+	p.emit(jsonEvent{Event: "output", Stream: stream, Text: ansiEscape.ReplaceAllString(text, "")})
+}
+
+// StepFinished emits the result of a step
+func (p *JSONPresenter) StepFinished(resource *model.Resource, err error, elapsed time.Duration) {
+	event := jsonEvent{Event: "step_finished", Resource: newJSONResource(resource), Elapsed: elapsed.Seconds()}
+	if err != nil {
+		event.Error = err.Error()
+	}
+	p.emit(event)
+}
+
+// Summary emits the status of every executed resource
+func (p *JSONPresenter) Summary(executedResources []*model.Resource) {
+	event := jsonEvent{Event: "summary", Resources: []jsonResource{}}
+	for _, resource := range executedResources {
+		event.Resources = append(event.Resources, *newJSONResource(resource))
+	}
+	p.emit(event)
+}
+
+// Close is a no-op, as the JSON presenter does not change the terminal
+func (p *JSONPresenter) Close() {}
+
+// emit writes an event as a line of JSON
+func (p *JSONPresenter) emit(event jsonEvent) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	event.Time = time.Now().UTC()
+	_ = p.encoder.Encode(event)
+}
+
+// parseJSONAnswer reads an action name with an optional argument, or an
+// object with action and argument fields
+func parseJSONAnswer(line string) (Answer, error) {
+	line = strings.TrimSpace(line)
+	if !strings.HasPrefix(line, "{") {
+		word, argument := parseAnswer(line)
+		return Answer{Action: model.StepAction(word), Argument: argument}, nil
+	}
+
+	var answer jsonAnswer
+	if err := json.Unmarshal([]byte(line), &answer); err != nil {
+		return Answer{}, fmt.Errorf("invalid answer: %w", err)
+	}
+	return Answer{Action: answer.Action, Argument: answer.Argument}, nil
+}
+
+// newJSONResource describes a resource for the event stream
+func newJSONResource(resource *model.Resource) *jsonResource {
+	checks := make([]jsonCheck, 0, len(resource.Checks))
+	for _, check := range resource.Checks {
+		checks = append(checks, jsonCheck{Address: check.Address, Status: check.Status, Problems: check.Problems})
+	}
+
+	return &jsonResource{
+		Address:      resource.Address,
+		Type:         resource.Type,
+		Action:       resource.Action,
+		ImportID:     resource.ImportID,
+		PreviousAddr: resource.PreviousAddress,
+		FollowUp:     resource.FollowUp,
+		ReadReason:   resource.ReadReason,
+		Unknown:      resource.UnknownInputs,
+		Triggers:     resource.ReadTriggers,
+		Drift:        newJSONDrift(resource.Drift),
+		DriftCaused:  resource.DriftCaused,
+		Group:        resource.Group,
+		Status:       resource.Status,
+		Dependencies: resource.Dependencies,
+		Outputs:      resource.Outputs,
+		Checks:       checks,
+		Protected:    resource.Protected,
+		Blocked:      resource.Blocked,
+		Risk:         resource.Risk,
+		RiskReasons:  resource.RiskReasons,
+		Attempts:     len(resource.Attempts),
+	}
+}
+
+// newJSONStats describes the plan statistics for the event stream
+func newJSONStats(stats model.PlanStats) *jsonStats {
+	return &jsonStats{Create: stats.Create, Update: stats.Update, Delete: stats.Delete, Replace: stats.Replace, Noop: stats.Noop,
+		Import: stats.Import, Move: stats.Move, Forget: stats.Forget, Read: stats.Read, Refresh: stats.Refresh}
+}
+
+// layerAddresses lists the addresses in each layer of the execution graph
+func layerAddresses(graph *model.ExecutionGraph) [][]string {
+	layers := make([][]string, 0, len(graph.Layers))
+	for _, layer := range graph.Layers {
+		addresses := make([]string, 0, len(layer))
+		for _, resource := range layer {
+			addresses = append(addresses, resource.Address)
+		}
+		layers = append(layers, addresses)
+	}
+	return layers
+}
+
+// newJSONDeferred describes the deferred changes of a plan for the event stream
+func newJSONDeferred(changes []*model.DeferredChange) []jsonDeferred {
+	deferred := make([]jsonDeferred, 0, len(changes))
+	for _, change := range changes {
+		deferred = append(deferred, jsonDeferred{Address: change.Address, Action: change.Action, Reason: change.Reason})
+	}
+	return deferred
+}
+
+// newJSONDrift describes the drift of a resource for the event stream
+func newJSONDrift(drift *model.Drift) *jsonDrift {
+	if drift == nil {
+		return nil
+	}
+	return &jsonDrift{Address: drift.Address, Action: drift.Action, Attributes: drift.Attributes}
+}
+
+// newJSONDrifts describes the drift found for a plan for the event stream
+func newJSONDrifts(drifts []*model.Drift) []*jsonDrift {
+	described := make([]*jsonDrift, 0, len(drifts))
+	for _, drift := range drifts {
+		described = append(described, newJSONDrift(drift))
+	}
+	return described
+}
@@ -0,0 +1,37 @@
+package ui
+
+import (
+	"testing"
+
+	"github.com/marc-poljak/terraform-step-debug/internal/model"
+)
+
+func TestParseJSONAnswer(t *testing.T) {
+	tests := []struct {
+		line    string
+		want    Answer
+		wantErr bool
+	}{
+		{line: "apply", want: Answer{Action: model.StepApply}},
+		{line: "  Skip  ", want: Answer{Action: model.StepSkip}},
+		{line: "jump aws_s3_bucket.logs", want: Answer{Action: model.StepJump, Argument: "aws_s3_bucket.logs"}},
+		{line: "eval length(aws_subnet.private)", want: Answer{Action: model.StepEval, Argument: "length(aws_subnet.private)"}},
+		{line: `{"action": "apply"}`, want: Answer{Action: model.StepApply}},
+		{line: `{"action": "jump", "argument": "aws_s3_bucket.logs"}`, want: Answer{Action: model.StepJump, Argument: "aws_s3_bucket.logs"}},
+		{line: `  {"action": "yes", "argument": "aws_db_instance.main"}  `, want: Answer{Action: model.StepYes, Argument: "aws_db_instance.main"}},
+		{line: `{"action": }`, wantErr: true},
+		{line: `{"action": 1}`, wantErr: true},
+		{line: "", want: Answer{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			got, err := parseJSONAnswer(tt.line)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseJSONAnswer(%q) error = %v, want error %v", tt.line, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("parseJSONAnswer(%q) = %+v, want %+v", tt.line, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,93 @@
+package ui
+
+import (
+	"io"
+	"strings"
+	"time"
+
+	"github.com/marc-poljak/terraform-step-debug/internal/model"
+)
+
+// Presenter receives the events of a step-debugging session and asks the
+// user for decisions. It is implemented by the line-based UI, the
+// full-screen TUI, a JSON event stream and a scripted driver for tests.
+type Presenter interface {
+	PlanLoaded(plan *model.Plan, graph *model.ExecutionGraph)
+	PlanReplanned(plan *model.Plan, graph *model.ExecutionGraph, diff *model.PlanDiff)
+	StepStarted(resource *model.Resource, index, total int)
+	RequestDecision(decision Decision) (Answer, error)
+	Output(stream Stream, text string)
+	StepFinished(resource *model.Resource, err error, elapsed time.Duration)
+	Summary(executedResources []*model.Resource)
+	Close() // Restores the terminal, if the presenter changed it
+}
+
+// DecisionKind identifies what the session asks the user
+type DecisionKind string
+
+const (
+	DecisionStep           DecisionKind = "step"            // Action for the current resource
+	DecisionInterrupted    DecisionKind = "interrupted"     // Retry, skip or abort a cancelled or timed out step
+	DecisionStale          DecisionKind = "stale"           // The plan no longer matches the state or configuration
+	DecisionContinue       DecisionKind = "continue"        // Whether to continue after a failed step
+	DecisionConfirmAbort   DecisionKind = "confirm-abort"   // Whether to really abort
+	DecisionAcknowledge    DecisionKind = "acknowledge"     // Let the user read the output before continuing
+	DecisionConfirmAddress DecisionKind = "confirm-address" // Type the address of a protected resource to delete or replace it
+	DecisionConfirmRestore DecisionKind = "confirm-restore" // Whether to push a state snapshot as the current state
+)
+
+// Decision is a question the session asks the user
+type Decision struct {
+	Kind     DecisionKind
+	Resource *model.Resource    // The resource the decision is about, if any
+	Choices  []model.StepAction // The valid answers
+	Reasons  []string           // Why the decision is needed, e.g. why the plan is stale
+}
+
+// Answer is the user's answer to a decision
+type Answer struct {
+	Action   model.StepAction
+	Argument string // Search pattern or address for actions that need one
+}
+
+// parseAnswer splits typed input into an action word and its argument
+func parseAnswer(input string) (string, string) {
+	word, argument, _ := strings.Cut(strings.TrimSpace(input), " ")
+	return strings.ToLower(word), strings.TrimSpace(argument)
+}
+
+// Allows reports whether the action is a valid answer to the decision
+func (d Decision) Allows(action model.StepAction) bool {
+	for _, choice := range d.Choices {
+		if choice == action {
+			return true
+		}
+	}
+	return false
+}
+
+// Stream identifies the kind of output text
+type Stream string
+
+const (
+	StreamOutput Stream = "stdout" // Terraform output and progress messages
+	StreamError  Stream = "stderr" // Errors and warnings
+)
+
+// Writer returns an io.Writer that passes everything written to the
+// presenter as output of the given stream
+func Writer(presenter Presenter, stream Stream) io.Writer {
+	return presenterWriter{presenter: presenter, stream: stream}
+}
+
+// presenterWriter adapts a presenter's Output method to io.Writer
+type presenterWriter struct {
+	presenter Presenter
+	stream    Stream
+}
+
+// Write passes the data to the presenter
+func (w presenterWriter) Write(data []byte) (int, error) {
+	w.presenter.Output(w.stream, string(data))
+	return len(data), nil
+}
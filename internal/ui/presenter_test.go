@@ -0,0 +1,31 @@
+package ui
+
+import (
+	"testing"
+
+	"github.com/marc-poljak/terraform-step-debug/internal/model"
+)
+
+func TestDecisionAllows(t *testing.T) {
+	tests := []struct {
+		name    string
+		choices []model.StepAction
+		action  model.StepAction
+		want    bool
+	}{
+		{"offered", []model.StepAction{model.StepApply, model.StepSkip}, model.StepSkip, true},
+		{"not offered", []model.StepAction{model.StepApply, model.StepSkip}, model.StepTeardown, false},
+		{"yes or no", []model.StepAction{model.StepYes, model.StepNo}, model.StepNo, true},
+		{"no choices", nil, model.StepApply, false},
+		{"empty action", []model.StepAction{model.StepApply}, "", false},
+		{"case sensitive", []model.StepAction{model.StepApply}, "Apply", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decision := Decision{Kind: DecisionStep, Choices: tt.choices}
+			if got := decision.Allows(tt.action); got != tt.want {
+				t.Errorf("Allows(%q) = %v, want %v", tt.action, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,170 @@
+package ui
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/marc-poljak/terraform-step-debug/internal/model"
+)
+
+// ScriptEvent is an event recorded by the ScriptedPresenter
+type ScriptEvent struct {
+	Type     string // plan_loaded, plan_replanned, step_started, decision_requested, output, step_finished or summary
+	Address  string // Address of the resource the event is about, if any
+	Decision DecisionKind
+	Answer   Answer
+	Text     string // Output text, or the error of a failed step
+}
+
+// ScriptedPresenter answers decisions from a fixed list of answers and
+// records every event, so that a session can run unattended, e.g. in tests.
+// Acknowledgements are answered without using a line of the script.
+type ScriptedPresenter struct {
+	mu      sync.Mutex
+	answers []string
+	log     io.Writer
+	events  []ScriptEvent
+}
+
+// NewScriptedPresenter creates a ScriptedPresenter that answers decisions
+// with the given lines in order. Each line is an action, optionally followed
+// by its argument, e.g. "jump aws_s3_bucket.logs". Events are also printed
+// to log, if set.
+func NewScriptedPresenter(answers []string, log io.Writer) *ScriptedPresenter {
+	return &ScriptedPresenter{
+		answers: answers,
+		log:     log,
+	}
+}
+
+// LoadScript reads the answers of a script file, one per line.
+// Empty lines and lines starting with # are ignored.
+func LoadScript(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open script: %w", err)
+	}
+	defer file.Close()
+
+	var answers []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		answers = append(answers, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read script: %w", err)
+	}
+
+	return answers, nil
+}
+
+// Events returns the events recorded so far
+func (p *ScriptedPresenter) Events() []ScriptEvent {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return append([]ScriptEvent(nil), p.events...)
+}
+
+// PlanLoaded records the loaded plan
+func (p *ScriptedPresenter) PlanLoaded(plan *model.Plan, graph *model.ExecutionGraph) {
+	p.record(ScriptEvent{Type: "plan_loaded", Text: fmt.Sprintf("%d resources in %d layers",
+		len(plan.Resources), len(graph.Layers))})
+}
+
+// PlanReplanned records the new plan
+func (p *ScriptedPresenter) PlanReplanned(plan *model.Plan, graph *model.ExecutionGraph, diff *model.PlanDiff) {
+	p.record(ScriptEvent{Type: "plan_replanned", Text: fmt.Sprintf("%d added, %d removed, %d changed",
+		len(diff.Added), len(diff.Removed), len(diff.Changed))})
+}
+
+// StepStarted records the resource waiting for a decision
+func (p *ScriptedPresenter) StepStarted(resource *model.Resource, index, total int) {
+	p.record(ScriptEvent{Type: "step_started", Address: resource.Address, Text: fmt.Sprintf("%d/%d", index, total)})
+}
+
+// RequestDecision answers with the next line of the script. It fails when
+// the script is exhausted or the action is not a valid answer.
+func (p *ScriptedPresenter) RequestDecision(decision Decision) (Answer, error) {
+	event := ScriptEvent{Type: "decision_requested", Decision: decision.Kind}
+	if decision.Resource != nil {
+		event.Address = decision.Resource.Address
+	}
+
+	if decision.Kind == DecisionAcknowledge {
+		event.Answer = Answer{Action: model.StepYes}
+		p.record(event)
+		return event.Answer, nil
+	}
+
+	p.mu.Lock()
+	if len(p.answers) == 0 {
+		p.mu.Unlock()
+		p.record(event)
+		return Answer{}, fmt.Errorf("script has no action left for the %s decision", decision.Kind)
+	}
+	word, argument := parseAnswer(p.answers[0])
+	p.answers = p.answers[1:]
+	p.mu.Unlock()
+
+	event.Answer = Answer{Action: model.StepAction(word), Argument: argument}
+	p.record(event)
+	if !decision.Allows(event.Answer.Action) {
+		return Answer{}, fmt.Errorf("script action %q is not a valid answer to the %s decision", word, decision.Kind)
+	}
+	return event.Answer, nil
+}
+
+// Output records a chunk of Terraform output or a progress message
+func (p *ScriptedPresenter) Output(stream Stream, text string) {
+	p.record(ScriptEvent{Type: "output", Text: text})
+}
+
+// StepFinished records the result of a step
+func (p *ScriptedPresenter) StepFinished(resource *model.Resource, err error, elapsed time.Duration) {
+	event := ScriptEvent{Type: "step_finished", Address: resource.Address}
+	if err != nil {
+		event.Text = err.Error()
+	}
+	p.record(event)
+}
+
+// Summary records the status of every executed resource
+func (p *ScriptedPresenter) Summary(executedResources []*model.Resource) {
+	for _, resource := range executedResources {
+		p.record(ScriptEvent{Type: "summary", Address: resource.Address, Text: string(resource.Status)})
+	}
+}
+
+// Close is a no-op, as the scripted presenter does not change the terminal
+func (p *ScriptedPresenter) Close() {}
+
+// record stores an event and prints it to the log
+func (p *ScriptedPresenter) record(event ScriptEvent) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.events = append(p.events, event)
+	if p.log == nil {
+		return
+	}
+
+	switch event.Type {
+	case "output":
+		fmt.Fprint(p.log, event.Text)
+	case "decision_requested":
+		fmt.Fprintf(p.log, "[script] %s %s -> %s\n", event.Decision, event.Address,
+			strings.TrimSpace(string(event.Answer.Action)+" "+event.Answer.Argument))
+	default:
+		fmt.Fprintf(p.log, "[script] %s %s %s\n", event.Type, event.Address, event.Text)
+	}
+}
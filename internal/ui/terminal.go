@@ -0,0 +1,26 @@
+package ui
+
+import (
+	"os"
+
+	"golang.org/x/term"
+)
+
+// IsInteractiveTerminal reports whether both standard input and standard
+// output are connected to a terminal capable of full-screen output
+func IsInteractiveTerminal() bool {
+	if termType := os.Getenv("TERM"); termType == "" || termType == "dumb" {
+		return false
+	}
+	return term.IsTerminal(int(os.Stdin.Fd())) && term.IsTerminal(int(os.Stdout.Fd()))
+}
+
+// terminalSize returns the width and height of the terminal, with a
+// fallback for output that is not a terminal
+func terminalSize(file *os.File) (int, int) {
+	width, height, err := term.GetSize(int(file.Fd()))
+	if err != nil || width <= 0 || height <= 0 {
+		return 80, 24
+	}
+	return width, height
+}
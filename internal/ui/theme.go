@@ -0,0 +1,263 @@
+package ui
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"golang.org/x/term"
+
+	"github.com/marc-poljak/terraform-step-debug/internal/model"
+	"github.com/marc-poljak/terraform-step-debug/internal/risk"
+)
+
+// Theme holds the escape sequences used to color actions and statuses.
+// All fields are empty when colors are disabled.
+type Theme struct {
+	Bold  string
+	Reset string
+	// Invert highlights the status bar and selection of the full-screen UI
+	Invert string
+
+	// Action colors
+	Create string
+	Update string
+	Delete string
+	Read   string
+	Noop   string
+
+	// Status colors
+	Complete    string
+	Skipped     string
+	Failed      string
+	Interrupted string
+
+	Warning string
+}
+
+// DefaultTheme returns the standard colors
+func DefaultTheme() Theme {
+	return Theme{
+		Bold:        colorBold,
+		Reset:       colorReset,
+		Invert:      colorInvert,
+		Create:      colorGreen,
+		Update:      colorYellow,
+		Delete:      colorRed,
+		Read:        colorCyan,
+		Noop:        colorBlue,
+		Complete:    colorGreen,
+		Skipped:     colorYellow,
+		Failed:      colorRed,
+		Interrupted: colorPurple,
+		Warning:     colorYellow,
+	}
+}
+
+// NoColorTheme returns a theme without any escape sequences
+func NoColorTheme() Theme {
+	return Theme{}
+}
+
+// themeColors maps color names to their SGR parameters
+var themeColors = map[string]string{
+	"bold":      "1",
+	"faint":     "2",
+	"italic":    "3",
+	"underline": "4",
+	"black":     "30",
+	"red":       "31",
+	"green":     "32",
+	"yellow":    "33",
+	"blue":      "34",
+	"magenta":   "35",
+	"purple":    "35",
+	"cyan":      "36",
+	"white":     "37",
+	"gray":      "90",
+	"grey":      "90",
+}
+
+// ParseTheme applies a comma separated list of element=color pairs to the
+// default theme, e.g. "create=cyan,delete=bold+red,failed=196". A color is
+// a name, a bright-name, a 256-color number, or several joined with "+".
+func ParseTheme(spec string) (Theme, error) {
+	theme := DefaultTheme()
+	fields := map[string]*string{
+		"create":      &theme.Create,
+		"update":      &theme.Update,
+		"delete":      &theme.Delete,
+		"read":        &theme.Read,
+		"noop":        &theme.Noop,
+		"complete":    &theme.Complete,
+		"skipped":     &theme.Skipped,
+		"failed":      &theme.Failed,
+		"interrupted": &theme.Interrupted,
+		"warning":     &theme.Warning,
+	}
+
+	for _, pair := range strings.Split(spec, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		name, color, ok := strings.Cut(pair, "=")
+		if !ok {
+			return theme, fmt.Errorf("invalid color theme entry %q (use element=color)", pair)
+		}
+		field, ok := fields[strings.ToLower(strings.TrimSpace(name))]
+		if !ok {
+			return theme, fmt.Errorf("unknown color theme element %q", name)
+		}
+		sequence, err := parseColor(color)
+		if err != nil {
+			return theme, err
+		}
+		*field = sequence
+	}
+
+	return theme, nil
+}
+
+// parseColor converts a color specification into an escape sequence
+func parseColor(spec string) (string, error) {
+	var params []string
+	for _, part := range strings.Split(strings.ToLower(strings.TrimSpace(spec)), "+") {
+		if code, ok := themeColors[part]; ok {
+			params = append(params, code)
+			continue
+		}
+		if base, ok := strings.CutPrefix(part, "bright-"); ok {
+			if code, ok := themeColors[base]; ok && len(code) == 2 && code[0] == '3' {
+				params = append(params, "9"+code[1:])
+				continue
+			}
+		}
+		if number, err := strconv.Atoi(part); err == nil && number >= 0 && number <= 255 {
+			params = append(params, "38;5;"+part)
+			continue
+		}
+		return "", fmt.Errorf("unknown color %q", part)
+	}
+	if len(params) == 0 {
+		return "", nil
+	}
+	return "\033[" + strings.Join(params, ";") + "m", nil
+}
+
+// Action returns the color of a resource action
+func (t Theme) Action(action model.Action) string {
+	switch action {
+	case model.ActionCreate:
+		return t.Create
+	case model.ActionUpdate, model.ActionRestore:
+		return t.Update
+	case model.ActionDelete, model.ActionReplace:
+		return t.Delete
+	case model.ActionRead, model.ActionImport, model.ActionMove, model.ActionForget, model.ActionRefresh:
+		return t.Read
+	case model.ActionNoop:
+		return t.Noop
+	default:
+		return t.Reset
+	}
+}
+
+// Status returns the color of a resource status
+func (t Theme) Status(status model.ResourceStatus) string {
+	switch status {
+	case model.StatusComplete:
+		return t.Complete
+	case model.StatusSkipped:
+		return t.Skipped
+	case model.StatusFailed:
+		return t.Failed
+	case model.StatusCanceled, model.StatusTimeout:
+		return t.Interrupted
+	default:
+		return t.Reset
+	}
+}
+
+// Check returns the color of a check status
+func (t Theme) Check(status model.CheckStatus) string {
+	switch status {
+	case model.CheckPass:
+		return t.Complete
+	case model.CheckFail, model.CheckError:
+		return t.Failed
+	default:
+		return t.Warning
+	}
+}
+
+// Risk returns the color of a risk level
+func (t Theme) Risk(level risk.Level) string {
+	switch level {
+	case risk.LevelHigh:
+		return t.Failed
+	case risk.LevelMedium:
+		return t.Warning
+	default:
+		return t.Reset
+	}
+}
+
+// ColorEnabled reports whether colored output should be used. Colors are
+// disabled by the --no-color flag, a non-empty NO_COLOR variable, a dumb
+// terminal, or output that is not a terminal.
+func ColorEnabled(noColor bool) bool {
+	if noColor || os.Getenv("NO_COLOR") != "" || os.Getenv("TERM") == "dumb" {
+		return false
+	}
+	return term.IsTerminal(int(os.Stdout.Fd()))
+}
+
+// outputWidth returns the width of the terminal on standard output, or 0
+// when the output is not a terminal and should not be wrapped
+func outputWidth() int {
+	if !term.IsTerminal(int(os.Stdout.Fd())) {
+		return 0
+	}
+	width, _ := terminalSize(os.Stdout)
+	return width
+}
+
+// wrapText splits text into lines of at most width characters, breaking at
+// spaces, or within long words such as addresses after a dot, slash or
+// bracket. A width of 0 or less disables wrapping.
+func wrapText(text string, width int) []string {
+	if width <= 0 || len([]rune(text)) <= width {
+		return []string{text}
+	}
+
+	var lines []string
+	runes := []rune(text)
+	for len(runes) > width {
+		cut := -1
+		for i := width; i > 0; i-- {
+			if runes[i] == ' ' {
+				cut = i
+				break
+			}
+		}
+		if cut <= 0 {
+			for i := width - 1; i > 0; i-- {
+				if runes[i] == '.' || runes[i] == '/' || runes[i] == '[' {
+					cut = i + 1
+					if runes[i] == '[' {
+						cut = i
+					}
+					break
+				}
+			}
+		}
+		if cut <= 0 {
+			cut = width
+		}
+
+		lines = append(lines, strings.TrimRight(string(runes[:cut]), " "))
+		runes = []rune(strings.TrimLeft(string(runes[cut:]), " "))
+	}
+	return append(lines, string(runes))
+}
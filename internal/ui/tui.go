@@ -0,0 +1,558 @@
+package ui
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"golang.org/x/term"
+
+	"github.com/marc-poljak/terraform-step-debug/internal/model"
+)
+
+// maxLogLines is the number of Terraform output lines kept in the log pane
+const maxLogLines = 2000
+
+// detailView selects what the detail pane shows for the selected resource
+type detailView int
+
+const (
+	viewDiff         detailView = iota // Attribute changes
+	viewDependencies                   // Dependencies and dependents
+)
+
+// TUI is a full-screen terminal interface with a resource list, a detail
+// pane, a live log of Terraform output and key bindings for each action
+type TUI struct {
+	mu        sync.Mutex
+	out       *os.File
+	oldState  *term.State
+	keys      chan string
+	interrupt func() bool
+	line      *UI
+	theme     Theme
+	closed    bool
+
+	plan      *model.Plan
+	items     []*model.Resource // Resources in execution order
+	current   *model.Resource   // Resource waiting for a decision
+	selected  int               // Index of the selected resource in items
+	progress  string            // Step counter shown in the header
+	view      detailView
+	logLines  []string
+	partial   string // Incomplete last line of output
+	logScroll int    // Number of lines scrolled up from the end of the log
+	status    string // Prompt or key help shown on the last line
+}
+
+// NewTUI switches the terminal to full-screen mode and returns the TUI.
+// interrupt is called when Ctrl-C is pressed and reports whether a running
+// step was interrupted; otherwise Ctrl-C is treated as an abort request.
+func NewTUI(interrupt func() bool) (*TUI, error) {
+	oldState, err := term.MakeRaw(int(os.Stdin.Fd()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to switch the terminal to raw mode: %w", err)
+	}
+
+	t := &TUI{
+		out:       os.Stdout,
+		oldState:  oldState,
+		keys:      make(chan string, 16),
+		interrupt: interrupt,
+		line:      NewUI(),
+		theme:     DefaultTheme(),
+	}
+
+	// Switch to the alternate screen and hide the cursor
+	fmt.Fprint(t.out, "\x1b[?1049h\x1b[?25l")
+	go t.readKeys(os.Stdin)
+
+	return t, nil
+}
+
+// Close leaves full-screen mode and restores the terminal
+func (t *TUI) Close() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.closed {
+		return
+	}
+	t.closed = true
+
+	fmt.Fprint(t.out, "\x1b[?25h\x1b[?1049l")
+	_ = term.Restore(int(os.Stdin.Fd()), t.oldState)
+}
+
+// SetTheme sets the colors of actions and statuses, and of the summary
+// printed after leaving full-screen mode
+func (t *TUI) SetTheme(theme Theme) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.theme = theme
+	t.line.SetTheme(theme)
+}
+
+// DisplayPlanSummary shows the plan statistics in the log pane
+func (t *TUI) DisplayPlanSummary(plan *model.Plan) {
+	t.mu.Lock()
+	t.plan = plan
+	t.mu.Unlock()
+
+	if plan.Mode != model.ModeNormal {
+		t.logf("Mode: %s", plan.Mode)
+	}
+	t.logf("Plan: %d to create, %d to update, %d to delete, %d to replace",
+		plan.Stats.Create, plan.Stats.Update, plan.Stats.Delete, plan.Stats.Replace)
+	if plan.Stats.Read > 0 {
+		t.logf("Data sources: %d to read during apply", plan.Stats.Read)
+	}
+	for _, drift := range plan.Drift {
+		t.logf("%sDrift: %s %s; %s%s", t.theme.Warning, drift.Address, driftText(drift), driftOutcome(plan, drift), t.theme.Reset)
+	}
+	if hint := driftHint(plan); hint != "" {
+		t.logf("%s", hint)
+	}
+	if plan.Stats.Import+plan.Stats.Move+plan.Stats.Forget > 0 {
+		t.logf("State: %d to import, %d to move, %d to forget", plan.Stats.Import, plan.Stats.Move, plan.Stats.Forget)
+	}
+	for _, change := range plan.Deferred {
+		t.logf("%sDeferred: %s (%s): %s%s", t.theme.Skipped, change.Address, change.Action, change.Reason, t.theme.Reset)
+	}
+}
+
+// SetExecutionGraph shows the resources of the graph in execution order.
+// Resources already decided in the session stay at the top of the list.
+func (t *TUI) SetExecutionGraph(graph *model.ExecutionGraph) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var items []*model.Resource
+	seen := make(map[string]bool)
+	for _, resource := range t.items {
+		if resource.Status != model.StatusPending {
+			items = append(items, resource)
+			seen[resource.Address] = true
+		}
+	}
+	for _, layer := range graph.Layers {
+		for _, resource := range layer {
+			if !seen[resource.Address] {
+				items = append(items, resource)
+			}
+		}
+	}
+
+	t.items = items
+	t.selected = 0
+	t.render()
+}
+
+// DisplayResourceInfo selects the resource waiting for a decision
+func (t *TUI) DisplayResourceInfo(resource *model.Resource, index, total int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.current = resource
+	t.progress = fmt.Sprintf("step %d/%d", index, total)
+	for i, item := range t.items {
+		if item == resource {
+			t.selected = i
+		}
+	}
+	t.render()
+}
+
+// tuiKeys describes the key bindings of the step prompt, logged with "?"
+var tuiKeys = []struct{ keys, description string }{
+	{"a / s", "Apply / skip the current resource"},
+	{"c", "Continue applying until the next breakpoint"},
+	{"b", "Toggle a breakpoint on the selected resource"},
+	{"d", "Show the Terraform diff of the current resource"},
+	{"i", "Inspect state, planned values and dependents of the selected resource"},
+	{"m", "Show the blast radius of the selected resource"},
+	{"e", "Evaluate a Terraform expression against the state"},
+	{"w / u", "Watch an expression (empty shows the list) / stop watching one"},
+	{"p", "Postpone the current resource to the end of its layer"},
+	{"g", "Go to the selected resource"},
+	{"D", "In destroy mode, destroy the selected resource with its pending dependents"},
+	{"/ l h", "Search resources / list remaining steps / show history"},
+	{"t", "List, compare (diff <a> [b]) or restore (restore <n>) state snapshots"},
+	{"r / x", "Re-plan the remaining steps / abort"},
+	{"z", "Roll back the applied steps in reverse order, then stop"},
+	{"↑↓ tab PgUp PgDn", "Select a resource / switch the detail view / scroll the log"},
+}
+
+// tuiArgumentPrompts asks for the text argument of an action key
+var tuiArgumentPrompts = map[string]string{
+	"/": "Search (text, or /regex/): ",
+	"e": "Eval: ",
+	"w": "Watch (empty to show the list): ",
+	"u": "Unwatch (number or expression): ",
+	"t": "Snapshots (empty lists, diff <a> [b], restore <n>): ",
+}
+
+// logKeys writes the key bindings to the log pane
+func (t *TUI) logKeys() {
+	t.logf("Keys:")
+	for _, key := range tuiKeys {
+		t.logf("  %-18s %s", key.keys, key.description)
+	}
+}
+
+// GetUserAction waits for an action key for the current resource. Jumping
+// and inspecting use the selected resource, and keys that need text ask for it.
+func (t *TUI) GetUserAction() (Answer, error) {
+	actions := map[string]model.StepAction{
+		"a": model.StepApply,
+		"s": model.StepSkip,
+		"d": model.StepDetail,
+		"i": model.StepInspect,
+		"m": model.StepImpact,
+		"e": model.StepEval,
+		"w": model.StepWatch,
+		"u": model.StepUnwatch,
+		"p": model.StepPostpone,
+		"g": model.StepJump,
+		"D": model.StepTeardown,
+		"l": model.StepList,
+		"/": model.StepSearch,
+		"h": model.StepHistory,
+		"t": model.StepSnapshots,
+		"r": model.StepReplan,
+		"z": model.StepRollback,
+		"c": model.StepContinue,
+		"x": model.StepAbort,
+	}
+
+	for {
+		key, err := t.ask("a:apply s:skip c:continue d:detail i:inspect e:eval w:watch r:replan x:abort ?:keys",
+			"a", "s", "d", "i", "m", "e", "w", "u", "p", "g", "D", "l", "/", "h", "t", "r", "z", "c", "x", "?", keyCtrlC)
+		if err != nil {
+			return Answer{}, err
+		}
+
+		switch key {
+		case keyCtrlC:
+			return Answer{Action: model.StepAbort}, nil
+		case "g", "D", "i", "m":
+			// These act on the selected resource rather than the current one
+			t.mu.Lock()
+			address := ""
+			if t.selected < len(t.items) {
+				address = t.items[t.selected].Address
+			}
+			t.mu.Unlock()
+			return Answer{Action: actions[key], Argument: address}, nil
+		case "?":
+			t.logKeys()
+			continue
+		case "/", "e", "w", "u", "t":
+			argument, err := t.readLine(tuiArgumentPrompts[key])
+			if err != nil {
+				return Answer{}, err
+			}
+			// Only the watch list and the snapshots can be shown without an argument
+			if argument == "" && key != "w" && key != "t" {
+				continue
+			}
+			return Answer{Action: actions[key], Argument: argument}, nil
+		}
+		return Answer{Action: actions[key]}, nil
+	}
+}
+
+// GetInterruptedAction asks what to do after a step was cancelled or timed out
+func (t *TUI) GetInterruptedAction(resource *model.Resource) (model.StepAction, error) {
+	key, err := t.ask(fmt.Sprintf("Step %s: %s  r:retry s:skip x:abort", resource.Status, resource.Address),
+		"r", "s", "x")
+	if err != nil {
+		return "", err
+	}
+	return map[string]model.StepAction{"r": model.StepRetry, "s": model.StepSkip, "x": model.StepAbort}[key], nil
+}
+
+// GetStaleAction asks what to do when the plan no longer matches the state or configuration
+func (t *TUI) GetStaleAction(reasons []string, allowContinue bool) (model.StepAction, error) {
+	t.logf("The plan is stale:")
+	for _, reason := range reasons {
+		t.logf("  - %s", reason)
+	}
+
+	prompt, valid := "The plan is stale  r:replan x:abort", []string{"r", "x"}
+	if allowContinue {
+		prompt, valid = "The plan is stale  c:continue r:replan x:abort", []string{"c", "r", "x"}
+	}
+
+	key, err := t.ask(prompt, valid...)
+	if err != nil {
+		return "", err
+	}
+	return map[string]model.StepAction{"c": model.StepContinue, "r": model.StepReplan, "x": model.StepAbort}[key], nil
+}
+
+// DisplayExecutionResult logs the result of executing a resource
+func (t *TUI) DisplayExecutionResult(resource *model.Resource, success bool, elapsed time.Duration) {
+	if success {
+		t.logf("Success: Applied %s in %.2f seconds", resource.Address, elapsed.Seconds())
+	} else {
+		t.logf("Failure: Could not apply %s (%.2f seconds)", resource.Address, elapsed.Seconds())
+	}
+}
+
+// DisplayPlanDiff logs how re-planning changed the pending steps
+func (t *TUI) DisplayPlanDiff(diff *model.PlanDiff, remaining int) {
+	t.logf("Re-planned: %d resources remaining", remaining)
+	for _, resource := range diff.Added {
+		t.logf("  + new:     %s (%s)", resource.Address, resource.Action)
+	}
+	for _, resource := range diff.Removed {
+		t.logf("  - gone:    %s (%s)", resource.Address, resource.Action)
+	}
+	for _, change := range diff.Changed {
+		t.logf("  ~ changed: %s (%s -> %s)", change.Current.Address, change.Previous.Action, change.Current.Action)
+	}
+}
+
+// DisplaySummary leaves full-screen mode and prints the execution summary
+func (t *TUI) DisplaySummary(executedResources []*model.Resource) {
+	t.Close()
+	t.line.DisplaySummary(executedResources)
+}
+
+// ConfirmContinue asks the user if they want to continue after an error
+func (t *TUI) ConfirmContinue() bool {
+	key, err := t.ask("Continue despite errors? [y/n]", "y", "n")
+	return err == nil && key == "y"
+}
+
+// ConfirmAbort asks the user to confirm aborting the execution
+func (t *TUI) ConfirmAbort() bool {
+	key, err := t.ask("Are you sure you want to abort? [y/n]", "y", "n")
+	return err == nil && key == "y"
+}
+
+// ConfirmRestore asks the user to confirm pushing a snapshot as the current state
+func (t *TUI) ConfirmRestore() bool {
+	key, err := t.ask("Push the snapshot as the current state? [y/n]", "y", "n")
+	return err == nil && key == "y"
+}
+
+// WaitForEnter waits for the user to press Enter
+func (t *TUI) WaitForEnter() {
+	_, _ = t.ask("Press Enter to continue...", keyEnter)
+}
+
+// PlanLoaded shows the plan statistics and the resources in execution order
+func (t *TUI) PlanLoaded(plan *model.Plan, graph *model.ExecutionGraph) {
+	t.DisplayPlanSummary(plan)
+	t.SetExecutionGraph(graph)
+}
+
+// PlanReplanned shows the new resource list and logs how the pending steps changed
+func (t *TUI) PlanReplanned(plan *model.Plan, graph *model.ExecutionGraph, diff *model.PlanDiff) {
+	t.mu.Lock()
+	t.plan = plan
+	t.mu.Unlock()
+
+	t.SetExecutionGraph(graph)
+	t.DisplayPlanDiff(diff, len(plan.Resources))
+}
+
+// StepStarted selects the resource waiting for a decision
+func (t *TUI) StepStarted(resource *model.Resource, index, total int) {
+	t.DisplayResourceInfo(resource, index, total)
+}
+
+// RequestDecision waits for the key answering a decision
+func (t *TUI) RequestDecision(decision Decision) (Answer, error) {
+	var action model.StepAction
+	var err error
+
+	switch decision.Kind {
+	case DecisionStep:
+		return t.GetUserAction()
+	case DecisionInterrupted:
+		action, err = t.GetInterruptedAction(decision.Resource)
+	case DecisionStale:
+		action, err = t.GetStaleAction(decision.Reasons, decision.Allows(model.StepContinue))
+	case DecisionContinue:
+		action = yesNo(t.ConfirmContinue())
+	case DecisionConfirmAbort:
+		action = yesNo(t.ConfirmAbort())
+	case DecisionAcknowledge:
+		t.WaitForEnter()
+		action = model.StepYes
+	case DecisionConfirmAddress:
+		return t.ConfirmAddress(decision.Resource)
+	case DecisionConfirmRestore:
+		action = yesNo(t.ConfirmRestore())
+	default:
+		err = fmt.Errorf("unknown decision %q", decision.Kind)
+	}
+	return Answer{Action: action}, err
+}
+
+// ConfirmAddress asks the user to type the full address of a protected
+// resource to confirm that it is deleted or replaced
+func (t *TUI) ConfirmAddress(resource *model.Resource) (Answer, error) {
+	t.logf("%s%s will be %s.%s", t.theme.Warning, resource.Address, pastTense(resource.Action), t.theme.Reset)
+	input, err := t.readLine("Type the full address to confirm (Esc cancels): ")
+	if err != nil || input == "" {
+		return Answer{Action: model.StepNo}, err
+	}
+	return Answer{Action: model.StepYes, Argument: input}, nil
+}
+
+// Output appends Terraform output and progress messages to the log pane
+func (t *TUI) Output(stream Stream, text string) {
+	_, _ = tuiLog{t}.Write([]byte(text))
+}
+
+// StepFinished logs the result of a step
+func (t *TUI) StepFinished(resource *model.Resource, err error, elapsed time.Duration) {
+	t.DisplayExecutionResult(resource, err == nil, elapsed)
+}
+
+// Summary leaves full-screen mode and prints the execution summary
+func (t *TUI) Summary(executedResources []*model.Resource) {
+	t.DisplaySummary(executedResources)
+}
+
+// ask shows a prompt and handles navigation keys until one of the valid keys is pressed
+func (t *TUI) ask(prompt string, valid ...string) (string, error) {
+	t.mu.Lock()
+	t.status = prompt
+	t.render()
+	t.mu.Unlock()
+
+	for key := range t.keys {
+		if answer, ok := matchKey(key, valid); ok {
+			t.mu.Lock()
+			t.status = ""
+			t.logScroll = 0
+			t.mu.Unlock()
+			return answer, nil
+		}
+
+		t.mu.Lock()
+		t.handleNavigation(key)
+		t.render()
+		t.mu.Unlock()
+	}
+
+	return "", fmt.Errorf("failed to read input: %w", io.EOF)
+}
+
+// matchKey returns the valid key that was pressed. Keys match exactly, so
+// that upper case keys can have actions of their own, and otherwise
+// regardless of case.
+func matchKey(key string, valid []string) (string, bool) {
+	for _, v := range valid {
+		if key == v {
+			return v, true
+		}
+	}
+	for _, v := range valid {
+		if strings.EqualFold(key, v) {
+			return v, true
+		}
+	}
+	return "", false
+}
+
+// readLine lets the user type a line of text in the status line.
+// Escape cancels and returns an empty line.
+func (t *TUI) readLine(prompt string) (string, error) {
+	var input []rune
+	for {
+		t.mu.Lock()
+		t.status = prompt + string(input) + "█"
+		t.render()
+		t.mu.Unlock()
+
+		key, ok := <-t.keys
+		if !ok {
+			return "", fmt.Errorf("failed to read input: %w", io.EOF)
+		}
+
+		switch key {
+		case keyEnter:
+			return strings.TrimSpace(string(input)), nil
+		case keyEscape, keyCtrlC:
+			return "", nil
+		case keyBackspace:
+			if len(input) > 0 {
+				input = input[:len(input)-1]
+			}
+		default:
+			if r := []rune(key); len(r) == 1 && unicode.IsPrint(r[0]) {
+				input = append(input, r[0])
+			}
+		}
+	}
+}
+
+// handleNavigation moves the selection, scrolls the log or toggles the view
+func (t *TUI) handleNavigation(key string) {
+	switch key {
+	case keyUp, "k":
+		if t.selected > 0 {
+			t.selected--
+		}
+	case keyDown, "j":
+		if t.selected < len(t.items)-1 {
+			t.selected++
+		}
+	case keyPageUp:
+		t.logScroll += 10
+	case keyPageDown:
+		t.logScroll = max(t.logScroll-10, 0)
+	case keyTab, "v":
+		t.view = (t.view + 1) % 2
+	case "b":
+		if t.selected < len(t.items) {
+			t.items[t.selected].Breakpoint = !t.items[t.selected].Breakpoint
+		}
+	}
+}
+
+// logf appends a formatted line to the log pane
+func (t *TUI) logf(format string, args ...any) {
+	_, _ = tuiLog{t}.Write([]byte(fmt.Sprintf(format, args...) + "\n"))
+}
+
+// tuiLog is an io.Writer that appends Terraform output to the log pane
+type tuiLog struct {
+	t *TUI
+}
+
+// Write appends output to the log, splitting it into lines
+func (l tuiLog) Write(data []byte) (int, error) {
+	t := l.t
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	text := t.partial + ansiEscape.ReplaceAllString(string(data), "")
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+	for _, line := range lines[:len(lines)-1] {
+		// Keep only the last rewrite of lines using carriage returns
+		if i := strings.LastIndex(line, "\r"); i >= 0 {
+			line = line[i+1:]
+		}
+		t.logLines = append(t.logLines, strings.ReplaceAll(line, "\t", "    "))
+	}
+	t.partial = lines[len(lines)-1]
+
+	if len(t.logLines) > maxLogLines {
+		t.logLines = t.logLines[len(t.logLines)-maxLogLines:]
+	}
+
+	t.render()
+	return len(data), nil
+}
@@ -0,0 +1,85 @@
+package ui
+
+import (
+	"os"
+	"unicode/utf8"
+)
+
+// Keys reported by the TUI input reader besides printable characters
+const (
+	keyUp        = "up"
+	keyDown      = "down"
+	keyPageUp    = "pgup"
+	keyPageDown  = "pgdown"
+	keyEnter     = "enter"
+	keyTab       = "tab"
+	keyEscape    = "esc"
+	keyCtrlC     = "ctrl-c"
+	keyBackspace = "backspace"
+)
+
+// escapeKeys maps terminal escape sequences to key names
+var escapeKeys = map[string]string{
+	"\x1b[A":  keyUp,
+	"\x1bOA":  keyUp,
+	"\x1b[B":  keyDown,
+	"\x1bOB":  keyDown,
+	"\x1b[5~": keyPageUp,
+	"\x1b[6~": keyPageDown,
+}
+
+// readKeys reads key presses from the terminal and sends them to the keys
+// channel. Ctrl-C is offered to the interrupt handler first, so that it
+// stops a running step like it does outside of raw mode.
+func (t *TUI) readKeys(in *os.File) {
+	buf := make([]byte, 64)
+	for {
+		n, err := in.Read(buf)
+		if err != nil {
+			close(t.keys)
+			return
+		}
+
+		for _, key := range parseKeys(buf[:n]) {
+			if key == keyCtrlC && t.interrupt != nil && t.interrupt() {
+				continue
+			}
+			t.keys <- key
+		}
+	}
+}
+
+// parseKeys splits raw terminal input into key names
+func parseKeys(data []byte) []string {
+	var keys []string
+	for len(data) > 0 {
+		key, size := parseKey(data)
+		keys = append(keys, key)
+		data = data[size:]
+	}
+	return keys
+}
+
+// parseKey returns the first key in data and the number of bytes it used
+func parseKey(data []byte) (string, int) {
+	switch data[0] {
+	case 0x03:
+		return keyCtrlC, 1
+	case '\r', '\n':
+		return keyEnter, 1
+	case '\t':
+		return keyTab, 1
+	case 0x7f, 0x08:
+		return keyBackspace, 1
+	case 0x1b:
+		for sequence, key := range escapeKeys {
+			if len(data) >= len(sequence) && string(data[:len(sequence)]) == sequence {
+				return key, len(sequence)
+			}
+		}
+		return keyEscape, len(data)
+	}
+
+	r, size := utf8.DecodeRune(data)
+	return string(r), size
+}
@@ -0,0 +1,339 @@
+package ui
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/marc-poljak/terraform-step-debug/internal/model"
+	"github.com/marc-poljak/terraform-step-debug/internal/risk"
+)
+
+// ansiEscape matches terminal color sequences in Terraform output
+var ansiEscape = regexp.MustCompile(`\x1b\[[0-9;?]*[A-Za-z]`)
+
+// statusIcons are shown next to each resource in the resource list
+var statusIcons = map[model.ResourceStatus]string{
+	model.StatusPending:  "○",
+	model.StatusApproved: "◐",
+	model.StatusComplete: "✔",
+	model.StatusSkipped:  "↷",
+	model.StatusFailed:   "✖",
+	model.StatusCanceled: "■",
+	model.StatusTimeout:  "◷",
+}
+
+// render draws the whole screen. The caller must hold t.mu.
+func (t *TUI) render() {
+	if t.closed {
+		return
+	}
+
+	width, height := terminalSize(t.out)
+	topHeight := max((height-3)*3/5, 3)
+	logHeight := max(height-topHeight-3, 1)
+	listWidth := max(width*2/5, 20)
+	detailWidth := max(width-listWidth-1, 10)
+
+	list := t.listLines(listWidth, topHeight)
+	detail := t.detailLines(detailWidth, topHeight)
+
+	var b strings.Builder
+	b.WriteString("\x1b[H")
+	writeRow(&b, t.theme.Bold+pad(t.header(), width)+t.theme.Reset)
+	for i := 0; i < topHeight; i++ {
+		writeRow(&b, list[i]+"│"+detail[i])
+	}
+	writeRow(&b, pad("── Log "+strings.Repeat("─", max(width-7, 0)), width))
+	for _, line := range t.visibleLog(logHeight) {
+		writeRow(&b, pad(line, width))
+	}
+	b.WriteString(t.theme.Invert + pad(" "+t.status, width) + t.theme.Reset + "\x1b[K")
+
+	fmt.Fprint(t.out, b.String())
+}
+
+// writeRow writes a screen row and clears the rest of it
+func writeRow(b *strings.Builder, row string) {
+	b.WriteString(row)
+	b.WriteString("\x1b[K\r\n")
+}
+
+// header returns the title line with the plan context
+func (t *TUI) header() string {
+	parts := []string{" Terraform Step Debugger"}
+	if t.plan != nil && t.plan.Workspace != "" {
+		parts = append(parts, "workspace: "+t.plan.Workspace)
+	}
+	if t.plan != nil && t.plan.Backend != "" {
+		parts = append(parts, "backend: "+t.plan.Backend)
+	}
+	if t.progress != "" {
+		parts = append(parts, t.progress)
+	}
+	return strings.Join(parts, " │ ")
+}
+
+// listLines renders the resource list, scrolled to keep the selection visible
+func (t *TUI) listLines(width, height int) []string {
+	lines := make([]string, height)
+	offset := 0
+	if t.selected >= height {
+		offset = t.selected - height + 1
+	}
+
+	for i := range lines {
+		index := offset + i
+		if index >= len(t.items) {
+			lines[i] = pad("", width)
+			continue
+		}
+		lines[i] = t.listItem(t.items[index], index == t.selected, width)
+	}
+	return lines
+}
+
+// listItem renders a single entry of the resource list
+func (t *TUI) listItem(resource *model.Resource, selected bool, width int) string {
+	marker := " "
+	if resource == t.current {
+		marker = "▶"
+	}
+	breakpoint := " "
+	if resource.Breakpoint {
+		breakpoint = t.theme.Failed + "●" + t.theme.Reset
+	}
+	icon := t.theme.Status(resource.Status) + statusIcons[resource.Status] + t.theme.Reset
+
+	label := string(resource.Action)
+	if resource.DriftCaused {
+		label += ", drift"
+	}
+	text := fmt.Sprintf("%s (%s)", resource.Address, label)
+	switch {
+	case selected && t.theme.Invert != "":
+		text = t.theme.Invert + pad(text, width-6) + t.theme.Reset
+	case selected:
+		// Without colors the selection is marked in the text itself
+		text = pad("» "+text, width-6)
+	default:
+		text = pad(text, width-6)
+	}
+	return fmt.Sprintf("%s%s %s %s ", marker, breakpoint, icon, text)
+}
+
+// detailLines renders the detail pane for the selected resource
+func (t *TUI) detailLines(width, height int) []string {
+	var content []string
+	if t.selected < len(t.items) {
+		resource := t.items[t.selected]
+		if t.view == viewDependencies {
+			content = append([]string{t.theme.Bold + "Dependencies of " + resource.Address + t.theme.Reset},
+				t.dependencyLines(resource)...)
+		} else {
+			content = append([]string{t.theme.Bold + "Changes to " + resource.Address + t.theme.Reset},
+				attributeDiffLines(resource, t.theme)...)
+		}
+		var header []string
+		if resource.ImportID != "" {
+			header = append(header, "Import ID: "+resource.ImportID)
+		}
+		if resource.PreviousAddress != "" {
+			header = append(header, "Moved from: "+resource.PreviousAddress)
+		}
+		if resource.FollowUp != "" {
+			header = append(header, fmt.Sprintf("Then: %s%s%s in dependency order", t.theme.Action(resource.FollowUp), resource.FollowUp, t.theme.Reset))
+		}
+		if len(resource.Group) > 0 {
+			header = append(header, t.theme.Warning+"Tears down with: "+strings.Join(resource.Group, ", ")+t.theme.Reset)
+		}
+		if resource.Drift != nil {
+			header = append(header, t.theme.Warning+"Drift: "+driftText(resource.Drift)+t.theme.Reset)
+		}
+		if resource.DriftCaused {
+			header = append(header, t.theme.Warning+"Caused by drift: the planned change only undoes it"+t.theme.Reset)
+		}
+		if resource.ReadReason != "" {
+			header = append(header, "Read because: "+resource.ReadReason)
+		}
+		if len(resource.UnknownInputs) > 0 {
+			header = append(header, "Unknown inputs: "+strings.Join(resource.UnknownInputs, ", "))
+		}
+		if len(resource.ReadTriggers) > 0 {
+			header = append(header, "Triggered by: "+strings.Join(resource.ReadTriggers, ", "))
+		}
+		content = append(content[:1], append(header, content[1:]...)...)
+		switch {
+		case resource.Blocked != "":
+			content = append(content[:1], append([]string{t.theme.Failed + "Blocked: " + resource.Blocked + t.theme.Reset},
+				content[1:]...)...)
+		case resource.Protected != "":
+			content = append(content[:1], append([]string{t.theme.Warning + "Protected: " + resource.Protected + t.theme.Reset},
+				content[1:]...)...)
+		}
+	}
+
+	lines := make([]string, height)
+	for i := range lines {
+		line := ""
+		if i < len(content) {
+			line = content[i]
+		}
+		lines[i] = " " + padColored(line, width-1)
+	}
+	return lines
+}
+
+// dependencyLines lists what the resource depends on and what depends on it
+func (t *TUI) dependencyLines(resource *model.Resource) []string {
+	lines := []string{"", "Depends on:"}
+	if len(resource.Dependencies) == 0 {
+		lines = append(lines, "  (nothing)")
+	}
+	for _, dep := range resource.Dependencies {
+		lines = append(lines, "  - "+dep)
+	}
+
+	lines = append(lines, "", "Required by:")
+	dependents := 0
+	for _, item := range t.items {
+		if item.DependsOn(resource.Address) {
+			lines = append(lines, "  - "+item.Address)
+			dependents++
+		}
+	}
+	if dependents == 0 {
+		lines = append(lines, "  (nothing)")
+	}
+
+	// Summarize the blast radius, through all transitive dependents
+	if t.plan != nil && dependents > 0 {
+		all := t.plan.Dependents(resource)
+		pending, destructive := 0, 0
+		for _, item := range all {
+			if item.Status == model.StatusPending {
+				pending++
+			}
+			if item.Action.Destructive() {
+				destructive++
+			}
+		}
+		lines = append(lines, "", fmt.Sprintf("Blast radius: %d dependents, %d pending, %d deletes or replaces",
+			len(all), pending, destructive))
+	}
+
+	lines = append(lines, "", t.theme.Risk(risk.LevelOf(resource.Risk))+"Risk: "+riskText(resource)+t.theme.Reset)
+
+	if len(resource.Outputs) > 0 {
+		lines = append(lines, "", "Affects outputs:")
+		for _, name := range resource.Outputs {
+			lines = append(lines, "  - "+name)
+		}
+	}
+
+	if len(resource.Checks) > 0 {
+		lines = append(lines, "", "Checks:")
+		for _, check := range resource.Checks {
+			lines = append(lines, fmt.Sprintf("  %s%s%s %s", t.theme.Check(check.Status), check.Status, t.theme.Reset, check.Address))
+		}
+	}
+	return lines
+}
+
+// attributeDiffLines lists the attributes that change, with their old and new values
+func attributeDiffLines(resource *model.Resource, theme Theme) []string {
+	keys := make(map[string]bool)
+	for key := range resource.Before {
+		keys[key] = true
+	}
+	for key := range resource.After {
+		keys[key] = true
+	}
+
+	sorted := make([]string, 0, len(keys))
+	for key := range keys {
+		sorted = append(sorted, key)
+	}
+	sort.Strings(sorted)
+
+	lines := []string{""}
+	unchanged := 0
+	for _, key := range sorted {
+		before, hasBefore := resource.Before[key]
+		after, hasAfter := resource.After[key]
+		switch {
+		case !hasBefore || resource.Before == nil:
+			lines = append(lines, fmt.Sprintf("%s+ %s = %s%s", theme.Create, key, formatValue(after), theme.Reset))
+		case !hasAfter || resource.After == nil:
+			lines = append(lines, fmt.Sprintf("%s- %s = %s%s", theme.Delete, key, formatValue(before), theme.Reset))
+		case !reflect.DeepEqual(before, after):
+			lines = append(lines, fmt.Sprintf("%s~ %s = %s -> %s%s", theme.Update, key,
+				formatValue(before), formatValue(after), theme.Reset))
+		default:
+			unchanged++
+		}
+	}
+
+	if unchanged > 0 {
+		lines = append(lines, fmt.Sprintf("  (%d unchanged attributes)", unchanged))
+	}
+	if len(sorted) == 0 {
+		lines = append(lines, "  (values known after apply)")
+	}
+	return lines
+}
+
+// formatValue formats an attribute value compactly
+func formatValue(value any) string {
+	if value == nil {
+		return "null"
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(data)
+}
+
+// visibleLog returns the log lines that fit into the log pane
+func (t *TUI) visibleLog(height int) []string {
+	lines := t.logLines
+	if t.partial != "" {
+		lines = append(lines[:len(lines):len(lines)], t.partial)
+	}
+
+	t.logScroll = min(t.logScroll, max(len(lines)-height, 0))
+	end := len(lines) - t.logScroll
+	start := max(end-height, 0)
+
+	visible := make([]string, height)
+	copy(visible, lines[start:end])
+	return visible
+}
+
+// pad truncates or pads plain text to exactly width characters
+func pad(text string, width int) string {
+	if width <= 0 {
+		return ""
+	}
+	length := utf8.RuneCountInString(text)
+	if length > width {
+		runes := []rune(text)
+		return string(runes[:width-1]) + "…"
+	}
+	return text + strings.Repeat(" ", width-length)
+}
+
+// padColored pads text containing color sequences to width visible characters
+func padColored(text string, width int) string {
+	plain := ansiEscape.ReplaceAllString(text, "")
+	if utf8.RuneCountInString(plain) > width {
+		// Drop the colors rather than cutting a sequence in half
+		return pad(plain, width)
+	}
+	return text + strings.Repeat(" ", width-utf8.RuneCountInString(plain))
+}
@@ -0,0 +1,110 @@
+package ui
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/marc-poljak/terraform-step-debug/internal/model"
+)
+
+// newTestTUI returns a TUI that renders to the null device and reads the
+// given keys, without touching the terminal
+func newTestTUI(t *testing.T, keys ...string) *TUI {
+	t.Helper()
+	out, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { out.Close() })
+
+	tui := &TUI{
+		out:   out,
+		keys:  make(chan string, len(keys)),
+		line:  NewUI(),
+		theme: DefaultTheme(),
+	}
+	for _, key := range keys {
+		tui.keys <- key
+	}
+	close(tui.keys)
+	return tui
+}
+
+func TestTUIGetUserAction(t *testing.T) {
+	resource := &model.Resource{Address: "aws_subnet.a", Action: model.ActionDelete}
+
+	tests := []struct {
+		key      string
+		action   model.StepAction
+		argument string
+	}{
+		{"a", model.StepApply, ""},
+		{"A", model.StepApply, ""},
+		{"d", model.StepDetail, ""},
+		{"D", model.StepTeardown, "aws_subnet.a"},
+		{"g", model.StepJump, "aws_subnet.a"},
+		{"x", model.StepAbort, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			tui := newTestTUI(t, tt.key)
+			tui.items = []*model.Resource{resource}
+
+			answer, err := tui.GetUserAction()
+			if err != nil {
+				t.Fatalf("GetUserAction: %v", err)
+			}
+			if answer.Action != tt.action || answer.Argument != tt.argument {
+				t.Errorf("key %q = %q %q, want %q %q", tt.key, answer.Action, answer.Argument, tt.action, tt.argument)
+			}
+		})
+	}
+}
+
+func TestTUIRenderTheme(t *testing.T) {
+	plan := &model.Plan{Workspace: "default"}
+	resources := []*model.Resource{
+		{Address: "aws_vpc.main", Action: model.ActionCreate, Status: model.StatusComplete},
+		{Address: "aws_subnet.a", Action: model.ActionDelete, Breakpoint: true, Group: []string{"aws_instance.web"},
+			Checks: []*model.Check{{Address: "check.health", Status: model.CheckFail}}},
+	}
+
+	// Moving the cursor and clearing rows is needed even without colors
+	cursor := strings.NewReplacer("\x1b[H", "", "\x1b[K", "")
+
+	tests := []struct {
+		name    string
+		theme   Theme
+		escapes bool
+	}{
+		{"default theme", DefaultTheme(), true},
+		{"no color", NoColorTheme(), false},
+	}
+	for _, tt := range tests {
+		for _, view := range []detailView{viewDiff, viewDependencies} {
+			t.Run(tt.name, func(t *testing.T) {
+				out, err := os.CreateTemp(t.TempDir(), "screen")
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer out.Close()
+
+				tui := &TUI{out: out, theme: tt.theme, plan: plan, items: resources, selected: 1, view: view, status: "a=apply"}
+				tui.render()
+
+				screen, err := os.ReadFile(out.Name())
+				if err != nil {
+					t.Fatal(err)
+				}
+				text := cursor.Replace(string(screen))
+				if got := strings.Contains(text, "\x1b["); got != tt.escapes {
+					t.Errorf("screen contains escape sequences = %v, want %v:\n%q", got, tt.escapes, text)
+				}
+				if !tt.escapes && !strings.Contains(text, "» aws_subnet.a") {
+					t.Errorf("selection is not marked without colors:\n%s", text)
+				}
+			})
+		}
+	}
+}
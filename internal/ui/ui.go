@@ -4,10 +4,12 @@ import (
 	"bufio"
 	"fmt"
 	"os"
+	"sort"
 	"strings"
 	"time"
 
 	"github.com/marc-poljak/terraform-step-debug/internal/model"
+	"github.com/marc-poljak/terraform-step-debug/internal/risk"
 )
 
 // Colors for the terminal output
@@ -20,33 +22,138 @@ const (
 	colorCyan   = "\033[36m"
 	colorReset  = "\033[0m"
 	colorBold   = "\033[1m"
+	colorInvert = "\033[7m"
 )
 
 // UI handles user interaction during the debugging process
 type UI struct {
 	reader *bufio.Reader
+	theme  Theme
 }
 
 // NewUI creates a new UI
 func NewUI() *UI {
 	return &UI{
 		reader: bufio.NewReader(os.Stdin),
+		theme:  DefaultTheme(),
 	}
 }
 
+// SetTheme sets the colors of the output. Use NoColorTheme to disable colors.
+func (u *UI) SetTheme(theme Theme) {
+	u.theme = theme
+}
+
 // DisplayPlanSummary displays a summary of the plan
 func (u *UI) DisplayPlanSummary(plan *model.Plan) {
-	fmt.Println(colorBold + "Terraform Step Debugger" + colorReset)
+	fmt.Println(u.theme.Bold + "Terraform Step Debugger" + u.theme.Reset)
 	fmt.Println("Plan file:", plan.PlanFile)
 	fmt.Println("Directory:", plan.TerraformDir)
+	if plan.Workspace != "" {
+		fmt.Printf("Workspace: %s%s%s\n", u.theme.Bold, plan.Workspace, u.theme.Reset)
+	}
+	if plan.Backend != "" {
+		fmt.Println("Backend:", plan.Backend)
+	}
+	if plan.Mode != model.ModeNormal {
+		fmt.Printf("Mode: %s%s%s\n", u.theme.Bold, plan.Mode, u.theme.Reset)
+	}
 	fmt.Println()
 
-	fmt.Println(colorBold + "Plan Summary:" + colorReset)
-	fmt.Printf("  %sCreates:%s %d\n", colorGreen, colorReset, plan.Stats.Create)
-	fmt.Printf("  %sUpdates:%s %d\n", colorYellow, colorReset, plan.Stats.Update)
-	fmt.Printf("  %sDeletes:%s %d\n", colorRed, colorReset, plan.Stats.Delete)
-	fmt.Printf("  %sNoops:%s %d\n", colorBlue, colorReset, plan.Stats.Noop)
+	fmt.Println(u.theme.Bold + "Plan Summary:" + u.theme.Reset)
+	fmt.Printf("  %sCreates:%s %d\n", u.theme.Create, u.theme.Reset, plan.Stats.Create)
+	fmt.Printf("  %sUpdates:%s %d\n", u.theme.Update, u.theme.Reset, plan.Stats.Update)
+	fmt.Printf("  %sDeletes:%s %d\n", u.theme.Delete, u.theme.Reset, plan.Stats.Delete)
+	fmt.Printf("  %sReplaces:%s %d\n", u.theme.Delete, u.theme.Reset, plan.Stats.Replace)
+	fmt.Printf("  %sNoops:%s %d\n", u.theme.Noop, u.theme.Reset, plan.Stats.Noop)
+	if plan.Stats.Read > 0 {
+		fmt.Printf("  %sReads:%s %d\n", u.theme.Read, u.theme.Reset, plan.Stats.Read)
+	}
+	if plan.Stats.Refresh > 0 {
+		fmt.Printf("  %sRefreshes:%s %d\n", u.theme.Read, u.theme.Reset, plan.Stats.Refresh)
+	}
+	if plan.Stats.Import+plan.Stats.Move+plan.Stats.Forget > 0 {
+		fmt.Printf("  %sImports:%s %d, %sMoves:%s %d, %sForgets:%s %d\n",
+			u.theme.Read, u.theme.Reset, plan.Stats.Import, u.theme.Read, u.theme.Reset, plan.Stats.Move,
+			u.theme.Read, u.theme.Reset, plan.Stats.Forget)
+	}
 	fmt.Println()
+
+	// Display how many checks pass, fail or are unknown so far
+	if len(plan.Checks) > 0 {
+		counts := make(map[model.CheckStatus]int)
+		for _, check := range plan.Checks {
+			counts[check.Status]++
+		}
+		fmt.Printf("%sChecks:%s %d pass, %d fail, %d error, %d unknown\n\n", u.theme.Bold, u.theme.Reset,
+			counts[model.CheckPass], counts[model.CheckFail], counts[model.CheckError], counts[model.CheckUnknown])
+	}
+
+	// Display the resources changed outside Terraform, and what the plan does about it
+	if len(plan.Drift) > 0 {
+		fmt.Printf("%sDrift (changed outside Terraform):%s %d\n", u.theme.Bold, u.theme.Reset, len(plan.Drift))
+		for _, drift := range plan.Drift {
+			u.printWrapped("  ", "- ", fmt.Sprintf("%s %s; %s", drift.Address, driftText(drift), driftOutcome(plan, drift)), u.theme.Warning)
+		}
+		if hint := driftHint(plan); hint != "" {
+			fmt.Println(hint)
+		}
+		fmt.Println()
+	}
+
+	// Display how many changes are risky, and list the riskiest ones
+	levels := make(map[risk.Level]int)
+	var high []*model.Resource
+	for _, resource := range plan.Resources {
+		if resource.Action == model.ActionNoop {
+			continue
+		}
+		level := risk.LevelOf(resource.Risk)
+		levels[level]++
+		if level == risk.LevelHigh {
+			high = append(high, resource)
+		}
+	}
+	if len(levels) > 0 {
+		fmt.Printf("%sRisk:%s %d high, %d medium, %d low\n", u.theme.Bold, u.theme.Reset,
+			levels[risk.LevelHigh], levels[risk.LevelMedium], levels[risk.LevelLow])
+		sort.SliceStable(high, func(i, j int) bool { return high[i].Risk > high[j].Risk })
+		for _, resource := range high {
+			u.printWrapped("  ", "- ", fmt.Sprintf("%s (%d)", resource.Address, resource.Risk), u.theme.Risk(risk.LevelHigh))
+		}
+		fmt.Println()
+	}
+
+	// Display the outputs that change, and whether their value is known yet
+	changing := 0
+	for _, output := range plan.Outputs {
+		if output.Action != model.ActionNoop {
+			changing++
+		}
+	}
+	if changing > 0 {
+		fmt.Println(u.theme.Bold + "Output Changes:" + u.theme.Reset)
+		for _, output := range plan.Outputs {
+			if output.Action == model.ActionNoop {
+				continue
+			}
+			note := ""
+			if output.Unknown {
+				note = " (known after apply)"
+			}
+			fmt.Printf("  %s%s%s %s%s\n", u.theme.Action(output.Action), output.Action, u.theme.Reset, output.Name, note)
+		}
+		fmt.Println()
+	}
+
+	// Display the changes Terraform postponed to a later plan
+	if len(plan.Deferred) > 0 {
+		fmt.Println(u.theme.Bold + "Deferred Changes (not in this plan):" + u.theme.Reset)
+		for _, change := range plan.Deferred {
+			u.printWrapped("  ", "- ", fmt.Sprintf("%s (%s): %s", change.Address, change.Action, change.Reason), u.theme.Skipped)
+		}
+		fmt.Println()
+	}
 }
 
 // DisplayResourceInfo displays information about a resource
@@ -57,47 +164,237 @@ func (u *UI) DisplayResourceInfo(resource *model.Resource, index, total int) {
 	// Display the progress
 	fmt.Printf("[%d/%d] %.1f%% complete\n", index, total, percent)
 
-	// Display the resource information with appropriate color
-	var color string
-	switch resource.Action {
-	case model.ActionCreate:
-		color = colorGreen
-	case model.ActionUpdate:
-		color = colorYellow
-	case model.ActionDelete:
-		color = colorRed
-	default:
-		color = colorReset
+	// Print the resource information, wrapping long addresses to the terminal width
+	fmt.Println()
+	u.printWrapped("", "Resource: ", resource.Address, u.theme.Bold)
+	fmt.Printf("  %sAction:%s %s%s%s\n", u.theme.Bold, u.theme.Reset,
+		u.theme.Action(resource.Action), resource.Action, u.theme.Reset)
+	fmt.Printf("  %sType:%s %s\n", u.theme.Bold, u.theme.Reset, resource.Type)
+	if resource.ImportID != "" {
+		u.printWrapped("  ", "Import ID: ", resource.ImportID, "")
 	}
-
-	// Print the resource information
-	fmt.Printf("\n%sResource: %s%s\n", colorBold, resource.Address, colorReset)
-	fmt.Printf("  %sAction:%s %s%s%s\n", colorBold, colorReset, color, resource.Action, colorReset)
-	fmt.Printf("  %sType:%s %s\n", colorBold, colorReset, resource.Type)
+	if resource.PreviousAddress != "" {
+		u.printWrapped("  ", "Moved from: ", resource.PreviousAddress, "")
+	}
+	if resource.FollowUp != "" {
+		fmt.Printf("  %sThen:%s %s%s%s in dependency order\n", u.theme.Bold, u.theme.Reset,
+			u.theme.Action(resource.FollowUp), resource.FollowUp, u.theme.Reset)
+	}
+	if len(resource.Group) > 0 {
+		u.printWrapped("  ", "Tears down with: ", strings.Join(resource.Group, ", "), u.theme.Warning)
+	}
+	if resource.Drift != nil {
+		u.printWrapped("  ", "Drift: ", driftText(resource.Drift), u.theme.Warning)
+	}
+	if resource.DriftCaused {
+		u.printWrapped("  ", "Caused by drift: ", "the planned change only undoes the changes made outside Terraform", u.theme.Warning)
+	}
+	if resource.ReadReason != "" {
+		u.printWrapped("  ", "Read because: ", resource.ReadReason, "")
+	}
+	if len(resource.UnknownInputs) > 0 {
+		u.printWrapped("  ", "Unknown inputs: ", strings.Join(resource.UnknownInputs, ", "), "")
+	}
+	if len(resource.ReadTriggers) > 0 {
+		u.printWrapped("  ", "Triggered by: ", strings.Join(resource.ReadTriggers, ", "), "")
+	}
+	u.printWrapped("  ", "Risk: ", riskText(resource), u.theme.Risk(risk.LevelOf(resource.Risk)))
 
 	// Display dependencies if any
 	if len(resource.Dependencies) > 0 {
-		fmt.Printf("  %sDependencies:%s\n", colorBold, colorReset)
+		fmt.Printf("  %sDependencies:%s\n", u.theme.Bold, u.theme.Reset)
 		for _, dep := range resource.Dependencies {
-			fmt.Printf("    - %s\n", dep)
+			u.printWrapped("    ", "- ", dep, "")
+		}
+	}
+
+	// Point out resources that must not be applied with a single keystroke
+	if resource.Blocked != "" {
+		u.printWrapped("  ", "Blocked: ", resource.Blocked, u.theme.Failed)
+	} else if resource.Protected != "" {
+		u.printWrapped("  ", "Protected: ", resource.Protected, u.theme.Warning)
+	}
+
+	// Display the root outputs that refer to the resource
+	if len(resource.Outputs) > 0 {
+		u.printWrapped("  ", "Affects outputs: ", strings.Join(resource.Outputs, ", "), "")
+	}
+
+	// Display the checks about the resource with their latest result
+	if len(resource.Checks) > 0 {
+		fmt.Printf("  %sChecks:%s\n", u.theme.Bold, u.theme.Reset)
+		for _, check := range resource.Checks {
+			u.printWrapped("    ", "- ", fmt.Sprintf("%s (%s)", check.Address, check.Status), u.theme.Check(check.Status))
 		}
 	}
 
 	// Display warnings if any
 	if len(resource.Warnings) > 0 {
-		fmt.Printf("  %sWarnings:%s\n", colorBold, colorReset)
+		fmt.Printf("  %sWarnings:%s\n", u.theme.Bold, u.theme.Reset)
 		for _, warning := range resource.Warnings {
-			fmt.Printf("    - %s%s%s\n", colorYellow, warning, colorReset)
+			u.printWrapped("    ", "- ", warning, u.theme.Warning)
 		}
 	}
 
 	fmt.Println()
 }
 
-// GetUserAction gets the action to take for the current step
-func (u *UI) GetUserAction() (model.StepAction, error) {
+// lineCommands describes the commands of the step prompt, shown with "?"
+var lineCommands = []struct{ keys, description string }{
+	{"a, apply", "Apply the current resource"},
+	{"s, skip", "Skip the current resource"},
+	{"c, continue", "Apply resources until the next breakpoint"},
+	{"b, break [address]", "Set or clear a breakpoint on the current or given resource"},
+	{"d, detail", "Show the Terraform diff of the current resource"},
+	{"i, inspect [address]", "Show state, planned values and dependents"},
+	{"m, impact [address]", "Show the blast radius: transitive dependents, deletes and outputs"},
+	{"e, eval <expression>", "Evaluate a Terraform expression against the state"},
+	{"w, watch [expression]", "Watch an expression after every applied step, or show the watch list"},
+	{"u, unwatch <number>", "Remove an expression from the watch list"},
+	{"p, postpone", "Move the current resource to the end of its layer"},
+	{"j, jump <address>", "Continue with another pending or skipped resource"},
+	{"k, teardown [address]", "In destroy mode, destroy a resource together with its pending dependents"},
+	{"l, list", "List the remaining steps"},
+	{"/<text>, search <text>", "Search resources by address, or /regex/"},
+	{"h, history", "Show the decisions made so far"},
+	{"t, snapshots [diff <a> [b] | restore <n>]", "List, compare or restore the state snapshots"},
+	{"r, replan", "Generate a fresh plan for the remaining steps"},
+	{"z, rollback", "Undo the applied steps in reverse order, then stop"},
+	{"x, abort", "Abort the execution"},
+}
+
+// argumentPrompts asks for the argument of actions that require one
+var argumentPrompts = map[model.StepAction]string{
+	model.StepJump:    "Jump to (address or part of it): ",
+	model.StepSearch:  "Search (text, or /regex/): ",
+	model.StepEval:    "Expression: ",
+	model.StepUnwatch: "Unwatch (number or expression): ",
+}
+
+// GetUserAction gets the action to take for the current step. Commands
+// that need an argument take it after the command, or ask for it.
+func (u *UI) GetUserAction() (Answer, error) {
+	actions := map[string]model.StepAction{
+		"a": model.StepApply, "apply": model.StepApply,
+		"s": model.StepSkip, "skip": model.StepSkip,
+		"c": model.StepContinue, "continue": model.StepContinue,
+		"b": model.StepBreak, "break": model.StepBreak,
+		"d": model.StepDetail, "detail": model.StepDetail,
+		"i": model.StepInspect, "inspect": model.StepInspect,
+		"m": model.StepImpact, "impact": model.StepImpact,
+		"e": model.StepEval, "eval": model.StepEval,
+		"w": model.StepWatch, "watch": model.StepWatch,
+		"u": model.StepUnwatch, "unwatch": model.StepUnwatch,
+		"p": model.StepPostpone, "postpone": model.StepPostpone,
+		"j": model.StepJump, "jump": model.StepJump,
+		"k": model.StepTeardown, "teardown": model.StepTeardown,
+		"l": model.StepList, "list": model.StepList,
+		"/": model.StepSearch, "search": model.StepSearch,
+		"h": model.StepHistory, "history": model.StepHistory,
+		"t": model.StepSnapshots, "snapshots": model.StepSnapshots,
+		"r": model.StepReplan, "replan": model.StepReplan,
+		"z": model.StepRollback, "rollback": model.StepRollback,
+		"x": model.StepAbort, "abort": model.StepAbort,
+	}
+
+	for {
+		fmt.Print(u.theme.Bold + "Action" + u.theme.Reset + " [a=apply, s=skip, c=continue, d=detail, r=replan, x=abort, ?=more]: ")
+		input, err := u.reader.ReadString('\n')
+		if err != nil {
+			return Answer{}, fmt.Errorf("failed to read input: %w", err)
+		}
+
+		input = expandSearch(strings.TrimSpace(input))
+
+		word, argument := parseAnswer(input)
+		if word == "?" || word == "help" {
+			u.displayCommands()
+			continue
+		}
+		action, ok := actions[word]
+		if !ok {
+			fmt.Println("Invalid action. Please try again.")
+			continue
+		}
+
+		if prompt, required := argumentPrompts[action]; required && argument == "" {
+			argument, err = u.readArgument(prompt)
+			if err != nil {
+				return Answer{}, err
+			}
+			if argument == "" {
+				continue
+			}
+		}
+
+		return Answer{Action: action, Argument: argument}, nil
+	}
+}
+
+// expandSearch lets the search pattern follow the slash directly, as in
+// "/bucket". A pattern written as /regex/ is kept whole, so the search
+// can tell it from text.
+func expandSearch(input string) string {
+	if !strings.HasPrefix(input, "/") {
+		return input
+	}
+	if len(input) > 2 && strings.HasSuffix(input, "/") {
+		return "/ " + input
+	}
+	return "/ " + input[1:]
+}
+
+// displayCommands lists the commands of the step prompt
+func (u *UI) displayCommands() {
+	fmt.Println(u.theme.Bold + "Commands:" + u.theme.Reset)
+	for _, command := range lineCommands {
+		fmt.Printf("  %-24s %s\n", command.keys, command.description)
+	}
+}
+
+// readArgument prompts for the argument of an action
+func (u *UI) readArgument(prompt string) (string, error) {
+	fmt.Print(prompt)
+	input, err := u.reader.ReadString('\n')
+	if err != nil {
+		return "", fmt.Errorf("failed to read input: %w", err)
+	}
+	return strings.TrimSpace(input), nil
+}
+
+// DisplayPlanDiff displays how re-planning changed the pending steps
+func (u *UI) DisplayPlanDiff(diff *model.PlanDiff, remaining int) {
+	fmt.Printf("\n%sRe-planned:%s %d resources remaining\n", u.theme.Bold, u.theme.Reset, remaining)
+
+	if len(diff.Added) == 0 && len(diff.Removed) == 0 && len(diff.Changed) == 0 {
+		fmt.Println("  The pending steps are unchanged.")
+		fmt.Println()
+		return
+	}
+
+	for _, resource := range diff.Added {
+		fmt.Printf("  %s+ new:%s     %s (%s)\n", u.theme.Create, u.theme.Reset, resource.Address, resource.Action)
+	}
+	for _, resource := range diff.Removed {
+		fmt.Printf("  %s- gone:%s    %s (%s)\n", u.theme.Delete, u.theme.Reset, resource.Address, resource.Action)
+	}
+	for _, change := range diff.Changed {
+		if change.Previous.Action != change.Current.Action {
+			fmt.Printf("  %s~ changed:%s %s (%s -> %s)\n", u.theme.Update, u.theme.Reset,
+				change.Current.Address, change.Previous.Action, change.Current.Action)
+		} else {
+			fmt.Printf("  %s~ changed:%s %s (%s, different values)\n", u.theme.Update, u.theme.Reset,
+				change.Current.Address, change.Current.Action)
+		}
+	}
+	fmt.Println()
+}
+
+// GetInterruptedAction asks what to do after a step was cancelled or timed out
+func (u *UI) GetInterruptedAction(resource *model.Resource) (model.StepAction, error) {
+	fmt.Printf("%sStep %s:%s %s\n", u.theme.Interrupted, resource.Status, u.theme.Reset, resource.Address)
 	for {
-		fmt.Print(colorBold + "Action" + colorReset + " [a=apply, s=skip, d=detail, x=abort]: ")
+		fmt.Print(u.theme.Bold + "Action" + u.theme.Reset + " [r=retry, s=skip, x=abort]: ")
 		input, err := u.reader.ReadString('\n')
 		if err != nil {
 			return "", fmt.Errorf("failed to read input: %w", err)
@@ -106,12 +403,10 @@ func (u *UI) GetUserAction() (model.StepAction, error) {
 		input = strings.TrimSpace(strings.ToLower(input))
 
 		switch input {
-		case "a", "apply":
-			return model.StepApply, nil
+		case "r", "retry":
+			return model.StepRetry, nil
 		case "s", "skip":
 			return model.StepSkip, nil
-		case "d", "detail":
-			return model.StepDetail, nil
 		case "x", "abort":
 			return model.StepAbort, nil
 		default:
@@ -120,66 +415,137 @@ func (u *UI) GetUserAction() (model.StepAction, error) {
 	}
 }
 
+// GetStaleAction asks what to do when the plan no longer matches the state or
+// configuration. Continuing is only offered when allowContinue is set.
+func (u *UI) GetStaleAction(reasons []string, allowContinue bool) (model.StepAction, error) {
+	fmt.Printf("%sThe plan is stale:%s\n", u.theme.Warning, u.theme.Reset)
+	for _, reason := range reasons {
+		fmt.Printf("  - %s\n", reason)
+	}
+
+	prompt := " [r=replan, x=abort]: "
+	if allowContinue {
+		prompt = " [c=continue, r=replan, x=abort]: "
+	}
+
+	for {
+		fmt.Print(u.theme.Bold + "Action" + u.theme.Reset + prompt)
+		input, err := u.reader.ReadString('\n')
+		if err != nil {
+			return "", fmt.Errorf("failed to read input: %w", err)
+		}
+
+		input = strings.TrimSpace(strings.ToLower(input))
+
+		switch {
+		case allowContinue && (input == "c" || input == "continue"):
+			return model.StepContinue, nil
+		case input == "r" || input == "replan":
+			return model.StepReplan, nil
+		case input == "x" || input == "abort":
+			return model.StepAbort, nil
+		default:
+			fmt.Println("Invalid action. Please try again.")
+		}
+	}
+}
+
 // DisplayExecutionResult displays the result of executing a resource
 func (u *UI) DisplayExecutionResult(resource *model.Resource, success bool, elapsed time.Duration) {
 	if success {
 		fmt.Printf("%sSuccess:%s Applied %s in %.2f seconds\n\n",
-			colorGreen, colorReset, resource.Address, elapsed.Seconds())
+			u.theme.Complete, u.theme.Reset, resource.Address, elapsed.Seconds())
 	} else {
 		fmt.Printf("%sFailure:%s Could not apply %s (%.2f seconds)\n\n",
-			colorRed, colorReset, resource.Address, elapsed.Seconds())
+			u.theme.Failed, u.theme.Reset, resource.Address, elapsed.Seconds())
 	}
 }
 
 // DisplaySummary displays a summary of the execution
 func (u *UI) DisplaySummary(executedResources []*model.Resource) {
-	fmt.Println(colorBold + "Execution Summary:" + colorReset)
+	fmt.Println(u.theme.Bold + "Execution Summary:" + u.theme.Reset)
 
 	// Count resources by status
-	completed := 0
-	skipped := 0
-	failed := 0
-
+	counts := make(map[model.ResourceStatus]int)
 	for _, res := range executedResources {
-		switch res.Status {
-		case model.StatusComplete:
-			completed++
-		case model.StatusSkipped:
-			skipped++
-		case model.StatusFailed:
-			failed++
-		}
+		counts[res.Status]++
 	}
 
 	// Display the counts
-	fmt.Printf("  %sCompleted:%s %d\n", colorGreen, colorReset, completed)
-	fmt.Printf("  %sSkipped:%s %d\n", colorYellow, colorReset, skipped)
-	fmt.Printf("  %sFailed:%s %d\n", colorRed, colorReset, failed)
+	fmt.Printf("  %sCompleted:%s %d\n", u.theme.Complete, u.theme.Reset, counts[model.StatusComplete])
+	fmt.Printf("  %sSkipped:%s %d\n", u.theme.Skipped, u.theme.Reset, counts[model.StatusSkipped])
+	fmt.Printf("  %sFailed:%s %d\n", u.theme.Failed, u.theme.Reset, counts[model.StatusFailed])
+	if interrupted := counts[model.StatusCanceled] + counts[model.StatusTimeout]; interrupted > 0 {
+		fmt.Printf("  %sInterrupted:%s %d\n", u.theme.Interrupted, u.theme.Reset, interrupted)
+	}
 
 	// Display detailed resource status
 	fmt.Println("\nResource Status:")
 	for _, res := range executedResources {
-		var statusColor string
-		switch res.Status {
-		case model.StatusComplete:
-			statusColor = colorGreen
-		case model.StatusSkipped:
-			statusColor = colorYellow
-		case model.StatusFailed:
-			statusColor = colorRed
-		default:
-			statusColor = colorReset
+		lines := wrapText(res.Address+":", wrapWidth(len(res.Status)+3))
+		for _, line := range lines[:len(lines)-1] {
+			fmt.Printf("  %s\n", line)
 		}
-
-		fmt.Printf("  %s: %s%s%s\n", res.Address, statusColor, res.Status, colorReset)
+		fmt.Printf("  %s %s%s%s\n", lines[len(lines)-1], u.theme.Status(res.Status), res.Status, u.theme.Reset)
+		u.displayAttempts(res.Attempts)
 	}
 
 	fmt.Println()
 }
 
+// displayAttempts lists the apply attempts of a resource when any of them failed
+func (u *UI) displayAttempts(attempts []model.Attempt) {
+	if len(attempts) < 2 && (len(attempts) == 0 || attempts[0].Error == "") {
+		return
+	}
+
+	for _, attempt := range attempts {
+		if attempt.Error == "" {
+			fmt.Printf("    Attempt %d: %ssucceeded%s (%.2f seconds)\n",
+				attempt.Number, u.theme.Complete, u.theme.Reset, attempt.Duration.Seconds())
+			continue
+		}
+
+		outcome := "failed"
+		if attempt.RetryRule != "" {
+			outcome = fmt.Sprintf("failed, retried as %s", attempt.RetryRule)
+		}
+		fmt.Printf("    Attempt %d: %s%s%s (%.2f seconds)\n",
+			attempt.Number, u.theme.Failed, outcome, u.theme.Reset, attempt.Duration.Seconds())
+		for _, line := range strings.Split(attempt.Error, "\n") {
+			fmt.Printf("      %s\n", line)
+		}
+	}
+}
+
 // ConfirmContinue asks the user if they want to continue after an error
 func (u *UI) ConfirmContinue() bool {
-	fmt.Print(colorBold + "Continue" + colorReset + " despite errors? [y/n]: ")
+	fmt.Print(u.theme.Bold + "Continue" + u.theme.Reset + " despite errors? [y/n]: ")
+	input, err := u.reader.ReadString('\n')
+	if err != nil {
+		return false
+	}
+
+	input = strings.TrimSpace(strings.ToLower(input))
+	return input == "y" || input == "yes"
+}
+
+// ConfirmAbort asks the user to confirm aborting the execution
+func (u *UI) ConfirmAbort() bool {
+	fmt.Print("Are you sure you want to abort? [y/n]: ")
+	input, err := u.reader.ReadString('\n')
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading confirmation: %s\n", err)
+		return false
+	}
+
+	input = strings.TrimSpace(input)
+	return input == "y" || input == "Y"
+}
+
+// ConfirmRestore asks the user to confirm pushing a snapshot as the current state
+func (u *UI) ConfirmRestore() bool {
+	fmt.Print(u.theme.Warning + "Push the snapshot as the current state?" + u.theme.Reset + " [y/n]: ")
 	input, err := u.reader.ReadString('\n')
 	if err != nil {
 		return false
@@ -189,8 +555,178 @@ func (u *UI) ConfirmContinue() bool {
 	return input == "y" || input == "yes"
 }
 
+// ConfirmAddress asks the user to type the full address of a protected
+// resource to confirm that it is deleted or replaced
+func (u *UI) ConfirmAddress(resource *model.Resource) (Answer, error) {
+	fmt.Printf("%s%s will be %s.%s\n", u.theme.Warning, resource.Address, pastTense(resource.Action), u.theme.Reset)
+	input, err := u.readArgument("Type the full address to confirm, or press Enter to cancel: ")
+	if err != nil || input == "" {
+		return Answer{Action: model.StepNo}, err
+	}
+	return Answer{Action: model.StepYes, Argument: input}, nil
+}
+
+// Close is a no-op, as the line-based UI does not change the terminal
+func (u *UI) Close() {}
+
 // WaitForEnter waits for the user to press Enter
 func (u *UI) WaitForEnter() {
 	fmt.Print("Press Enter to continue...")
 	_, _ = u.reader.ReadString('\n')
 }
+
+// PlanLoaded displays the plan summary
+func (u *UI) PlanLoaded(plan *model.Plan, graph *model.ExecutionGraph) {
+	u.DisplayPlanSummary(plan)
+}
+
+// PlanReplanned displays how re-planning changed the pending steps
+func (u *UI) PlanReplanned(plan *model.Plan, graph *model.ExecutionGraph, diff *model.PlanDiff) {
+	u.DisplayPlanDiff(diff, len(plan.Resources))
+}
+
+// StepStarted displays the resource waiting for a decision
+func (u *UI) StepStarted(resource *model.Resource, index, total int) {
+	u.DisplayResourceInfo(resource, index, total)
+}
+
+// RequestDecision prompts for the answer to a decision
+func (u *UI) RequestDecision(decision Decision) (Answer, error) {
+	var action model.StepAction
+	var err error
+
+	switch decision.Kind {
+	case DecisionStep:
+		return u.GetUserAction()
+	case DecisionInterrupted:
+		action, err = u.GetInterruptedAction(decision.Resource)
+	case DecisionStale:
+		action, err = u.GetStaleAction(decision.Reasons, decision.Allows(model.StepContinue))
+	case DecisionContinue:
+		action = yesNo(u.ConfirmContinue())
+	case DecisionConfirmAbort:
+		action = yesNo(u.ConfirmAbort())
+	case DecisionAcknowledge:
+		u.WaitForEnter()
+		action = model.StepYes
+	case DecisionConfirmAddress:
+		return u.ConfirmAddress(decision.Resource)
+	case DecisionConfirmRestore:
+		action = yesNo(u.ConfirmRestore())
+	default:
+		err = fmt.Errorf("unknown decision %q", decision.Kind)
+	}
+	return Answer{Action: action}, err
+}
+
+// Output prints Terraform output and progress messages
+func (u *UI) Output(stream Stream, text string) {
+	if stream == StreamError {
+		fmt.Fprint(os.Stderr, text)
+		return
+	}
+	fmt.Print(text)
+}
+
+// StepFinished displays the result of a step
+func (u *UI) StepFinished(resource *model.Resource, err error, elapsed time.Duration) {
+	u.DisplayExecutionResult(resource, err == nil, elapsed)
+}
+
+// Summary displays the execution summary
+func (u *UI) Summary(executedResources []*model.Resource) {
+	u.DisplaySummary(executedResources)
+}
+
+// printWrapped prints text after indent and label, wrapped to the terminal
+// width with continuation lines aligned to the text
+func (u *UI) printWrapped(indent, label, text, color string) {
+	margin := strings.Repeat(" ", len(indent)+len(label))
+	for i, line := range wrapText(text, wrapWidth(len(margin))) {
+		prefix := margin
+		if i == 0 {
+			prefix = indent + label
+		}
+		fmt.Printf("%s%s%s%s\n", prefix, color, line, u.theme.Reset)
+	}
+}
+
+// wrapWidth returns the width available for text after a margin, or 0 when
+// the output is not wrapped
+func wrapWidth(margin int) int {
+	width := outputWidth()
+	if width == 0 {
+		return 0
+	}
+	return max(width-margin, 20)
+}
+
+// pastTense describes what happens to a resource in a confirmation
+func pastTense(action model.Action) string {
+	switch action {
+	case model.ActionReplace:
+		return "replaced"
+	case model.ActionDelete:
+		return "deleted"
+	case model.ActionForget:
+		return "forgotten"
+	case model.ActionRead:
+		return "read"
+	default:
+		return strings.TrimSuffix(string(action), "e") + "ed"
+	}
+}
+
+// driftText describes what changed outside Terraform
+func driftText(drift *model.Drift) string {
+	if drift.Action == model.ActionDelete {
+		return "deleted outside Terraform"
+	}
+	if len(drift.Attributes) == 0 {
+		return "changed outside Terraform"
+	}
+	return "changed outside Terraform: " + strings.Join(drift.Attributes, ", ")
+}
+
+// driftOutcome describes what the plan does about a drifted resource
+func driftOutcome(plan *model.Plan, drift *model.Drift) string {
+	resource, ok := plan.ResourcesMap[drift.Address]
+	switch {
+	case !ok:
+		return "accepted into the state by the next full apply"
+	case resource.Action == model.ActionRefresh:
+		return "refreshed into the state by a step of its own"
+	case resource.DriftCaused:
+		return fmt.Sprintf("undone by the planned %s", resource.Action)
+	default:
+		return fmt.Sprintf("planned %s", resource.Action)
+	}
+}
+
+// driftHint points to drift steps when drifted resources without a planned
+// change are left to be accepted by the next apply
+func driftHint(plan *model.Plan) string {
+	for _, drift := range plan.Drift {
+		if _, ok := plan.ResourcesMap[drift.Address]; !ok {
+			return "Use --drift-steps to accept these changes one resource at a time instead."
+		}
+	}
+	return ""
+}
+
+// riskText describes the risk score of a resource and what contributes to it
+func riskText(resource *model.Resource) string {
+	text := fmt.Sprintf("%d (%s)", resource.Risk, risk.LevelOf(resource.Risk))
+	if len(resource.RiskReasons) > 0 {
+		text += ": " + strings.Join(resource.RiskReasons, ", ")
+	}
+	return text
+}
+
+// yesNo converts the answer to a confirmation into a step action
+func yesNo(confirmed bool) model.StepAction {
+	if confirmed {
+		return model.StepYes
+	}
+	return model.StepNo
+}
@@ -0,0 +1,57 @@
+package ui
+
+import (
+	"testing"
+
+	"github.com/marc-poljak/terraform-step-debug/internal/model"
+)
+
+func TestExpandSearch(t *testing.T) {
+	tests := []struct {
+		input    string
+		argument string
+	}{
+		{"/bucket", "bucket"},
+		{"/ bucket", "bucket"},
+		{"/^aws_s3/", "/^aws_s3/"},
+		{"/aws_(s3|iam)_.*/", "/aws_(s3|iam)_.*/"},
+		{"/", ""},
+		{"//", "/"},
+		{"search /^aws/", "/^aws/"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			_, argument := parseAnswer(expandSearch(tt.input))
+			if argument != tt.argument {
+				t.Errorf("search argument of %q = %q, want %q", tt.input, argument, tt.argument)
+			}
+		})
+	}
+}
+
+func TestDriftHint(t *testing.T) {
+	tests := []struct {
+		name  string
+		drift string
+		plan  []string // Addresses with a planned change
+		want  bool
+	}{
+		{name: "no drift"},
+		{name: "drift with a planned change", drift: "aws_instance.web", plan: []string{"aws_instance.web"}},
+		{name: "drift without a planned change", drift: "aws_instance.web", plan: []string{"aws_vpc.main"}, want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plan := model.NewPlan("", "")
+			for _, address := range tt.plan {
+				plan.ResourcesMap[address] = &model.Resource{Address: address, Action: model.ActionUpdate}
+			}
+			if tt.drift != "" {
+				plan.Drift = []*model.Drift{{Address: tt.drift, Action: model.ActionUpdate}}
+			}
+			if got := driftHint(plan) != ""; got != tt.want {
+				t.Errorf("driftHint = %q, want a hint %v", driftHint(plan), tt.want)
+			}
+		})
+	}
+}
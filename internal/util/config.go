@@ -0,0 +1,58 @@
+package util
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// configFileSuffixes are the files in the Terraform directory that affect a plan
+var configFileSuffixes = []string{".tf", ".tf.json", ".tfvars", ".tfvars.json"}
+
+// HashConfigFiles returns the SHA-256 checksum of every configuration and
+// variable file in the Terraform directory, plus the given extra files,
+// keyed by path
+func HashConfigFiles(terraformDir string, extraFiles []string) (map[string]string, error) {
+	files, err := os.ReadDir(terraformDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read directory: %w", err)
+	}
+
+	var paths []string
+	for _, file := range files {
+		if !file.IsDir() && isConfigFile(file.Name()) {
+			paths = append(paths, filepath.Join(terraformDir, file.Name()))
+		}
+	}
+	for _, extra := range extraFiles {
+		if !filepath.IsAbs(extra) {
+			extra = filepath.Join(terraformDir, extra)
+		}
+		paths = append(paths, extra)
+	}
+
+	hashes := make(map[string]string, len(paths))
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", path, err)
+		}
+		sum := sha256.Sum256(data)
+		hashes[path] = hex.EncodeToString(sum[:])
+	}
+
+	return hashes, nil
+}
+
+// isConfigFile checks whether a file name is a Terraform configuration or variable file
+func isConfigFile(name string) bool {
+	for _, suffix := range configFileSuffixes {
+		if strings.HasSuffix(name, suffix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,24 @@
+//go:build !windows
+
+package util
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// configureProcessGroup starts the command in its own process group
+func configureProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+// interruptProcess asks the process to stop gracefully
+func interruptProcess(process *os.Process) error {
+	return process.Signal(os.Interrupt)
+}
+
+// shellArgs returns the shell and its arguments to run a command line
+func shellArgs(command string) (string, []string) {
+	return "/bin/sh", []string{"-c", command}
+}
@@ -0,0 +1,22 @@
+//go:build windows
+
+package util
+
+import (
+	"os"
+	"os/exec"
+)
+
+// configureProcessGroup is a no-op on Windows
+func configureProcessGroup(cmd *exec.Cmd) {}
+
+// interruptProcess kills the process, as Windows cannot deliver an interrupt
+// to a child process
+func interruptProcess(process *os.Process) error {
+	return process.Kill()
+}
+
+// shellArgs returns the shell and its arguments to run a command line
+func shellArgs(command string) (string, []string) {
+	return "cmd", []string{"/C", command}
+}
@@ -1,14 +1,22 @@
 package util
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
+
+	"github.com/marc-poljak/terraform-step-debug/internal/model"
 )
 
+// interruptGracePeriod is how long Terraform gets to shut down gracefully
+// after an interrupt before it is killed
+const interruptGracePeriod = 60 * time.Second
+
 // FindTerraformBinary tries to find the terraform binary in PATH
 func FindTerraformBinary() (string, error) {
 	// Try to find terraform in PATH
@@ -72,6 +80,99 @@ func FindTerraformDir(startDir string) (string, error) {
 	return "", fmt.Errorf("no Terraform files found in the directory hierarchy")
 }
 
+// TerraformCommand builds a Terraform command that is interrupted gracefully
+// when ctx is cancelled. Terraform runs in its own process group so a Ctrl-C
+// in the terminal reaches only this tool, which forwards a single interrupt.
+func TerraformCommand(ctx context.Context, terraformPath, terraformDir string, args ...string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, terraformPath, args...)
+	cmd.Dir = terraformDir
+	cmd.Cancel = func() error {
+		return interruptProcess(cmd.Process)
+	}
+	cmd.WaitDelay = interruptGracePeriod
+	configureProcessGroup(cmd)
+
+	return cmd
+}
+
+// ShellCommand creates a command that runs a command line with the system
+// shell in the given directory. Like Terraform commands, it is interrupted
+// gracefully when the context ends.
+func ShellCommand(ctx context.Context, dir, command string) *exec.Cmd {
+	shell, args := shellArgs(command)
+	return TerraformCommand(ctx, shell, dir, args...)
+}
+
+// VariableArgs returns the -var-file and -var arguments for the given inputs
+func VariableArgs(inputs model.Inputs) []string {
+	var args []string
+	for _, varFile := range inputs.VarFiles {
+		args = append(args, "-var-file", varFile)
+	}
+	for _, variable := range inputs.Vars {
+		args = append(args, "-var", variable)
+	}
+	return args
+}
+
+// ColorArgs returns -no-color when Terraform output must not contain colors
+func ColorArgs(inputs model.Inputs) []string {
+	if inputs.NoColor {
+		return []string{"-no-color"}
+	}
+	return nil
+}
+
+// PlanArgs appends the variable and extra plan arguments to a plan command
+func PlanArgs(args []string, inputs model.Inputs) []string {
+	args = append(args, ColorArgs(inputs)...)
+	args = append(args, VariableArgs(inputs)...)
+	return append(args, inputs.PlanArgs...)
+}
+
+// RefreshOnlyArgs appends the variable and shared arguments to a refresh-only
+// plan. Plan-only arguments such as -refresh=false or -replace conflict with
+// -refresh-only and are left out, as is a -refresh flag among the shared ones.
+func RefreshOnlyArgs(args []string, inputs model.Inputs) []string {
+	args = append(args, ColorArgs(inputs)...)
+	args = append(args, VariableArgs(inputs)...)
+	for _, arg := range inputs.TFArgs {
+		if arg == "-refresh" || strings.HasPrefix(arg, "-refresh=") {
+			continue
+		}
+		args = append(args, arg)
+	}
+	return args
+}
+
+// stateCommandFlags are the shared arguments that import, state mv and
+// state rm accept as well
+var stateCommandFlags = map[string]bool{
+	"-lock":                  true,
+	"-lock-timeout":          true,
+	"-ignore-remote-version": true,
+}
+
+// StateArgs appends the shared arguments about state locking to a command
+// that changes the state without a plan, such as import or state mv. Other
+// shared arguments, such as -parallelism, are not accepted by them.
+func StateArgs(args []string, inputs model.Inputs) []string {
+	for _, arg := range inputs.TFArgs {
+		name, _, _ := strings.Cut(arg, "=")
+		if stateCommandFlags[name] {
+			args = append(args, arg)
+		}
+	}
+	return args
+}
+
+// ApplyArgs appends the variable and extra apply arguments to an apply command
+func ApplyArgs(args []string, inputs model.Inputs) []string {
+	args = append(args, ColorArgs(inputs)...)
+	args = append(args, VariableArgs(inputs)...)
+	return append(args, inputs.ApplyArgs...)
+}
+
 // CreateTempPlanFile creates a temporary plan file
 func CreateTempPlanFile() (string, error) {
 	// Create a temporary file for the plan
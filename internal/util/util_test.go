@@ -0,0 +1,73 @@
+package util
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/marc-poljak/terraform-step-debug/internal/model"
+)
+
+func TestRefreshOnlyArgs(t *testing.T) {
+	tests := []struct {
+		name   string
+		inputs model.Inputs
+		want   []string
+	}{
+		{
+			name: "plan arguments are left out",
+			inputs: model.Inputs{
+				Vars:     []string{"env=prod"},
+				PlanArgs: []string{"-lock-timeout=5m", "-refresh=false", "-replace=aws_instance.web"},
+			},
+			want: []string{"plan", "-refresh-only", "-var", "env=prod"},
+		},
+		{
+			name: "shared arguments are passed",
+			inputs: model.Inputs{
+				VarFiles: []string{"prod.tfvars"},
+				TFArgs:   []string{"-lock-timeout=5m", "-parallelism=2"},
+				NoColor:  true,
+			},
+			want: []string{"plan", "-refresh-only", "-no-color", "-var-file", "prod.tfvars", "-lock-timeout=5m", "-parallelism=2"},
+		},
+		{
+			name:   "shared refresh flags are dropped",
+			inputs: model.Inputs{TFArgs: []string{"-refresh=false", "-refresh", "-lock=false"}},
+			want:   []string{"plan", "-refresh-only", "-lock=false"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := RefreshOnlyArgs([]string{"plan", "-refresh-only"}, tt.inputs); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("RefreshOnlyArgs = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStateArgs(t *testing.T) {
+	tests := []struct {
+		name   string
+		inputs model.Inputs
+		want   []string
+	}{
+		{name: "no shared arguments", want: []string{"state", "mv"}},
+		{
+			name: "lock arguments",
+			inputs: model.Inputs{
+				TFArgs:    []string{"-lock-timeout=5m", "-parallelism=2", "-lock=false", "-ignore-remote-version"},
+				PlanArgs:  []string{"-lock-timeout=1m"},
+				ApplyArgs: []string{"-lock-timeout=1m"},
+				Vars:      []string{"env=prod"},
+			},
+			want: []string{"state", "mv", "-lock-timeout=5m", "-lock=false", "-ignore-remote-version"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := StateArgs([]string{"state", "mv"}, tt.inputs); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("StateArgs = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,83 @@
+package util
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// InitTerraform runs 'terraform init' with the given backend configuration files
+func InitTerraform(ctx context.Context, terraformPath, terraformDir string, backendConfigs []string,
+	noColor bool) error {
+	args := []string{"init", "-input=false"}
+	if noColor {
+		args = append(args, "-no-color")
+	}
+	for _, backendConfig := range backendConfigs {
+		args = append(args, "-backend-config="+backendConfig)
+	}
+
+	cmd := TerraformCommand(ctx, terraformPath, terraformDir, args...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("terraform init failed: %w", err)
+	}
+	return nil
+}
+
+// SelectWorkspace selects an existing Terraform workspace
+func SelectWorkspace(ctx context.Context, terraformPath, terraformDir, workspace string) error {
+	// TF_WORKSPACE overrides the selected workspace for every command
+	if env := os.Getenv("TF_WORKSPACE"); env != "" && env != workspace {
+		return fmt.Errorf("TF_WORKSPACE is set to %q, which conflicts with workspace %q", env, workspace)
+	}
+
+	cmd := TerraformCommand(ctx, terraformPath, terraformDir, "workspace", "select", workspace)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to select workspace %q: %s", workspace, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// CurrentWorkspace returns the name of the workspace Terraform will use
+func CurrentWorkspace(ctx context.Context, terraformPath, terraformDir string) (string, error) {
+	cmd := TerraformCommand(ctx, terraformPath, terraformDir, "workspace", "show")
+	output, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to get current workspace: %w", err)
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+// BackendType returns the backend type the directory was initialized with,
+// or "local" when no backend is configured
+func BackendType(terraformDir string) string {
+	dataDir := os.Getenv("TF_DATA_DIR")
+	if dataDir == "" {
+		dataDir = ".terraform"
+	}
+	if !filepath.IsAbs(dataDir) {
+		dataDir = filepath.Join(terraformDir, dataDir)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dataDir, "terraform.tfstate"))
+	if err != nil {
+		return "local"
+	}
+
+	var state struct {
+		Backend struct {
+			Type string `json:"type"`
+		} `json:"backend"`
+	}
+	if err := json.Unmarshal(data, &state); err != nil || state.Backend.Type == "" {
+		return "local"
+	}
+
+	return state.Backend.Type
+}